@@ -5,9 +5,13 @@ import (
 	"github.com/kloudlite/kl/cmd/box"
 	"github.com/kloudlite/kl/cmd/clone"
 	"github.com/kloudlite/kl/cmd/cluster"
+	"github.com/kloudlite/kl/cmd/config"
 	"github.com/kloudlite/kl/cmd/connect"
+	"github.com/kloudlite/kl/cmd/env"
+	"github.com/kloudlite/kl/cmd/export"
 	"github.com/kloudlite/kl/cmd/expose"
 	"github.com/kloudlite/kl/cmd/get"
+	"github.com/kloudlite/kl/cmd/images"
 	"github.com/kloudlite/kl/cmd/intercept"
 	"github.com/kloudlite/kl/cmd/list"
 	"github.com/kloudlite/kl/cmd/packages"
@@ -39,17 +43,22 @@ func init() {
 	rootCmd.AddCommand(use.Cmd)
 	rootCmd.AddCommand(clone.Cmd)
 	rootCmd.AddCommand(runner.InitCommand)
+	rootCmd.AddCommand(runner.ValidateCommand)
 	rootCmd.AddCommand(set_base_url.Cmd)
+	rootCmd.AddCommand(config.Cmd)
 
 	rootCmd.AddCommand(intercept.Cmd)
 	//rootCmd.AddCommand(vpn.Cmd)
 
 	rootCmd.AddCommand(cluster.Cmd)
 	rootCmd.AddCommand(expose.Cmd)
+	rootCmd.AddCommand(export.Cmd)
 
 	rootCmd.AddCommand(add.Command)
 	rootCmd.AddCommand(status.Cmd)
 	rootCmd.AddCommand(packages.Cmd)
+	rootCmd.AddCommand(images.Cmd)
+	rootCmd.AddCommand(env.Cmd)
 
 	rootCmd.AddCommand(connect.Command)
 }
@@ -54,6 +54,11 @@ var rootCmd = &cobra.Command{
 			flags.IsQuiet = quiet
 		}
 
+		// exported, so that every place resolving the active profile sees it
+		if cmd.Flags().Changed("profile") {
+			os.Setenv("KL_PROFILE", fn.ParseStringFlag(cmd, "profile"))
+		}
+
 		sigChan := make(chan os.Signal, 1)
 
 		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -117,5 +122,6 @@ func init() {
 	for _, c := range rootCmd.Commands() {
 		c.PersistentFlags().BoolP("verbose", "v", false, "verbose output")
 		c.PersistentFlags().BoolP("quiet", "q", false, "quiet output")
+		c.PersistentFlags().String("profile", "", "profile of kl.yml to use, remembered for the workspace by box start and reload")
 	}
 }
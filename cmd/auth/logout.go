@@ -5,9 +5,9 @@ import (
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
-	dockerclient "github.com/docker/docker/client"
 	"github.com/kloudlite/kl/cmd/box/boxpkg"
 	"github.com/kloudlite/kl/domain/fileclient"
+	containerruntime "github.com/kloudlite/kl/pkg/container-runtime"
 	fn "github.com/kloudlite/kl/pkg/functions"
 	"github.com/kloudlite/kl/pkg/ui/spinner"
 	"github.com/spf13/cobra"
@@ -39,7 +39,7 @@ var logoutCmd = &cobra.Command{
 
 func stopAllContainers(cmd *cobra.Command) error {
 	defer spinner.Client.UpdateMessage("stopping container please wait")()
-	cli, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation())
+	cli, err := containerruntime.NewClient()
 	if err != nil {
 		return err
 	}
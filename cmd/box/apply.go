@@ -0,0 +1,23 @@
+package box
+
+import (
+	"os"
+
+	"github.com/kloudlite/kl/cmd/box/boxpkg"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/spf13/cobra"
+)
+
+var applyCmd = &cobra.Command{
+	Use:    "apply",
+	Short:  "apply env vars and mounts of kl.yml to the running box",
+	Long:   `apply env vars and mounts of kl.yml to the running box, it is run as root in the box by kl when only env vars or mounts changed`,
+	Hidden: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := boxpkg.ApplyReload(); err != nil {
+			fn.PrintError(err)
+			// kl on the host falls back to restarting the box on failure
+			os.Exit(1)
+		}
+	},
+}
@@ -11,4 +11,13 @@ const (
 	CONT_WORKSPACE_MARK_KEY = "kl.container.workspace"
 	SSH_PORT_KEY            = "kl.container.ssh.port"
 	KLCONFIG_HASH_KEY       = "kl.container.klconfig.hash"
+	KLRESTART_HASH_KEY      = "kl.container.restart.hash"
+	CONT_TEAM_KEY           = "kl.container.team"
+	CONT_STORE_MARK_KEY     = "kl.container.store"
+	PROXY_PORTS_KEY         = "kl.proxy.ports"
+	PROXY_TARGET_KEY        = "kl.proxy.target"
+	PROXY_WATCH_KEY         = "kl.proxy.watch"
+	SNAPSHOT_NAME_KEY       = "kl.snapshot.name"
+	SNAPSHOT_PATH_KEY       = "kl.snapshot.path"
+	SNAPSHOT_HASH_KEY       = "kl.snapshot.hash"
 )
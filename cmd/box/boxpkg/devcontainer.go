@@ -0,0 +1,118 @@
+package boxpkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/kloudlite/kl/cmd/box/boxpkg/hashctrl"
+	"github.com/kloudlite/kl/constants"
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+)
+
+// DevContainer returns devcontainer.json which starts a container like the
+// box of the workspace, env vars, mounts and packages of kl.yml are loaded
+// in it from the box hash file, which is synced by every kl command changing
+// kl.yml. images of box.dockerfile are built, as devcontainer.json refers to
+// them by their tag
+func (c *client) DevContainer() (*fileclient.DevContainer, error) {
+	if err := hashctrl.SyncBoxHash(c.apic, c.fc, c.cwd); err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	image, err := c.ensureBoxImage()
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	boxhashFileName, err := hashctrl.BoxHashFileName(c.cwd)
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	sshPort, err := c.getFreePort()
+	if err != nil {
+		return nil, fn.Error("failed to get free port")
+	}
+
+	boxEnv, err := c.boxEnv(boxhashFileName, sshPort)
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	containerEnv := make(map[string]string, len(boxEnv))
+	for _, e := range boxEnv {
+		k, v, _ := strings.Cut(e, "=")
+		containerEnv[k] = v
+	}
+	containerEnv["KL_WORKSPACE"] = "${localWorkspaceFolder}"
+
+	vmounts, err := c.boxMounts("")
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	mounts := make([]any, 0, len(vmounts))
+	for _, m := range vmounts {
+		mounts = append(mounts, devContainerMount(m))
+	}
+
+	hc := c.boxHostConfig(sshPort, nil)
+	runArgs := []string{
+		fmt.Sprintf("--network=%s", hc.NetworkMode),
+		fmt.Sprintf("--user=%d:%d", os.Getuid(), os.Getgid()),
+		"--hostname=box",
+	}
+	if hc.Privileged {
+		runArgs = append(runArgs, "--privileged")
+	}
+	for _, h := range hc.ExtraHosts {
+		runArgs = append(runArgs, fmt.Sprintf("--add-host=%s", h))
+	}
+	if hc.UsernsMode != "" {
+		runArgs = append(runArgs, fmt.Sprintf("--userns=%s", hc.UsernsMode))
+	}
+
+	// the devcontainer holds the tunnel like a box, when no box holds it
+	// when it is exported
+	holder, err := c.tunnelHolder(c.cwd)
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+	if holder == nil {
+		runArgs = append(runArgs, fmt.Sprintf("--ip=%s", constants.InterceptWorkspaceServiceIp))
+	} else {
+		fn.Warnf("%s holds the tunnel to the cluster, and only one box can. the devcontainer starts without access to the cluster, stop it before starting the devcontainer and export it again", describeContainer(*holder))
+	}
+
+	forwardPorts := make([]any, 0, len(c.klfile.Ports))
+	for _, p := range c.klfile.Ports {
+		forwardPorts = append(forwardPorts, p.Container)
+	}
+
+	overrideCommand := false
+	return &fileclient.DevContainer{
+		Name:            fmt.Sprintf("kl-%s", filepath.Base(c.cwd)),
+		Image:           image,
+		RunArgs:         runArgs,
+		ContainerEnv:    containerEnv,
+		ForwardPorts:    forwardPorts,
+		Mounts:          mounts,
+		WorkspaceMount:  "source=${localWorkspaceFolder},target=/home/kl/workspace,type=bind,consistency=cached",
+		WorkspaceFolder: "/home/kl/workspace",
+		RemoteUser:      "kl",
+		OverrideCommand: &overrideCommand,
+	}, nil
+}
+
+func devContainerMount(m mount.Mount) string {
+	s := fmt.Sprintf("source=%s,target=%s,type=%s", m.Source, m.Target, m.Type)
+	if m.ReadOnly {
+		s += ",readonly"
+	}
+
+	return s
+}
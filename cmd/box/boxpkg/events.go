@@ -0,0 +1,164 @@
+package boxpkg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/kloudlite/kl/cmd/box/boxpkg/hashctrl"
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+)
+
+type EventType string
+
+const (
+	EventCreated        EventType = "created"
+	EventStarted        EventType = "started"
+	EventStartFailed    EventType = "start-failed"
+	EventStopped        EventType = "stopped"
+	EventRestarted      EventType = "restarted"
+	EventReloaded       EventType = "reloaded"
+	EventHashChanged    EventType = "hash-changed"
+	EventProxySynced    EventType = "proxy-synced"
+	EventInterceptAdded EventType = "intercept-added"
+	EventTunnelMoved    EventType = "tunnel-moved"
+
+	EventSnapshotCreated  EventType = "snapshot-created"
+	EventSnapshotRestored EventType = "snapshot-restored"
+	EventSnapshotRemoved  EventType = "snapshot-removed"
+)
+
+// maxEvents is how many events are kept per box, older ones are dropped
+const maxEvents = 200
+
+// Event is a change to the box of a workspace recorded by kl, events are
+// kept in the config folder so they outlive the container
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    EventType `json:"type"`
+	Message string    `json:"message"`
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("%s %-15s %s", e.Time.Local().Format(time.DateTime), e.Type, e.Message)
+}
+
+func eventsFilePath(workspacePath string) (string, error) {
+	fileName, err := hashctrl.BoxHashFileName(workspacePath)
+	if err != nil {
+		return "", fn.NewE(err)
+	}
+
+	configFolder, err := fileclient.GetConfigFolder()
+	if err != nil {
+		return "", fn.NewE(err)
+	}
+
+	return path.Join(configFolder, "box-events", fmt.Sprintf("%s.jsonl", fileName)), nil
+}
+
+// ReadEvents returns events of the box of workspacePath, oldest first
+func ReadEvents(workspacePath string) ([]Event, error) {
+	fp, err := eventsFilePath(workspacePath)
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	b, err := os.ReadFile(fp)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Event{}, nil
+		}
+		return nil, fn.NewE(err)
+	}
+
+	resp := make([]Event, 0)
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		var e Event
+		// a line cut short by a crash is skipped
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			continue
+		}
+		resp = append(resp, e)
+	}
+
+	return resp, nil
+}
+
+func writeEvent(workspacePath string, e Event) error {
+	events, err := ReadEvents(workspacePath)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	events = append(events, e)
+	if len(events) > maxEvents {
+		events = events[len(events)-maxEvents:]
+	}
+
+	out := new(bytes.Buffer)
+	for _, e := range events {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return fn.NewE(err)
+		}
+		out.Write(append(b, '\n'))
+	}
+
+	fp, err := eventsFilePath(workspacePath)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	if err := os.MkdirAll(path.Dir(fp), 0o755); err != nil {
+		return fn.NewE(err)
+	}
+
+	tmp := fp + ".tmp"
+	if err := os.WriteFile(tmp, out.Bytes(), 0o644); err != nil {
+		return fn.NewE(err)
+	}
+
+	return os.Rename(tmp, fp)
+}
+
+// RecordEvent records an event of the box of the current workspace. events
+// are only a record, failing to write them never fails a command
+func (c *client) RecordEvent(t EventType, message string) {
+	recordEvent(c.cwd, t, message)
+}
+
+func recordEvent(workspacePath string, t EventType, message string) {
+	if err := writeEvent(workspacePath, Event{Time: time.Now(), Type: t, Message: message}); err != nil {
+		fn.Debug(fmt.Sprintf("failed to record box event %s: %s", t, err.Error()))
+	}
+}
+
+func (c *client) Events() ([]Event, error) {
+	return ReadEvents(c.cwd)
+}
+
+// lastEvents formats the last n events of the box, for errors of commands
+func (c *client) lastEvents(n int) string {
+	events, err := c.Events()
+	if err != nil || len(events) == 0 {
+		return ""
+	}
+
+	if len(events) > n {
+		events = events[len(events)-n:]
+	}
+
+	out := new(bytes.Buffer)
+	for _, e := range events {
+		fmt.Fprintln(out, e.String())
+	}
+
+	return out.String()
+}
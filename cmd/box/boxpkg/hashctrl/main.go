@@ -2,6 +2,7 @@ package hashctrl
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -11,6 +12,7 @@ import (
 	"slices"
 	"strings"
 
+	"github.com/kloudlite/kl/cmd/box/boxpkg/imagectrl"
 	"github.com/kloudlite/kl/cmd/box/boxpkg/packagectrl"
 	"github.com/kloudlite/kl/domain/apiclient"
 	"github.com/kloudlite/kl/domain/envclient"
@@ -69,21 +71,38 @@ func generateBoxHashContent(apic apiclient.ApiClient, fc fileclient.FileClient,
 }
 
 func BoxHashFile(workspacePath string) (*PersistedEnv, error) {
-	fileName, err := BoxHashFileName(workspacePath)
+	pe, _, err := readBoxHashFile(workspacePath)
 	if err != nil {
 		return nil, fn.NewE(err)
 	}
+
+	return pe, nil
+}
+
+// BoxHash returns the hash of env vars, mounts and packages of the box hash
+// file, shells of the box compare it with the hash the box was set up with
+func BoxHash(workspacePath string) (string, error) {
+	_, hash, err := readBoxHashFile(workspacePath)
+	if err != nil {
+		return "", fn.NewE(err)
+	}
+
+	return hash, nil
+}
+
+func readBoxHashFile(workspacePath string) (*PersistedEnv, string, error) {
+	fileName, err := BoxHashFileName(workspacePath)
+	if err != nil {
+		return nil, "", fn.NewE(err)
+	}
 	configFolder, err := fileclient.GetConfigFolder()
 	if err != nil {
-		return nil, fn.NewE(err)
+		return nil, "", fn.NewE(err)
 	}
 	filePath := path.Join(configFolder, "box-hash", fileName)
 	data, err := os.ReadFile(filePath)
-	if err != nil && !os.IsNotExist(err) {
-		return nil, fn.NewE(err)
-	}
-	if os.IsNotExist(err) {
-		return nil, fn.NewE(err)
+	if err != nil {
+		return nil, "", fn.NewE(err)
 	}
 	var r struct {
 		Config PersistedEnv `json:"config"`
@@ -91,9 +110,9 @@ func BoxHashFile(workspacePath string) (*PersistedEnv, error) {
 	}
 
 	if err = json.Unmarshal(data, &r); err != nil {
-		return nil, fn.NewE(err)
+		return nil, "", fn.NewE(err)
 	}
-	return &r.Config, nil
+	return &r.Config, r.Hash, nil
 }
 
 func BoxHashFileName(path string) (string, error) {
@@ -135,6 +154,11 @@ func SyncBoxHash(apic apiclient.ApiClient, fc fileclient.FileClient, fpath strin
 		return fn.Error("envName is required")
 	}
 
+	klFile, err = klFile.WithProfile(fileclient.ResolveProfile(e))
+	if err != nil {
+		return fn.NewE(err)
+	}
+
 	configFolder, err := fileclient.GetConfigFolder()
 	if err != nil {
 		return fn.NewE(err)
@@ -161,14 +185,28 @@ func SyncBoxHash(apic apiclient.ApiClient, fc fileclient.FileClient, fpath strin
 	return nil
 }
 
-func GenerateKLConfigHash(kf *fileclient.KLFileType) (string, error) {
+// GenerateKLConfigHash hashes kf as returned by GetKlFile, i.e. kl.yml with
+// kl.local.yml and KLCONFIG_OVERLAYS merged over it, so that changing any of
+// the layers is detected. the active profile and the image of the box, which
+// is hashed from its build when kl.yml sets box.dockerfile, are hashed as
+// well, as are values of env vars of the host referenced with ${env:NAME}
+func GenerateKLConfigHash(kf *fileclient.KLFileType, wpath string) (string, error) {
 	defer spinner.Client.UpdateMessage("validating kl.yml and parsing environment variables")()
 
 	klConfhash := md5.New()
-	slices.SortFunc(kf.EnvVars, func(a, b fileclient.EnvType) int {
+	klConfhash.Write([]byte(kf.ActiveProfile))
+	if kf.Box.IsCustom() {
+		image, err := imagectrl.ImageName(kf, wpath)
+		if err != nil {
+			return "", fn.NewE(err)
+		}
+		klConfhash.Write([]byte(image))
+	}
+	envVars := slices.Clone(kf.EnvVars)
+	slices.SortFunc(envVars, func(a, b fileclient.EnvType) int {
 		return strings.Compare(a.Key, b.Key)
 	})
-	for _, v := range kf.EnvVars {
+	for _, v := range envVars {
 		klConfhash.Write([]byte(v.Key))
 		klConfhash.Write([]byte(func() string {
 			if v.Value != nil {
@@ -195,8 +233,18 @@ func GenerateKLConfigHash(kf *fileclient.KLFileType) (string, error) {
 			return ""
 		}()))
 	}
-	slices.Sort(kf.Packages)
-	for _, v := range kf.Packages {
+	// values of env vars of the host are resolved, so that changing them is
+	// detected. only their digest is hashed, as they may hold secrets
+	for _, name := range kf.EnvVars.HostEnvRefs() {
+		klConfhash.Write([]byte(name))
+		if v, ok := os.LookupEnv(name); ok {
+			sum := sha256.Sum256([]byte(v))
+			klConfhash.Write(sum[:])
+		}
+	}
+	pkgs := slices.Clone(kf.Packages)
+	slices.Sort(pkgs)
+	for _, v := range pkgs {
 		klConfhash.Write([]byte(v))
 	}
 	for _, v := range kf.Mounts {
@@ -218,13 +266,37 @@ func GenerateKLConfigHash(kf *fileclient.KLFileType) (string, error) {
 	return fmt.Sprintf("%x", klConfhash.Sum(nil)), nil
 }
 
+// generateRestartHash hashes what the box is created with, packages and the
+// image, changing any of them requires restarting the box. ports are exposed
+// by proxies next to the box and are synced without restarting it
+func generateRestartHash(kf *fileclient.KLFileType, packageHashes map[string]string, wpath string) (string, error) {
+	hash := md5.New()
+
+	packages := keys(packageHashes)
+	slices.Sort(packages)
+	for _, v := range packages {
+		hash.Write([]byte(v))
+		hash.Write([]byte(packageHashes[v]))
+	}
+
+	if kf.Box.IsCustom() {
+		image, err := imagectrl.ImageName(kf, wpath)
+		if err != nil {
+			return "", fn.NewE(err)
+		}
+		hash.Write([]byte(image))
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
 func generatePersistedEnv(apic apiclient.ApiClient, fc fileclient.FileClient, kf *fileclient.KLFileType, envName string, path string) (*PersistedEnv, error) {
 	envs, mm, err := apic.GetLoadMaps()
 	if err != nil {
 		return nil, fn.NewE(err)
 	}
 
-	realPkgs, err := packagectrl.SyncLockfileWithNewConfig(*kf)
+	realPkgs, err := packagectrl.SyncLockfileWithNewConfig(*kf, path)
 	if err != nil {
 		return nil, fn.NewE(err)
 	}
@@ -246,11 +318,19 @@ func generatePersistedEnv(apic apiclient.ApiClient, fc fileclient.FileClient, kf
 
 	ev := map[string]string{}
 	for k, v := range envs {
+		if fileclient.IsRefKey(k) {
+			continue
+		}
 		ev[k] = v
 	}
 
-	for _, ne := range kf.EnvVars.GetEnvs() {
-		ev[ne.Key] = ne.Value
+	literals, err := fileclient.InterpolateEnvs(kf.EnvVars.GetEnvs(), envs)
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	for k, v := range literals {
+		ev[k] = v
 	}
 
 	e, err := fc.EnvOfPath(path)
@@ -262,7 +342,7 @@ func generatePersistedEnv(apic apiclient.ApiClient, fc fileclient.FileClient, kf
 	if err != nil {
 		return nil, fn.NewE(err)
 	}
-	ev["PURE_PROMPT_SYMBOL"] = fmt.Sprintf("(%s) %s", envName, ">")
+	ev["PURE_PROMPT_SYMBOL"] = fmt.Sprintf("(%s) %s", fileclient.PromptName(envName, kf.ActiveProfile), ">")
 	ev["KL_SEARCH_DOMAIN"] = fmt.Sprintf("%s.%s.%s", e.Name, kf.TeamName, extraData.DnsHostSuffix)
 	//ev["KL_DEV"] = "false"
 	//if flags.IsDev() {
@@ -270,7 +350,12 @@ func generatePersistedEnv(apic apiclient.ApiClient, fc fileclient.FileClient, kf
 	//	ev["KL_SEARCH_DOMAIN"] = fmt.Sprintf("%s.%s.dns.devprod.sh", e.Name, kf.TeamName)
 	//}
 
-	klConfhash, err := GenerateKLConfigHash(kf)
+	klConfhash, err := GenerateKLConfigHash(kf, path)
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	restartHash, err := generateRestartHash(kf, realPkgs, path)
 	if err != nil {
 		return nil, fn.NewE(err)
 	}
@@ -278,5 +363,7 @@ func generatePersistedEnv(apic apiclient.ApiClient, fc fileclient.FileClient, kf
 	hashConfig.Env = ev
 	hashConfig.Mounts = fm
 	hashConfig.KLConfHash = klConfhash
+	hashConfig.RestartHash = restartHash
+	hashConfig.Reload = kf.Reload
 	return &hashConfig, nil
 }
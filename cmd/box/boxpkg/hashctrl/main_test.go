@@ -0,0 +1,39 @@
+package hashctrl
+
+import (
+	"testing"
+
+	"github.com/kloudlite/kl/domain/fileclient"
+)
+
+func TestGenerateKLConfigHashHostEnv(t *testing.T) {
+	value := func(s string) *string { return &s }
+	kf := &fileclient.KLFileType{
+		EnvVars: fileclient.EnvVars{{Key: "TOKEN", Value: value("${env:KL_TEST_TOKEN}")}},
+	}
+
+	hash := func() string {
+		h, err := GenerateKLConfigHash(kf, t.TempDir())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return h
+	}
+
+	t.Setenv("KL_TEST_TOKEN", "a")
+	a := hash()
+	if again := hash(); again != a {
+		t.Fatalf("hash changed without changes, %s != %s", again, a)
+	}
+
+	t.Setenv("KL_TEST_TOKEN", "b")
+	if b := hash(); b == a {
+		t.Errorf("hash didn't change when the host env var changed")
+	}
+
+	t.Setenv("KL_TEST_TOKEN", "")
+	empty := hash()
+	if empty == a {
+		t.Errorf("hash didn't change when the host env var was emptied")
+	}
+}
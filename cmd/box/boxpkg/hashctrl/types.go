@@ -3,6 +3,7 @@ package hashctrl
 import (
 	"encoding/json"
 
+	"github.com/kloudlite/kl/domain/fileclient"
 	fn "github.com/kloudlite/kl/pkg/functions"
 )
 
@@ -12,6 +13,10 @@ type PersistedEnv struct {
 	Env           map[string]string `yaml:"env" json:"env"`
 	Mounts        map[string]string `yaml:"mounts" json:"mounts"`
 	KLConfHash    string            `yaml:"klConfHash" json:"klConfHash"`
+	// RestartHash hashes what can only be applied by restarting the box,
+	// changes of env vars and mounts alone are reloaded into the running box
+	RestartHash string               `yaml:"restartHash" json:"restartHash"`
+	Reload      *fileclient.KLReload `yaml:"reload,omitempty" json:"reload,omitempty"`
 }
 
 func (k *PersistedEnv) ToJson() ([]byte, error) {
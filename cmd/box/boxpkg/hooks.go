@@ -0,0 +1,153 @@
+package boxpkg
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/kloudlite/kl/domain/envclient"
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/spinner"
+	"github.com/kloudlite/kl/pkg/ui/text"
+)
+
+// hookScript runs command with the env the box exports for ssh sessions,
+// which carries env vars and packages of kl.yml
+func hookScript(command string) string {
+	return fmt.Sprintf("[ -f /tmp/env ] && source /tmp/env\ncd /home/kl/workspace\n%s", command)
+}
+
+// hookLogger writes every line written to it as output of hook
+type hookLogger struct {
+	mu   *sync.Mutex
+	w    *io.PipeWriter
+	done chan struct{}
+}
+
+func newHookLogger(hook fileclient.HookName, mu *sync.Mutex) *hookLogger {
+	r, w := io.Pipe()
+	l := &hookLogger{mu: mu, w: w, done: make(chan struct{})}
+
+	go func() {
+		defer close(l.done)
+		s := bufio.NewScanner(r)
+		s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for s.Scan() {
+			l.mu.Lock()
+			fn.Log(text.Blue(fmt.Sprintf("[%s]", hook)), s.Text())
+			l.mu.Unlock()
+		}
+		io.Copy(io.Discard, r)
+	}()
+
+	return l
+}
+
+func (l *hookLogger) Write(p []byte) (int, error) {
+	return l.w.Write(p)
+}
+
+func (l *hookLogger) Close() {
+	l.w.Close()
+	<-l.done
+}
+
+// RunHooks runs commands of hook of kl.yml in the box of the workspace, and
+// fails on the first failing command
+func (c *client) RunHooks(hook fileclient.HookName) error {
+	commands := c.klfile.Hooks.Get(hook)
+	if len(commands) == 0 {
+		return nil
+	}
+
+	containerID := ""
+	if !envclient.InsideBox() {
+		cr, err := c.containerAtPath(c.cwd)
+		if err != nil {
+			return fn.NewE(err)
+		}
+		if cr == nil || cr.State != "running" {
+			return fn.Errorf("box of %s is not running, start it with kl box start", c.cwd)
+		}
+		containerID = cr.ID
+	}
+
+	mu := &sync.Mutex{}
+	for i, command := range commands {
+		if err := func() error {
+			defer spinner.Client.UpdateMessage(fmt.Sprintf("running %s hook [%d/%d]: %s", hook, i+1, len(commands), command))()
+
+			stdout, stderr := newHookLogger(hook, mu), newHookLogger(hook, mu)
+			defer stderr.Close()
+			defer stdout.Close()
+
+			var exitCode int
+			var err error
+			if containerID == "" {
+				exitCode, err = runHookLocally(command, stdout, stderr)
+			} else {
+				exitCode, err = c.runHookInContainer(containerID, command, stdout, stderr)
+			}
+			if err != nil {
+				return fn.NewE(err, fmt.Sprintf("failed to run %s hook %q", hook, command))
+			}
+
+			if exitCode != 0 {
+				return fn.Errorf("%s hook %q failed with exit code %d", hook, command, exitCode)
+			}
+
+			return nil
+		}(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func runHookLocally(command string, stdout, stderr io.Writer) (int, error) {
+	cmd := exec.Command("bash", "-c", hookScript(command))
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			return ee.ExitCode(), nil
+		}
+		return 0, err
+	}
+
+	return 0, nil
+}
+
+func (c *client) runHookInContainer(containerID string, command string, stdout, stderr io.Writer) (int, error) {
+	ctx := context.Background()
+
+	execResp, err := c.cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          []string{"bash", "-c", hookScript(command)},
+		WorkingDir:   "/home/kl/workspace",
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, fn.NewE(err, "failed to create exec")
+	}
+
+	resp, err := c.cli.ContainerExecAttach(ctx, execResp.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return 0, fn.NewE(err)
+	}
+	defer resp.Close()
+
+	if _, err := stdcopy.StdCopy(stdout, stderr, resp.Reader); err != nil && err != io.EOF {
+		return 0, fn.NewE(err)
+	}
+
+	return c.getExecExitCode(ctx, execResp.ID)
+}
@@ -0,0 +1,136 @@
+package boxpkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/kloudlite/kl/cmd/box/boxpkg/imagectrl"
+	"github.com/kloudlite/kl/cmd/box/boxpkg/packagectrl"
+	"github.com/kloudlite/kl/constants"
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/spinner"
+)
+
+var buildStepRe = regexp.MustCompile(`^Step \d+/\d+ : `)
+
+// ensureBoxImage makes sure the image the box runs is present and returns
+// it. the kl box image is always pulled, images of box.image and
+// box.dockerfile are started with its entrypoint. a box restored from a
+// snapshot runs from the snapshot until it is removed
+func (c *client) ensureBoxImage() (string, error) {
+	if err := c.ensureImage(constants.GetBoxImageName()); err != nil {
+		return "", fn.NewE(err)
+	}
+
+	if c.env.Snapshot != "" {
+		if ok, err := c.imageExists(c.env.Snapshot); err == nil && ok {
+			return c.env.Snapshot, nil
+		}
+
+		fn.Warn(fmt.Sprintf("snapshot %s the box was restored from is gone, starting the box from its image", c.env.Snapshot))
+		c.env.Snapshot = ""
+		if err := c.fc.SelectEnv(*c.env); err != nil {
+			return "", fn.NewE(err)
+		}
+	}
+
+	image, err := imagectrl.ImageName(c.klfile, c.cwd)
+	if err != nil {
+		return "", fn.NewE(err)
+	}
+
+	if !imagectrl.IsBuilt(image) {
+		if err := c.ensureImage(image); err != nil {
+			return "", fn.NewE(err)
+		}
+		return image, nil
+	}
+
+	if ok, err := c.imageExists(image); err == nil && ok {
+		return image, nil
+	}
+
+	if err := c.buildBoxImage(image); err != nil {
+		return "", fn.NewE(err)
+	}
+
+	return image, nil
+}
+
+// buildBoxImage builds box.dockerfile of kl.yml as image
+func (c *client) buildBoxImage(image string) error {
+	restore := spinner.Client.UpdateMessage(fmt.Sprintf("building box image from %s", c.klfile.Box.Dockerfile))
+	defer func() { restore() }()
+
+	bctx, dockerfile, err := imagectrl.BuildContext(c.cwd, c.klfile.Box)
+	if err != nil {
+		return fn.NewE(err)
+	}
+	defer bctx.Close()
+
+	base := constants.GetBoxImageName()
+	resp, err := c.cli.ImageBuild(c.Context(), bctx, types.ImageBuildOptions{
+		Tags:        []string{image},
+		Dockerfile:  dockerfile,
+		BuildArgs:   map[string]*string{fileclient.BoxImageBuildArg: &base},
+		Remove:      true,
+		ForceRemove: true,
+		Labels:      map[string]string{CONT_MARK_KEY: "true", CONT_PATH_KEY: c.cwd},
+	})
+	if err != nil {
+		return fn.NewE(err, "failed to build box image")
+	}
+	defer resp.Body.Close()
+
+	var logs strings.Builder
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var m jsonmessage.JSONMessage
+		if err := dec.Decode(&m); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return fn.NewE(err, "failed to build box image")
+		}
+
+		if m.Error != nil {
+			return fn.Errorf("failed to build box image from %s: %s\n%s", c.klfile.Box.Dockerfile, m.Error.Message, packagectrl.TailLines(logs.String(), 20))
+		}
+
+		logs.WriteString(m.Stream)
+		line := strings.TrimSpace(m.Stream)
+		if line == "" {
+			continue
+		}
+
+		fn.Debug(line)
+		if buildStepRe.MatchString(line) {
+			restore()
+			restore = spinner.Client.UpdateMessage(fmt.Sprintf("building box image [%s]", line))
+		}
+	}
+
+	return nil
+}
+
+// boxEntrypoint returns entrypoint and cmd of the kl box image, boxes of
+// other images are started with them so that the box is set up the same way
+func (c *client) boxEntrypoint() ([]string, []string, error) {
+	ii, _, err := c.cli.ImageInspectWithRaw(c.Context(), constants.GetBoxImageName())
+	if err != nil {
+		return nil, nil, fn.NewE(err, "failed to inspect box image")
+	}
+
+	if ii.Config == nil {
+		return nil, nil, nil
+	}
+
+	return ii.Config.Entrypoint, ii.Config.Cmd, nil
+}
@@ -0,0 +1,382 @@
+package imagectrl
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kloudlite/kl/constants"
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+)
+
+// BuildRepo is the repo images built from box.dockerfile are tagged in, the
+// tag is the hash of the build, see ImageName
+const BuildRepo = "localhost/kl/box-build"
+
+const dockerIgnoreFile = ".dockerignore"
+
+const (
+	// hashCacheDir keeps hashes of files of build contexts, see hashCache
+	hashCacheDir = "box-build-cache"
+
+	// hashCacheMinAge is how old a file must be for its hash to be cached
+	hashCacheMinAge = 2 * time.Second
+)
+
+// ImageName returns the image the box of the workspace at root runs, the kl
+// box image unless kl.yml sets box. images built from box.dockerfile are
+// tagged with the hash of the kl box image, the Dockerfile and every file of
+// its build context not ignored by .dockerignore, so that changing any of
+// them builds a new image
+func ImageName(kf *fileclient.KLFileType, root string) (string, error) {
+	if !kf.Box.IsCustom() {
+		return constants.GetBoxImageName(), nil
+	}
+
+	if kf.Box.Image != "" {
+		return kf.Box.Image, nil
+	}
+
+	hash, err := hashBuild(root, kf.Box)
+	if err != nil {
+		return "", fn.NewE(err, fmt.Sprintf("failed to hash build of %s", kf.Box.Dockerfile))
+	}
+
+	return fmt.Sprintf("%s:%s", BuildRepo, hash[:16]), nil
+}
+
+// IsBuilt reports whether image was built from box.dockerfile
+func IsBuilt(image string) bool {
+	return strings.HasPrefix(image, BuildRepo+":")
+}
+
+// buildPaths returns the build context of box and the Dockerfile relative to
+// it, the Dockerfile must be inside the context as it is sent with it
+func buildPaths(root string, box *fileclient.KLBox) (string, string, error) {
+	bctx := filepath.Join(root, filepath.FromSlash(box.BuildContext()))
+	df := filepath.Join(root, filepath.FromSlash(box.Dockerfile))
+	if _, err := os.Stat(df); err != nil {
+		return "", "", fn.Errorf("dockerfile %s not found in the workspace", box.Dockerfile)
+	}
+
+	rel, err := filepath.Rel(bctx, df)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", "", fn.Errorf("dockerfile %s must be inside the build context %s", box.Dockerfile, box.BuildContext())
+	}
+
+	return bctx, filepath.ToSlash(rel), nil
+}
+
+// checkBaseImage checks that the final stage of dockerfile is built FROM the
+// kl box image, so that its entrypoint and user are kept
+func checkBaseImage(dockerfile []byte) error {
+	var from string
+	s := bufio.NewScanner(bytes.NewReader(dockerfile))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) >= 2 && strings.EqualFold(fields[0], "FROM") {
+			from = fields[1]
+			if strings.HasPrefix(from, "--platform=") && len(fields) >= 3 {
+				from = fields[2]
+			}
+		}
+	}
+
+	if from == "" {
+		return fn.Error("dockerfile has no FROM instruction")
+	}
+
+	boxRepo, _, _ := strings.Cut(constants.GetBoxImageName(), ":")
+	if strings.Contains(from, fileclient.BoxImageBuildArg) || strings.HasPrefix(from, boxRepo) {
+		return nil
+	}
+
+	return fn.Errorf("dockerfile must be built FROM the kl box image, found FROM %s. declare ARG %s and use FROM ${%s}", from, fileclient.BoxImageBuildArg, fileclient.BoxImageBuildArg)
+}
+
+// readDockerIgnore returns the matcher of .dockerignore of the build
+// context, with the syntax and semantics docker uses for it
+func readDockerIgnore(bctx string) (*patternmatcher.PatternMatcher, error) {
+	f, err := os.Open(filepath.Join(bctx, dockerIgnoreFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return patternmatcher.New(nil)
+		}
+		return nil, fn.NewE(err)
+	}
+	defer f.Close()
+
+	patterns, err := ignorefile.ReadAll(f)
+	if err != nil {
+		return nil, fn.NewE(err, fmt.Sprintf("failed to read %s", dockerIgnoreFile))
+	}
+
+	return patternmatcher.New(patterns)
+}
+
+// walkContext calls f for every file of the build context which is not
+// ignored, in lexical order so that hashes and archives are reproducible
+func walkContext(bctx string, dockerfile string, f func(rel string, fp string, d fs.DirEntry) error) error {
+	pm, err := readDockerIgnore(bctx)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	return filepath.WalkDir(bctx, func(fp string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(bctx, fp)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		// the Dockerfile and .dockerignore are always sent, even when they
+		// are ignored, as docker does it
+		if rel == dockerfile || rel == dockerIgnoreFile {
+			return f(rel, fp, d)
+		}
+
+		skip, err := pm.MatchesOrParentMatches(rel)
+		if err != nil {
+			return err
+		}
+
+		if skip {
+			// an ignored directory is still walked when an exception with !
+			// may match files inside it
+			if d.IsDir() && !pm.Exclusions() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		return f(rel, fp, d)
+	})
+}
+
+type cachedFileHash struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"`
+	Hash    string `json:"hash"`
+}
+
+// hashCache keeps hashes of files of a build context keyed on their size
+// and modification time, so that files are read only when they change
+type hashCache struct {
+	path  string
+	files map[string]cachedFileHash
+	next  map[string]cachedFileHash
+}
+
+// openHashCache returns the hash cache of the build context bctx, it is
+// kept in the kl config folder. the cache is empty when it can't be read
+func openHashCache(bctx string) *hashCache {
+	hc := &hashCache{files: map[string]cachedFileHash{}, next: map[string]cachedFileHash{}}
+
+	configFolder, err := fileclient.GetConfigFolder()
+	if err != nil {
+		return hc
+	}
+
+	h := sha256.Sum256([]byte(bctx))
+	hc.path = filepath.Join(configFolder, hashCacheDir, hex.EncodeToString(h[:16])+".json")
+
+	if b, err := os.ReadFile(hc.path); err == nil {
+		if err := json.Unmarshal(b, &hc.files); err != nil {
+			hc.files = map[string]cachedFileHash{}
+		}
+	}
+
+	return hc
+}
+
+// fileHash returns the sha256 of the file fp, from the cache when its size
+// and modification time are unchanged
+func (hc *hashCache) fileHash(rel string, fp string, d fs.DirEntry) (string, error) {
+	fi, err := d.Info()
+	if err != nil {
+		return "", err
+	}
+
+	if c, ok := hc.files[rel]; ok && c.Size == fi.Size() && c.ModTime == fi.ModTime().UnixNano() {
+		hc.next[rel] = c
+		return c.Hash, nil
+	}
+
+	f, err := os.Open(fp)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	// files modified just now may be modified again within the resolution of
+	// their modification time, they are hashed again next time
+	if time.Since(fi.ModTime()) > hashCacheMinAge {
+		hc.next[rel] = cachedFileHash{Size: fi.Size(), ModTime: fi.ModTime().UnixNano(), Hash: sum}
+	}
+
+	return sum, nil
+}
+
+// save writes hashes of the files seen by fileHash, files removed from the
+// context are dropped. failing to cache is not an error of the build
+func (hc *hashCache) save() {
+	if hc.path == "" {
+		return
+	}
+
+	b, err := json.Marshal(hc.next)
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(hc.path), 0o755); err != nil {
+		return
+	}
+
+	if err := os.WriteFile(hc.path, b, 0o644); err != nil {
+		fn.Debug("failed to write build hash cache: " + err.Error())
+	}
+}
+
+func hashBuild(root string, box *fileclient.KLBox) (string, error) {
+	bctx, dockerfile, err := buildPaths(root, box)
+	if err != nil {
+		return "", fn.NewE(err)
+	}
+
+	hc := openHashCache(bctx)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00", constants.GetBoxImageName(), dockerfile)
+
+	if err := walkContext(bctx, dockerfile, func(rel string, fp string, d fs.DirEntry) error {
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(fp)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s\x00->%s\x00", rel, target)
+		case d.Type().IsRegular():
+			sum, err := hc.fileHash(rel, fp, d)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s\x00%s\x00", rel, sum)
+		}
+
+		return nil
+	}); err != nil {
+		return "", fn.NewE(err)
+	}
+
+	hc.save()
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// BuildContext returns the archive of the build context of box.dockerfile
+// and the path of the Dockerfile in it. the archive is written while it is
+// read, it must be read to the end or closed
+func BuildContext(root string, box *fileclient.KLBox) (io.ReadCloser, string, error) {
+	bctx, dockerfile, err := buildPaths(root, box)
+	if err != nil {
+		return nil, "", fn.NewE(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(bctx, filepath.FromSlash(dockerfile)))
+	if err != nil {
+		return nil, "", fn.NewE(err, fmt.Sprintf("failed to read dockerfile %s", box.Dockerfile))
+	}
+
+	if err := checkBaseImage(b); err != nil {
+		return nil, "", fn.NewE(err, fmt.Sprintf("invalid dockerfile %s", box.Dockerfile))
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeContext(pw, bctx, dockerfile))
+	}()
+
+	return pr, dockerfile, nil
+}
+
+func writeContext(w io.Writer, bctx string, dockerfile string) error {
+	tw := tar.NewWriter(w)
+
+	if err := walkContext(bctx, dockerfile, func(rel string, fp string, d fs.DirEntry) error {
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		var link string
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(fp); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = rel
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		// files are owned by root in the context, as docker does it
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(fp)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
@@ -39,10 +39,49 @@ func (c *client) Info() error {
 	table.KVOutput("Name:", strings.Join(cr.Names, ", "), true)
 	table.KVOutput("State:", cr.State, true)
 	table.KVOutput("Path:", c.cwd, true)
+	table.KVOutput("Image:", cr.Image, true)
 	table.KVOutput("SSH Port:", sshPort, true)
+	if n, ok := cr.NetworkSettings.Networks["kloudlite"]; ok && n != nil && n.IPAddress != "" {
+		table.KVOutput("Address:", n.IPAddress, true)
+	}
+
+	if err := c.printPorts(); err != nil {
+		return fn.NewE(err)
+	}
 
 	fn.Logf("%s %s %s\n", text.Bold("command:"), text.Blue("ssh"), text.Blue(strings.Join([]string{fmt.Sprintf("kl@%s", getDomainFromPath(c.cwd)), "-p", fmt.Sprint(sshPort), "-oStrictHostKeyChecking=no"}, " ")))
 
 	fn.Logf("%s %s\n", text.Bold("vscode:"), text.Blue(fmt.Sprintf("vscode://vscode-remote/ssh-remote+kl@%s:%s/home/kl/workspace", getDomainFromPath(c.cwd), sshPort)))
 	return nil
 }
+
+// printPorts lists ports of kl.yml with where they listen on the host, and
+// whether their proxy is running
+func (c *client) printPorts() error {
+	if len(c.klfile.Ports) == 0 {
+		return nil
+	}
+
+	proxies, err := c.listProxies(c.cwd)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	state := make(map[string]string, len(proxies))
+	for _, p := range proxies {
+		for _, pm := range proxyPorts(p) {
+			state[pm.String()] = p.State
+		}
+	}
+
+	for _, pm := range c.klfile.Ports {
+		s, ok := state[pm.String()]
+		if !ok {
+			s = "not exposed"
+		}
+
+		table.KVOutput("Port:", fmt.Sprintf("%s -> %d (%s)", pm.HostAddress(), pm.Container, s), true)
+	}
+
+	return nil
+}
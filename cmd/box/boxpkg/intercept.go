@@ -0,0 +1,61 @@
+package boxpkg
+
+import (
+	"context"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/kloudlite/kl/domain/envclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+)
+
+// InterceptTarget returns the address traffic of intercepted apps is routed
+// to, which is the address of the box of the current workspace. only the box
+// holding the tunnel can receive intercepted traffic, see holdsTunnel
+func (c *client) InterceptTarget() (string, error) {
+	wpath, err := envclient.GetWorkspacePath()
+	if err != nil {
+		return "", fn.NewE(err)
+	}
+
+	existingContainers, err := c.cli.ContainerList(context.Background(), container.ListOptions{
+		Filters: filters.NewArgs(
+			dockerLabelFilter(CONT_MARK_KEY, "true"),
+			dockerLabelFilter(CONT_WORKSPACE_MARK_KEY, "true"),
+			dockerLabelFilter(CONT_PATH_KEY, wpath),
+		),
+	})
+	if err != nil {
+		return "", fn.NewE(err)
+	}
+
+	if len(existingContainers) == 0 {
+		return "", fn.Error("no container running in current workspace")
+	}
+
+	if !holdsTunnel(existingContainers[0]) {
+		holder, err := c.tunnelHolder(wpath)
+		if err != nil {
+			return "", fn.NewE(err)
+		}
+
+		if holder == nil {
+			return "", fn.Errorf("box of %s is not connected to the cluster, connect it with kl box intercept from the host", wpath)
+		}
+
+		return "", fn.Errorf("box of %s is not connected to the cluster, %s holds the tunnel and only one box can. move it to this box with kl box intercept from the host", wpath, describeContainer(*holder))
+	}
+
+	ip := containerIP(existingContainers[0])
+	if ip == "" {
+		return "", fn.Errorf("box of %s is not connected to kloudlite network", wpath)
+	}
+
+	return ip, nil
+}
+
+// TargetIntercepts routes traffic of intercepted apps to ip, as returned by
+// InterceptTarget
+func (c *client) TargetIntercepts(ip string) error {
+	return c.k3s.SetInterceptTarget(ip)
+}
@@ -0,0 +1,128 @@
+package boxpkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/pkg/stdcopy"
+	fn "github.com/kloudlite/kl/pkg/functions"
+)
+
+// tcpStateListen is the state of listening sockets in /proc/net/tcp
+const tcpStateListen = "0A"
+
+// Listener is a tcp port processes of the box listen on
+type Listener struct {
+	Port int
+	// Loopback is set when the port only listens on a loopback address of
+	// the box, proxies can't reach it
+	Loopback bool
+}
+
+// parseProcNetAddr parses an address of /proc/net/tcp or /proc/net/tcp6,
+// which holds the ip in host byte order of every 32 bits and the port in hex
+func parseProcNetAddr(s string) (net.IP, int, error) {
+	addr, port, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, 0, fn.Errorf("invalid address %q", s)
+	}
+
+	p, err := strconv.ParseUint(port, 16, 16)
+	if err != nil {
+		return nil, 0, fn.NewE(err)
+	}
+
+	b, err := hex.DecodeString(addr)
+	if err != nil || (len(b) != net.IPv4len && len(b) != net.IPv6len) {
+		return nil, 0, fn.Errorf("invalid address %q", s)
+	}
+
+	for i := 0; i < len(b); i += 4 {
+		slices.Reverse(b[i : i+4])
+	}
+
+	return net.IP(b), int(p), nil
+}
+
+// parseListeners returns ports of sockets listening in out, the contents of
+// /proc/net/tcp and /proc/net/tcp6. a port is only loopback when every
+// socket listening on it is
+func parseListeners(out string) []Listener {
+	loopback := map[int]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[3] != tcpStateListen {
+			continue
+		}
+
+		ip, port, err := parseProcNetAddr(fields[1])
+		if err != nil {
+			continue
+		}
+
+		if lo, ok := loopback[port]; !ok || lo {
+			loopback[port] = ip.IsLoopback()
+		}
+	}
+
+	resp := make([]Listener, 0, len(loopback))
+	for port, lo := range loopback {
+		resp = append(resp, Listener{Port: port, Loopback: lo})
+	}
+	slices.SortFunc(resp, func(a, b Listener) int { return a.Port - b.Port })
+
+	return resp
+}
+
+// ListeningPorts returns tcp ports processes of the running box listen on,
+// except the ssh port of the box
+func (c *client) ListeningPorts() ([]Listener, error) {
+	ctx := context.Background()
+	existingContainers, err := c.cli.ContainerList(ctx, container.ListOptions{
+		Filters: filters.NewArgs(
+			dockerLabelFilter(CONT_MARK_KEY, "true"),
+			dockerLabelFilter(CONT_WORKSPACE_MARK_KEY, "true"),
+			dockerLabelFilter(CONT_PATH_KEY, c.cwd),
+		),
+	})
+	if err != nil {
+		return nil, fn.NewE(err, "failed to list containers")
+	}
+	if len(existingContainers) == 0 {
+		return nil, fn.Error(NO_RUNNING_CONTAINERS)
+	}
+	cr := existingContainers[0]
+
+	execResp, err := c.cli.ContainerExecCreate(ctx, cr.ID, container.ExecOptions{
+		Cmd:          []string{"cat", "/proc/net/tcp", "/proc/net/tcp6"},
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, fn.NewE(err, "failed to create exec")
+	}
+
+	resp, err := c.cli.ContainerExecAttach(ctx, execResp.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+	defer resp.Close()
+
+	// /proc/net/tcp6 is missing when ipv6 is disabled, what was read is used
+	out := new(bytes.Buffer)
+	if _, err := stdcopy.StdCopy(out, new(bytes.Buffer), resp.Reader); err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	sshPort, _ := strconv.Atoi(cr.Labels[SSH_PORT_KEY])
+	return slices.DeleteFunc(parseListeners(out.String()), func(l Listener) bool {
+		return l.Port == sshPort
+	}), nil
+}
@@ -0,0 +1,310 @@
+package boxpkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/kloudlite/kl/cmd/box/boxpkg/hashctrl"
+	"github.com/kloudlite/kl/cmd/box/boxpkg/packagectrl"
+	"github.com/kloudlite/kl/cmd/runner/mounter"
+	"github.com/kloudlite/kl/domain/envclient"
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/spinner"
+	"github.com/kloudlite/kl/pkg/ui/text"
+)
+
+// files start.sh sets the box up with, ApplyReload rewrites them when env
+// vars or mounts change. /tmp/env sources boxEnvFile, so every new shell
+// gets the reloaded env
+const (
+	boxEnvFile         = "/tmp/kl-env"
+	BoxEnvJSONFile     = "/tmp/kl-env.json"
+	boxMountsFile      = "/tmp/kl-mounts"
+	boxHashFile        = "/tmp/hash"
+	boxKLConfHashFile  = "/tmp/klconf-hash"
+	boxRestartHashFile = "/tmp/restart-hash"
+)
+
+// applyReloadCommand applies the box hash file in the box, it runs as root
+// as mounts can be anywhere in the box
+var applyReloadCommand = []string{"sudo", "-E", "kl", "box", "apply"}
+
+// applyReloadEnv is set on execs of applyReloadCommand from the host, execs
+// only get the env the box was created with, and kl only reads config of the
+// box inside it, see envclient.InsideBox
+var applyReloadEnv = []string{"IN_DEV_BOX=true"}
+
+func readBoxFile(p string) string {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(b))
+}
+
+// writeBoxFile replaces the file at p, it is owned by the user sudo was run
+// by so that start.sh can rewrite it when the box is started again
+func writeBoxFile(p string, b []byte) error {
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return fn.NewE(err)
+	}
+
+	uid, uerr := strconv.Atoi(os.Getenv("SUDO_UID"))
+	gid, gerr := strconv.Atoi(os.Getenv("SUDO_GID"))
+	if uerr == nil && gerr == nil {
+		if err := os.Chown(tmp, uid, gid); err != nil {
+			return fn.NewE(err)
+		}
+	}
+
+	if err := os.Rename(tmp, p); err != nil {
+		return fn.NewE(err)
+	}
+
+	return nil
+}
+
+// shellQuote quotes s for a posix shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// ApplyReload applies env vars and mounts of the box hash file to the box it
+// runs in, without restarting it. mounted files are rewritten, the env is
+// published to new shells and to kl env watch, and the signal of reload of
+// kl.yml is sent to its processes. it must run as root
+func ApplyReload() error {
+	if os.Geteuid() != 0 {
+		return fn.Error("must be run as root")
+	}
+
+	wpath, err := envclient.GetWorkspacePath()
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	pe, err := hashctrl.BoxHashFile(wpath)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	hash, err := hashctrl.BoxHash(wpath)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	if readBoxFile(boxKLConfHashFile) == pe.KLConfHash {
+		fn.Log(text.Green("box is up to date"))
+		return nil
+	}
+
+	if readBoxFile(boxRestartHashFile) != pe.RestartHash {
+		return fn.Error("packages, image or ports of the box changed, restart the box to apply them")
+	}
+
+	if err := applyMounts(pe.Mounts); err != nil {
+		return fn.NewE(err, "failed to reload mounts")
+	}
+
+	if err := applyEnv(pe.Env); err != nil {
+		return fn.NewE(err, "failed to reload env vars")
+	}
+
+	if err := writeBoxFile(boxHashFile, []byte(hash+"\n")); err != nil {
+		return fn.NewE(err)
+	}
+
+	if err := writeBoxFile(boxKLConfHashFile, []byte(pe.KLConfHash+"\n")); err != nil {
+		return fn.NewE(err)
+	}
+
+	fn.Log(text.Green(fmt.Sprintf("reloaded %d env var(s) and %d mount(s) into the box", len(pe.Env), len(pe.Mounts))))
+
+	return signalReloadProcesses(pe.Reload)
+}
+
+// applyMounts writes mounts, and removes files of mounts which were removed
+// since the box was set up or last reloaded
+func applyMounts(mounts map[string]string) error {
+	files := make(map[string]string, len(mounts))
+	for p, v := range mounts {
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return fn.NewE(err, fmt.Sprintf("failed to decode mount %s", p))
+		}
+		files[p] = string(b)
+	}
+
+	for _, p := range strings.Split(readBoxFile(boxMountsFile), "\n") {
+		if _, ok := files[p]; ok || !filepath.IsAbs(p) {
+			continue
+		}
+
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return fn.NewE(err)
+		}
+	}
+
+	if err := mounter.Mount(files, "/"); err != nil {
+		return fn.NewE(err)
+	}
+
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	slices.Sort(paths)
+
+	return writeBoxFile(boxMountsFile, []byte(strings.Join(paths, "\n")+"\n"))
+}
+
+func applyEnv(env map[string]string) error {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	b := new(bytes.Buffer)
+	for _, k := range keys {
+		fmt.Fprintf(b, "export %s=%s\n", k, shellQuote(env[k]))
+	}
+
+	if err := writeBoxFile(boxEnvFile, b.Bytes()); err != nil {
+		return fn.NewE(err)
+	}
+
+	jb, err := json.Marshal(env)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	return writeBoxFile(BoxEnvJSONFile, jb)
+}
+
+// signalReloadProcesses sends the signal of r to every process of the box
+// whose command name is listed in r
+func signalReloadProcesses(r *fileclient.KLReload) error {
+	if r == nil || len(r.Processes) == 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	pids := make([]string, 0)
+	names := make([]string, 0)
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+
+		comm := readBoxFile(filepath.Join("/proc", e.Name(), "comm"))
+		if !slices.Contains(r.Processes, comm) {
+			continue
+		}
+
+		pids = append(pids, e.Name())
+		names = append(names, fmt.Sprintf("%s (%d)", comm, pid))
+	}
+
+	if len(pids) == 0 {
+		return nil
+	}
+
+	sig := r.GetSignal()
+	if out, err := exec.Command("bash", append([]string{"-c", `kill -s "$0" "$@"`, sig}, pids...)...).CombinedOutput(); err != nil {
+		return fn.Errorf("failed to send SIG%s to %s: %s", sig, strings.Join(names, ", "), strings.TrimSpace(string(out)))
+	}
+
+	fn.Log(text.Blue("[reload]"), fmt.Sprintf("sent SIG%s to %s", sig, strings.Join(names, ", ")))
+	return nil
+}
+
+// reloadInsideBox applies the box hash file to the box kl runs in, when only
+// env vars or mounts changed
+func (c *client) reloadInsideBox() error {
+	wpath, err := envclient.GetWorkspacePath()
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	pe, err := hashctrl.BoxHashFile(wpath)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	if readBoxFile(boxKLConfHashFile) == pe.KLConfHash {
+		return nil
+	}
+
+	if readBoxFile(boxRestartHashFile) != pe.RestartHash {
+		fn.Log(text.Yellow("[#] packages, image or ports changed, restart the box from the host with kl box restart to apply them"))
+		return nil
+	}
+
+	cmd := exec.Command(applyReloadCommand[0], applyReloadCommand[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fn.NewE(err, "failed to reload the box")
+	}
+
+	return nil
+}
+
+// reloadContainer applies the box hash file to the running box with id
+func (c *client) reloadContainer(id string) error {
+	defer spinner.Client.UpdateMessage("reloading env vars and mounts into the box")()
+
+	ctx := context.Background()
+	execResp, err := c.cli.ContainerExecCreate(ctx, id, container.ExecOptions{
+		Cmd:          applyReloadCommand,
+		Env:          applyReloadEnv,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return fn.NewE(err, "failed to create exec")
+	}
+
+	resp, err := c.cli.ContainerExecAttach(ctx, execResp.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return fn.NewE(err)
+	}
+	defer resp.Close()
+
+	out := new(bytes.Buffer)
+	if _, err := stdcopy.StdCopy(out, out, resp.Reader); err != nil {
+		return fn.NewE(err)
+	}
+
+	exitCode, err := c.getExecExitCode(ctx, execResp.ID)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	if exitCode != 0 {
+		return fn.Errorf("%s exited with code %d: %s", strings.Join(applyReloadCommand, " "), exitCode, packagectrl.TailLines(out.String(), 10))
+	}
+
+	fn.Logf("%s", out.String())
+	return nil
+}
@@ -0,0 +1,60 @@
+package boxpkg
+
+import (
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/kloudlite/kl/cmd/box/boxpkg/hashctrl"
+	"github.com/kloudlite/kl/domain/envclient"
+	"github.com/kloudlite/kl/domain/fileclient"
+)
+
+// TestApplyReloadEnv runs the lookups of ApplyReload with the env an exec of
+// applyReloadCommand gets from the host, the box hash file written on the
+// host must be found in the box
+func TestApplyReloadEnv(t *testing.T) {
+	wpath := "/home/dev/src/app"
+
+	hostFile, err := hashctrl.BoxHashFileName(wpath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// env of the box as created by kl box start, the working dir of execs is
+	// the workspace mount instead of the path of the workspace on the host
+	t.Setenv("IN_DEV_BOX", "")
+	t.Setenv("KL_WORKSPACE", wpath)
+	t.Setenv("KL_HASH_FILE", path.Join("/.cache/kl/box-hash", hostFile))
+
+	for _, e := range applyReloadEnv {
+		k, v, _ := strings.Cut(e, "=")
+		t.Setenv(k, v)
+	}
+
+	if !envclient.InsideBox() {
+		t.Fatalf("exec of %v doesn't run inside the box", applyReloadCommand)
+	}
+
+	p, err := envclient.GetWorkspacePath()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p != wpath {
+		t.Errorf("workspace path is %s, want %s", p, wpath)
+	}
+
+	f, err := hashctrl.BoxHashFileName(p)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	configFolder, err := fileclient.GetConfigFolder()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got, want := path.Join(configFolder, "box-hash", f), path.Join("/.cache/kl/box-hash", hostFile); got != want {
+		t.Errorf("box hash file is read from %s, kl box start mounted it at %s", got, want)
+	}
+}
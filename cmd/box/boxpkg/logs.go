@@ -0,0 +1,77 @@
+package boxpkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/kloudlite/kl/cmd/box/boxpkg/packagectrl"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/text"
+)
+
+type LogsOptions struct {
+	Follow bool
+	// Since is a timestamp, or a duration such as 10m relative to now
+	Since string
+	// Tail is how many lines to show from the end, all when empty
+	Tail string
+}
+
+// Logs writes output of the box of the current workspace, its entrypoint,
+// sshd and start.sh, to stdout and stderr
+func (c *client) Logs(opts LogsOptions, stdout io.Writer, stderr io.Writer) error {
+	cr, err := c.containerAtPath(c.cwd)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	rc, err := c.cli.ContainerLogs(c.cmd.Context(), cr.ID, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     opts.Follow,
+		Since:      opts.Since,
+		Tail:       opts.Tail,
+	})
+	if err != nil {
+		return fn.NewE(err, "failed to read logs of the box")
+	}
+	defer rc.Close()
+
+	if _, err := stdcopy.StdCopy(stdout, stderr, rc); err != nil {
+		return fn.NewE(err)
+	}
+
+	return nil
+}
+
+// startFailure records why the box failed to start, and returns err with the
+// tail of the box logs and events, as the container may be gone once they
+// are looked at
+func (c *client) startFailure(containerId string, err error) error {
+	c.RecordEvent(EventStartFailed, err.Error())
+
+	msg := ""
+	out := new(bytes.Buffer)
+	rc, lerr := c.cli.ContainerLogs(context.Background(), containerId, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Tail:       "30",
+	})
+	if lerr == nil {
+		defer rc.Close()
+		_, lerr = stdcopy.StdCopy(out, out, rc)
+	}
+	if lerr == nil && out.Len() > 0 {
+		msg += fmt.Sprintf("\n%s\n%s", text.Yellow("[#] last lines of box logs:"), packagectrl.TailLines(out.String(), 30))
+	}
+
+	if events := c.lastEvents(5); events != "" {
+		msg += fmt.Sprintf("\n%s\n%s", text.Yellow("[#] last box events:"), events)
+	}
+
+	return fn.Errorf("%w%s", err, msg)
+}
@@ -9,17 +9,20 @@ import (
 	"io"
 	"os"
 
+	"github.com/kloudlite/kl/cmd/box/boxpkg/packagectrl"
 	"github.com/kloudlite/kl/domain/apiclient"
 	"github.com/kloudlite/kl/domain/fileclient"
 	"github.com/kloudlite/kl/flags"
 
 	dockerclient "github.com/docker/docker/client"
+	containerruntime "github.com/kloudlite/kl/pkg/container-runtime"
 	fn "github.com/kloudlite/kl/pkg/functions"
 	"github.com/spf13/cobra"
 )
 
 type client struct {
 	cli        *dockerclient.Client
+	runtime    containerruntime.Runtime
 	cmd        *cobra.Command
 	args       []string
 	foreground bool
@@ -38,6 +41,17 @@ type client struct {
 
 type BoxClient interface {
 	SyncProxy(config ProxyConfig) error
+	KLFile() (*fileclient.KLFileType, error)
+	ListeningPorts() ([]Listener, error)
+	Logs(opts LogsOptions, stdout io.Writer, stderr io.Writer) error
+	Events() ([]Event, error)
+	RecordEvent(t EventType, message string)
+
+	CreateSnapshot(name string, force bool) (*Snapshot, error)
+	ListSnapshots(all bool) ([]*Snapshot, error)
+	RestoreSnapshot(name string, skipHome bool) error
+	HomeCacheUsers() ([]string, error)
+	RemoveSnapshot(name string) error
 	Stop() error
 	Restart() error
 	Start() error
@@ -50,6 +64,13 @@ type BoxClient interface {
 
 	ConfirmBoxRestart() error
 	StartWgContainer() error
+	InterceptTarget() (string, error)
+	MoveTunnel(path string) error
+	TargetIntercepts(ip string) error
+	DevContainer() (*fileclient.DevContainer, error)
+	RunHooks(hook fileclient.HookName) error
+	PrefetchPackages(installables map[string]string, jobs int) error
+	StoreRunner() (packagectrl.StoreRunner, func(), error)
 }
 
 func (c *client) Context() context.Context {
@@ -57,7 +78,12 @@ func (c *client) Context() context.Context {
 }
 
 func NewClient(cmd *cobra.Command, args []string) (BoxClient, error) {
-	cli, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation())
+	rt, err := containerruntime.Get()
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	cli, err := rt.Client()
 	if err != nil {
 		return nil, fn.NewE(err)
 	}
@@ -117,8 +143,14 @@ func NewClient(cmd *cobra.Command, args []string) (BoxClient, error) {
 		return nil, fn.NewE(err)
 	}
 
+	klFile, err = klFile.WithProfile(fileclient.ResolveProfile(env))
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
 	return &client{
 		cli:           cli,
+		runtime:       rt,
 		cmd:           cmd,
 		args:          args,
 		foreground:    foreground,
@@ -132,3 +164,28 @@ func NewClient(cmd *cobra.Command, args []string) (BoxClient, error) {
 		k3s:           k3sClient,
 	}, nil
 }
+
+// rememberProfile saves the active profile for the workspace, so that the
+// following commands resolve the same profile without --profile
+func (c *client) rememberProfile() error {
+	if c.env.Profile == c.klfile.ActiveProfile {
+		return nil
+	}
+
+	c.env.Profile = c.klfile.ActiveProfile
+	if err := c.fc.SelectEnv(*c.env); err != nil {
+		return fn.NewE(err)
+	}
+
+	return nil
+}
+
+// KLFile reads kl.yml again, with the active profile merged over it
+func (c *client) KLFile() (*fileclient.KLFileType, error) {
+	kf, err := c.fc.GetKlFile("")
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	return kf.WithProfile(fileclient.ResolveProfile(c.env))
+}
@@ -0,0 +1,214 @@
+package packagectrl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+)
+
+const devboxAPIEndpoint = "https://search.devbox.sh"
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+type apiSystem struct {
+	CommitHash   string   `json:"commit_hash"`
+	System       string   `json:"system"`
+	StoreHash    string   `json:"store_hash"`
+	StoreName    string   `json:"store_name"`
+	StoreVersion string   `json:"store_version"`
+	AttrPaths    []string `json:"attr_paths"`
+	Version      string   `json:"version"`
+	Summary      string   `json:"summary"`
+}
+
+type apiPackageVersion struct {
+	apiSystem
+
+	Name    string               `json:"name"`
+	Systems map[string]apiSystem `json:"systems,omitempty"`
+}
+
+type apiPackage struct {
+	Name     string              `json:"name"`
+	Versions []apiPackageVersion `json:"versions,omitempty"`
+}
+
+type apiSearchResults struct {
+	Packages []apiPackage `json:"packages,omitempty"`
+}
+
+func (s apiSystem) locked() (LockedSystem, bool) {
+	if s.CommitHash == "" || len(s.AttrPaths) == 0 {
+		return LockedSystem{}, false
+	}
+
+	ls := LockedSystem{Commit: s.CommitHash, AttrPath: s.AttrPaths[0]}
+	if s.StoreHash != "" && s.StoreName != "" {
+		ls.StorePath = fmt.Sprintf("/nix/store/%s-%s", s.StoreHash, s.StoreName)
+		if s.StoreVersion != "" {
+			ls.StorePath += "-" + s.StoreVersion
+		}
+	}
+
+	return ls, true
+}
+
+// apiResolver resolves packages with the search api of devbox, which is
+// served by search.devbox.sh and by mirrors of it
+type apiResolver struct {
+	name     fileclient.PackageResolverType
+	endpoint string
+}
+
+func newAPIResolver(name fileclient.PackageResolverType, endpoint string) *apiResolver {
+	return &apiResolver{name: name, endpoint: strings.TrimSuffix(endpoint, "/")}
+}
+
+func (a *apiResolver) Name() string {
+	return string(a.name)
+}
+
+func (a *apiResolver) Search(ctx context.Context, query string) ([]SearchResult, error) {
+	q := url.Values{}
+	q.Set("q", query)
+
+	sr, err := apiCall[apiSearchResults](ctx, fmt.Sprintf("%s/v1/search?%s", a.endpoint, q.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]SearchResult, 0, len(sr.Packages))
+	for _, p := range sr.Packages {
+		r := SearchResult{Name: p.Name, Versions: make([]SearchVersion, 0, len(p.Versions))}
+		for _, v := range p.Versions {
+			r.Versions = append(r.Versions, SearchVersion{Version: v.Version, Summary: v.Summary})
+		}
+		resp = append(resp, r)
+	}
+
+	return resp, nil
+}
+
+func (a *apiResolver) resolveOnPlatform(ctx context.Context, name, version, platform string) (*apiPackageVersion, error) {
+	q := url.Values{}
+	q.Set("name", name)
+	q.Set("version", version)
+	q.Set("platform", platform)
+
+	res, err := apiCall[apiPackageVersion](ctx, fmt.Sprintf("%s/v1/resolve?%s", a.endpoint, q.Encode()))
+	if err != nil {
+		if err == ErrNotFound {
+			return nil, fn.Errorf("package %s@%s not found", name, version)
+		}
+		return nil, fn.NewE(err, fmt.Sprintf("failed to resolve package %s@%s", name, version))
+	}
+
+	return res, nil
+}
+
+// system returns res on platform, res itself describes the platform it was
+// resolved for when it has no systems
+func (res *apiPackageVersion) system(platform, resolvedFor string) (apiSystem, bool) {
+	if s, ok := res.Systems[platform]; ok {
+		return s, true
+	}
+
+	if res.System == platform || (res.System == "" && platform == resolvedFor) {
+		return res.apiSystem, true
+	}
+
+	return apiSystem{}, false
+}
+
+func (a *apiResolver) Resolve(ctx context.Context, name, version string, platforms []string) (*LockedPackage, error) {
+	// the package is resolved on the other platforms when it is not built for
+	// the primary one, so that the platforms it is available for are known
+	primary := primaryPlatform(platforms)
+	order := append([]string{primary}, slices.DeleteFunc(slices.Clone(platforms), func(p string) bool { return p == primary })...)
+
+	var res *apiPackageVersion
+	var err error
+	for _, platform := range order {
+		if res, err = a.resolveOnPlatform(ctx, name, version, platform); err == nil {
+			primary = platform
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	available := make([]string, 0, len(res.Systems)+1)
+	for platform, s := range res.Systems {
+		if _, ok := s.locked(); ok {
+			available = append(available, platform)
+		}
+	}
+	if _, ok := res.locked(); ok && len(res.Systems) == 0 {
+		available = append(available, primary)
+	}
+
+	lp := &LockedPackage{Version: res.Version, Systems: map[string]LockedSystem{}, summary: res.Summary}
+	for _, platform := range platforms {
+		s, ok := res.system(platform, primary)
+		if !ok {
+			// the resolved version is looked up on platform, it may have been
+			// built from another commit there
+			if r, err := a.resolveOnPlatform(ctx, name, res.Version, platform); err == nil && r.Version == res.Version {
+				s, _ = r.system(platform, platform)
+			}
+		}
+
+		if ls, ok := s.locked(); ok {
+			lp.Systems[platform] = ls
+			available = append(available, platform)
+		}
+	}
+
+	slices.Sort(available)
+	lp.available = slices.Compact(available)
+
+	return lp, nil
+}
+
+func apiCall[T any](ctx context.Context, url string) (*T, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fn.Errorf("GET %s: %w", url, err)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fn.Errorf("GET %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fn.Errorf("GET %s: read response body: %w", url, err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, fn.Errorf("GET %s: unexpected status code %s: %s", url, resp.Status, data)
+	}
+
+	var result T
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fn.Errorf("GET %s: unmarshal response JSON: %w", url, err)
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,158 @@
+package packagectrl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+)
+
+const (
+	// DefaultCacheTTL is how long search and resolve results are reused
+	DefaultCacheTTL = 6 * time.Hour
+
+	// cacheTTLEnv overrides DefaultCacheTTL, 0 disables the cache
+	cacheTTLEnv = "KL_PACKAGE_CACHE_TTL"
+
+	cacheDir = "package-cache"
+)
+
+// CacheTTLFromEnv returns the ttl set by KL_PACKAGE_CACHE_TTL, or
+// DefaultCacheTTL when it is not set
+func CacheTTLFromEnv() (time.Duration, error) {
+	s := os.Getenv(cacheTTLEnv)
+	if s == "" {
+		return DefaultCacheTTL, nil
+	}
+
+	ttl, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fn.Errorf("invalid %s %q, must be a duration such as 30m or 6h", cacheTTLEnv, s)
+	}
+
+	return ttl, nil
+}
+
+type cachedResolve struct {
+	Package   *LockedPackage `json:"package"`
+	Available []string       `json:"available,omitempty"`
+	Summary   string         `json:"summary,omitempty"`
+}
+
+type cacheEntry struct {
+	CreatedAt time.Time      `json:"createdAt"`
+	Search    []SearchResult `json:"search,omitempty"`
+	Resolve   *cachedResolve `json:"resolve,omitempty"`
+}
+
+// cachedResolver reuses search and resolve results of a resolver for ttl,
+// they are kept in the kl config folder so that they are shared by boxes
+type cachedResolver struct {
+	Resolver
+
+	id  string
+	dir string
+	ttl time.Duration
+}
+
+// NewCachedResolver returns the resolver selected by cfg, with its results
+// cached on disk for ttl. the cache is skipped when ttl is 0 or the config
+// folder is not available
+func NewCachedResolver(cfg *fileclient.KLPackageResolver, ttl time.Duration) (Resolver, error) {
+	r, err := NewResolver(cfg)
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	if ttl <= 0 {
+		return r, nil
+	}
+
+	configFolder, err := fileclient.GetConfigFolder()
+	if err != nil {
+		return r, nil
+	}
+
+	// results of different flakes and mirrors are cached apart
+	id := r.Name()
+	if cfg != nil {
+		id = strings.Join([]string{string(cfg.Type), cfg.Flake, cfg.URL}, "|")
+	}
+
+	return &cachedResolver{Resolver: r, id: id, dir: filepath.Join(configFolder, cacheDir), ttl: ttl}, nil
+}
+
+func (c *cachedResolver) path(parts ...string) string {
+	h := sha256.Sum256([]byte(strings.Join(append([]string{c.id}, parts...), "\x00")))
+	return filepath.Join(c.dir, hex.EncodeToString(h[:16])+".json")
+}
+
+func (c *cachedResolver) read(p string) *cacheEntry {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil
+	}
+
+	var e cacheEntry
+	if err := json.Unmarshal(b, &e); err != nil || time.Since(e.CreatedAt) > c.ttl {
+		return nil
+	}
+
+	return &e
+}
+
+// write stores e, failing to cache is not an error of the lookup
+func (c *cachedResolver) write(p string, e cacheEntry) {
+	e.CreatedAt = time.Now()
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return
+	}
+
+	if err := os.WriteFile(p, b, 0o644); err != nil {
+		fn.Debug("failed to write package cache: " + err.Error())
+	}
+}
+
+func (c *cachedResolver) Search(ctx context.Context, query string) ([]SearchResult, error) {
+	p := c.path("search", query)
+	if e := c.read(p); e != nil && e.Search != nil {
+		return e.Search, nil
+	}
+
+	sr, err := c.Resolver.Search(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.write(p, cacheEntry{Search: sr})
+	return sr, nil
+}
+
+func (c *cachedResolver) Resolve(ctx context.Context, name, version string, platforms []string) (*LockedPackage, error) {
+	p := c.path(append([]string{"resolve", name, version}, platforms...)...)
+	if e := c.read(p); e != nil && e.Resolve != nil && e.Resolve.Package != nil {
+		lp := e.Resolve.Package
+		lp.available, lp.summary = e.Resolve.Available, e.Resolve.Summary
+		return lp, nil
+	}
+
+	lp, err := c.Resolver.Resolve(ctx, name, version, platforms)
+	if err != nil {
+		return nil, err
+	}
+
+	c.write(p, cacheEntry{Resolve: &cachedResolve{Package: lp, Available: lp.available, Summary: lp.summary}})
+	return lp, nil
+}
@@ -0,0 +1,128 @@
+package packagectrl
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/spinner"
+)
+
+// PackageInfo describes a package of kl.lock on a platform, ClosureSize and
+// Binaries are read from the nix store of boxes when the package is fetched
+type PackageInfo struct {
+	Package     string   `json:"package"`
+	Version     string   `json:"version"`
+	Platform    string   `json:"platform"`
+	Commit      string   `json:"commit,omitempty"`
+	AttrPath    string   `json:"attrPath,omitempty"`
+	Source      string   `json:"source,omitempty"`
+	StorePath   string   `json:"storePath,omitempty"`
+	Fetched     bool     `json:"fetched"`
+	ClosureSize int64    `json:"closureSize,omitempty"`
+	Summary     string   `json:"summary,omitempty"`
+	Binaries    []string `json:"binaries,omitempty"`
+}
+
+// Info describes pkg of lf on platform, its summary is looked up with r and
+// left out when r can't be reached. local sources are in the workspace at
+// root
+func Info(ctx context.Context, r Resolver, run StoreRunner, lf *Lockfile, pkg string, platform, root string) (*PackageInfo, error) {
+	defer spinner.Client.UpdateMessage(fmt.Sprintf("inspecting package %s", pkg))()
+
+	lp := lf.Packages[pkg]
+	if !lp.Locked(platform) {
+		return nil, fn.Errorf("package %s is not locked for %s, run kl pkg lock", pkg, platform)
+	}
+
+	info := &PackageInfo{
+		Package:  pkg,
+		Version:  lp.Version,
+		Platform: platform,
+		Commit:   lp.Systems[platform].Commit,
+		AttrPath: lp.Systems[platform].AttrPath,
+		Source:   lp.Source,
+	}
+
+	if lp.Source == "" {
+		name, _ := SplitPackage(pkg)
+		if rlp, err := r.Resolve(ctx, name, lp.Version, []string{platform}); err == nil {
+			info.Summary = rlp.Summary()
+		} else {
+			fn.Debug(fmt.Sprintf("failed to look up summary of %s: %s", pkg, err.Error()))
+		}
+	}
+
+	storePath, err := storePathOf(ctx, run, lp, platform, root)
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+	info.StorePath = storePath
+	if storePath == "" {
+		return info, nil
+	}
+
+	info.ClosureSize, info.Binaries, info.Fetched, err = queryStorePath(ctx, run, storePath)
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	return info, nil
+}
+
+// Which returns packages of lf which provide binary on platform, a binary
+// is provided by a package when it is in bin of its store path
+func Which(ctx context.Context, run StoreRunner, lf *Lockfile, packages []string, platform, root string, binary string) ([]string, error) {
+	defer spinner.Client.UpdateMessage(fmt.Sprintf("looking up packages providing %s", binary))()
+
+	if binary == "" || strings.Contains(binary, "/") {
+		return nil, fn.Errorf("%q is not a binary name", binary)
+	}
+
+	byPath := make(map[string][]string, len(packages))
+	paths := make([]string, 0, len(packages))
+	for _, pkg := range packages {
+		lp := lf.Packages[pkg]
+		if !lp.Locked(platform) {
+			continue
+		}
+
+		p, err := storePathOf(ctx, run, lp, platform, root)
+		if err != nil {
+			fn.Warn(fmt.Sprintf("skipping package %s: %s", pkg, err.Error()))
+			continue
+		}
+		if p == "" {
+			continue
+		}
+
+		if _, ok := byPath[p]; !ok {
+			paths = append(paths, p)
+		}
+		byPath[p] = append(byPath[p], pkg)
+	}
+
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	out, err := run(ctx, `b=$1
+shift
+for p in "$@"; do
+  [ -e "$p/bin/$b" ] && echo "$p"
+done
+true`, append([]string{binary}, paths...)...)
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	resp := make([]string, 0, 1)
+	for _, p := range strings.Fields(out) {
+		resp = append(resp, byPath[p]...)
+	}
+	slices.Sort(resp)
+
+	return resp, nil
+}
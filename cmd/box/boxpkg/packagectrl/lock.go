@@ -0,0 +1,266 @@
+package packagectrl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/kloudlite/kl/domain/fileclient"
+	"github.com/kloudlite/kl/pkg/fjson"
+	fn "github.com/kloudlite/kl/pkg/functions"
+)
+
+const (
+	LockFileName = "kl.lock"
+
+	lockfileVersion = "v1"
+)
+
+// SupportedPlatforms are the platforms boxes run on, packages are locked for
+// all of them unless platforms of kl.yml lists fewer
+var SupportedPlatforms = fileclient.BoxPlatforms
+
+// CurrentPlatform is the nix system of boxes on this machine
+func CurrentPlatform() string {
+	if arch := os.Getenv("PLATFORM_ARCH"); arch != "" {
+		return arch + "-linux"
+	}
+
+	if runtime.GOARCH == "arm64" {
+		return "aarch64-linux"
+	}
+
+	return "x86_64-linux"
+}
+
+// LockedSystem pins a package to an attr of a nixpkgs commit on a platform,
+// StorePath is the output the attr evaluates to. Flake is set when the commit
+// is not fetched from the nixpkgs of the flake registry, e.g. for a local
+// checkout of nixpkgs
+type LockedSystem struct {
+	Commit    string `json:"commit,omitempty"`
+	Flake     string `json:"flake,omitempty"`
+	AttrPath  string `json:"attrPath"`
+	StorePath string `json:"storePath,omitempty"`
+}
+
+type LockedPackage struct {
+	Version string                  `json:"version"`
+	Systems map[string]LockedSystem `json:"systems,omitempty"`
+
+	// Source is the pinned flake reference or .nix file of packages which are
+	// not resolved from nixpkgs, it is installed on every platform
+	Source string `json:"source,omitempty"`
+	// Hash is the sha256 of local sources, they are locked again when it
+	// changes
+	Hash string `json:"hash,omitempty"`
+
+	// available are the platforms the resolver found the package on, which
+	// may be more than it was locked for
+	available []string
+	// summary describes the package as its resolver does, it is not locked
+	summary string
+}
+
+func (p *LockedPackage) Summary() string {
+	return p.summary
+}
+
+// Locked reports whether p can be installed on platform without resolving it
+// again
+func (p *LockedPackage) Locked(platform string) bool {
+	if p == nil {
+		return false
+	}
+
+	if p.Source != "" {
+		return true
+	}
+
+	s, ok := p.Systems[platform]
+	return ok && (s.Commit != "" || s.Flake != "") && s.AttrPath != ""
+}
+
+// LockedFor reports whether p is locked for every one of platforms
+func (p *LockedPackage) LockedFor(platforms []string) bool {
+	for _, platform := range platforms {
+		if !p.Locked(platform) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Platforms returns the platforms p is locked for, sources are installed on
+// every platform
+func (p *LockedPackage) Platforms() []string {
+	if p == nil {
+		return nil
+	}
+
+	if p.Source != "" {
+		return slices.Clone(SupportedPlatforms)
+	}
+
+	resp := make([]string, 0, len(p.Systems))
+	for platform := range p.Systems {
+		if p.Locked(platform) {
+			resp = append(resp, platform)
+		}
+	}
+	slices.Sort(resp)
+
+	return resp
+}
+
+// Complete reports whether p is locked for every one of platforms with its
+// store path
+func (p *LockedPackage) Complete(platforms []string) bool {
+	if p != nil && p.Source != "" {
+		return true
+	}
+
+	for _, platform := range platforms {
+		if !p.Locked(platform) || p.Systems[platform].StorePath == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Installable is the flake installable of p on platform
+func (p *LockedPackage) Installable(platform string) (string, error) {
+	if !p.Locked(platform) {
+		return "", fn.Errorf("package is not locked for %s", platform)
+	}
+
+	if p.Source != "" {
+		return p.Source, nil
+	}
+
+	s := p.Systems[platform]
+	if s.Flake != "" {
+		return fmt.Sprintf("%s#%s", s.Flake, s.AttrPath), nil
+	}
+
+	return fmt.Sprintf("nixpkgs/%s#%s", s.Commit, s.AttrPath), nil
+}
+
+// Lockfile is kl.lock, packages are keyed by how they are written in kl.yml
+type Lockfile struct {
+	Version string `json:"lockfileVersion"`
+	// Platforms are the platforms of kl.yml packages were locked for
+	Platforms []string                  `json:"platforms,omitempty"`
+	Packages  map[string]*LockedPackage `json:"packages"`
+
+	// legacy holds kl.lock written before it had a version, which mapped
+	// "name@version" to a flake installable
+	legacy map[string]string
+}
+
+func LockfilePath(workspacePath string) string {
+	return filepath.Join(workspacePath, LockFileName)
+}
+
+// ReadLockfile reads kl.lock of the workspace, an empty lock is returned when
+// it doesn't exist. locks written before kl.lock had a version are migrated
+func ReadLockfile(workspacePath string) (*Lockfile, error) {
+	lf := &Lockfile{Version: lockfileVersion, Packages: map[string]*LockedPackage{}}
+
+	b, err := os.ReadFile(LockfilePath(workspacePath))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return lf, nil
+		}
+		return nil, fn.NewE(err, "failed to read kl.lock")
+	}
+
+	var probe map[string]json.RawMessage
+	if err := fjson.Unmarshal(b, &probe); err != nil {
+		return nil, fn.NewE(err, "failed to parse kl.lock")
+	}
+
+	if _, ok := probe["lockfileVersion"]; !ok {
+		var legacy map[string]string
+		if err := fjson.Unmarshal(b, &legacy); err != nil {
+			return nil, fn.NewE(err, "failed to parse kl.lock")
+		}
+		lf.legacy = legacy
+		return lf, nil
+	}
+
+	if err := fjson.Unmarshal(b, lf); err != nil {
+		return nil, fn.NewE(err, "failed to parse kl.lock")
+	}
+
+	if lf.Packages == nil {
+		lf.Packages = map[string]*LockedPackage{}
+	}
+
+	return lf, nil
+}
+
+func (l *Lockfile) Write(workspacePath string) error {
+	l.Version = lockfileVersion
+
+	b, err := fjson.Marshal(l)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	if err := os.WriteFile(LockfilePath(workspacePath), append(b, '\n'), 0o644); err != nil {
+		return fn.NewE(err, "failed to write kl.lock")
+	}
+
+	return nil
+}
+
+// SplitPackage splits a package of kl.yml into its name and version, version
+// is empty when the package is not pinned to one
+func SplitPackage(pkg string) (string, string) {
+	name, version, _ := strings.Cut(pkg, "@")
+	return name, version
+}
+
+// migrateLegacy returns the entry of the lock written before kl.lock had a
+// version for pkg, legacy locks mapped "name@version" to a flake installable
+// of the platform they were created on
+func (l *Lockfile) migrateLegacy(pkg string) *LockedPackage {
+	if fileclient.IsPackageSource(pkg) {
+		return nil
+	}
+
+	name, version := SplitPackage(pkg)
+
+	keys := make([]string, 0, len(l.legacy))
+	for k := range l.legacy {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		kname, kversion := SplitPackage(k)
+		if kname != name || (version != "" && version != "latest" && !strings.HasPrefix(kversion, version)) {
+			continue
+		}
+
+		ref, attr, ok := strings.Cut(strings.TrimPrefix(l.legacy[k], "nixpkgs/"), "#")
+		if !ok {
+			continue
+		}
+
+		return &LockedPackage{
+			Version: kversion,
+			Systems: map[string]LockedSystem{CurrentPlatform(): {Commit: ref, AttrPath: attr}},
+		}
+	}
+
+	return nil
+}
@@ -1,122 +1,310 @@
 package packagectrl
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"github.com/kloudlite/kl/pkg/ui/spinner"
-	"io"
-	"net/http"
 	"os"
 	"slices"
 	"strings"
 
 	"github.com/kloudlite/kl/domain/fileclient"
-	"github.com/kloudlite/kl/pkg/fjson"
 	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/spinner"
 )
 
-type Packages map[string]string
+type LockMode string
 
-func (p *Packages) Marshal() ([]byte, error) {
-	return fjson.Marshal(p)
+const (
+	// LockModeAuto installs packages from kl.lock when they are locked for
+	// every platform of kl.yml and resolves the rest
+	LockModeAuto LockMode = "auto"
+	// LockModeOffline never resolves packages, it fails when one is not locked
+	LockModeOffline LockMode = "offline"
+	// LockModeUpdate resolves every package again
+	LockModeUpdate LockMode = "update"
+	// LockModeStrict fails when kl.yml and kl.lock disagree, kl.lock is never
+	// written
+	LockModeStrict LockMode = "strict"
+
+	// lockModeEnv sets the mode kl.lock is synced with when boxes start
+	lockModeEnv = "KL_LOCK_MODE"
+)
+
+var LockModes = []LockMode{LockModeAuto, LockModeOffline, LockModeUpdate, LockModeStrict}
+
+func ParseLockMode(s string) (LockMode, error) {
+	if s == "" {
+		return LockModeAuto, nil
+	}
+
+	for _, m := range LockModes {
+		if string(m) == strings.ToLower(strings.TrimSpace(s)) {
+			return m, nil
+		}
+	}
+
+	return "", fn.Errorf("unknown lock mode %q, must be one of auto, offline, update or strict", s)
 }
 
-func (p *Packages) Unmarshal(b []byte) error {
-	return fjson.Unmarshal(b, p)
+func LockModeFromEnv() (LockMode, error) {
+	return ParseLockMode(os.Getenv(lockModeEnv))
 }
 
-func SyncLockfileWithNewConfig(config fileclient.KLFileType) (map[string]string, error) {
+// SyncLockfileWithNewConfig syncs kl.lock of the workspace at workspacePath
+// with packages of config, in the mode set by KL_LOCK_MODE. it returns flake
+// installables of the packages on the current platform keyed by name@version
+func SyncLockfileWithNewConfig(config fileclient.KLFileType, workspacePath string) (map[string]string, error) {
 	defer spinner.Client.UpdateMessage("installing nix packages")()
-	_, err := os.Stat("kl.lock")
-	packages := Packages{}
-	if err == nil {
-		file, err := os.ReadFile("kl.lock")
-		if err != nil {
-			return nil, fn.NewE(err)
+
+	mode, err := LockModeFromEnv()
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	platforms := config.LockPlatforms()
+	if current := CurrentPlatform(); !slices.Contains(platforms, current) {
+		return nil, fn.Errorf("boxes on this machine run on %s, which is not in platforms of kl.yml (%s)", current, strings.Join(platforms, ", "))
+	}
+
+	r, err := NewResolver(config.PackageResolver)
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	lf, err := Lock(context.Background(), r, LockedPackages(config), platforms, workspacePath, mode)
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	return lf.Installables(config.Packages, CurrentPlatform(), BoxWorkspacePath)
+}
+
+// LockedPackages returns packages kl.lock holds for config, packages of every
+// profile are locked so that switching profiles doesn't rewrite kl.lock
+func LockedPackages(config fileclient.KLFileType) []string {
+	resp := slices.Clone(config.Packages)
+
+	for _, name := range config.ProfileNames() {
+		for _, p := range config.Profiles[name].Packages {
+			if !slices.Contains(resp, p) {
+				resp = append(resp, p)
+			}
 		}
+	}
+
+	return resp
+}
+
+// Lock syncs kl.lock of the workspace at workspacePath with packages locked
+// for every one of platforms and returns it, packages are resolved with r as
+// set by mode
+func Lock(ctx context.Context, r Resolver, packages []string, platforms []string, workspacePath string, mode LockMode) (*Lockfile, error) {
+	lf, err := ReadLockfile(workspacePath)
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
 
-		if err := packages.Unmarshal(file); err != nil {
+	if mode == LockModeStrict {
+		if err := lf.Verify(packages, platforms, workspacePath); err != nil {
 			return nil, fn.NewE(err)
 		}
+		return lf, nil
 	}
 
-	packagesMap := make(map[string]string)
-	for k := range packages {
-		splits := strings.Split(k, "@")
-		if len(splits) != 2 {
+	platform := CurrentPlatform()
+	changed := lf.legacy != nil
+	locked := make(map[string]*LockedPackage, len(packages))
+	for _, pkg := range packages {
+		if _, ok := locked[pkg]; ok {
 			continue
 		}
 
-		packagesMap[splits[0]] = splits[1]
-	}
+		lp := lf.Packages[pkg]
+		if lp == nil && lf.legacy != nil {
+			lp = lf.migrateLegacy(pkg)
+		}
 
-	for p := range config.Packages {
-		splits := strings.Split(config.Packages[p], "@")
-		if len(splits) == 1 {
-			if _, ok := packagesMap[splits[0]]; ok {
-				continue
+		// local sources are locked by their content, which needs no network
+		if fileclient.IsLocalPackageSource(pkg) {
+			llp, err := lockLocalSource(workspacePath, pkg)
+			if err != nil {
+				return nil, fn.NewE(err)
 			}
-
-			splits = append(splits, "latest")
+			if lp == nil || lp.Source != llp.Source || lp.Hash != llp.Hash {
+				changed = true
+			}
+			locked[pkg] = llp
+			continue
 		}
 
-		if _, ok := packages[splits[0]+"@"+splits[1]]; ok {
+		if mode == LockModeOffline {
+			if !lp.Locked(platform) {
+				return nil, fn.Errorf("package %s is not locked for %s, run kl pkg lock while online", pkg, platform)
+			}
+			locked[pkg] = lp
 			continue
 		}
 
-		platform := os.Getenv("PLATFORM_ARCH") + "-linux"
-		if platform == "-linux" {
-			platform = "x86_64-linux"
+		// entries migrated from an old kl.lock, or missing a platform added
+		// to kl.yml, are resolved again to lock them for every platform
+		if mode == LockModeAuto && lp.LockedFor(platforms) && lf.legacy == nil {
+			locked[pkg] = lp
+			continue
 		}
 
-		resp, err := http.Get(fmt.Sprintf("https://search.devbox.sh/v1/resolve?name=%s&version=%s&platform=%s", splits[0], splits[1], platform))
+		var resolved *LockedPackage
+		if fileclient.IsPackageSource(pkg) {
+			resolved, err = lockFlake(ctx, pkg)
+		} else {
+			resolved, err = resolvePackage(ctx, r, pkg, platforms)
+		}
 		if err != nil {
+			if mode == LockModeAuto && lp.Locked(platform) {
+				fn.Warn(fmt.Sprintf("failed to resolve package %s, installing it from kl.lock: %s", pkg, err.Error()))
+				locked[pkg] = lp
+				continue
+			}
 			return nil, fn.NewE(err)
 		}
 
-		if resp.StatusCode != 200 {
-			return nil, fn.Errorf("failed to fetch package %s", config.Packages[p])
+		locked[pkg] = resolved
+		changed = true
+	}
+
+	for k := range lf.Packages {
+		if _, ok := locked[k]; !ok {
+			changed = true
 		}
+	}
 
-		all, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fn.NewE(err)
+	// packages are only checked for the current platform offline, kl.lock
+	// keeps the platforms it was locked for until every package is locked
+	// for platforms
+	lockedPlatforms := slices.Clone(platforms)
+	if mode == LockModeOffline {
+		for _, lp := range locked {
+			if !lp.LockedFor(platforms) {
+				lockedPlatforms = lf.Platforms
+				break
+			}
 		}
+	}
+	if !slices.Equal(lf.Platforms, lockedPlatforms) {
+		changed = true
+	}
+
+	lf.Packages = locked
+	lf.Platforms = lockedPlatforms
+	lf.legacy = nil
+	if !changed {
+		return lf, nil
+	}
+
+	if err := lf.Write(workspacePath); err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	return lf, nil
+}
+
+// Verify fails when packages and l disagree, i.e. when a package is not
+// locked for one of platforms, is locked to another version, a local source
+// in the workspace at workspacePath changed, or l locks a package which is
+// not in packages
+func (l *Lockfile) Verify(packages []string, platforms []string, workspacePath string) error {
+	if l.legacy != nil {
+		return fn.Error("kl.lock is in an old format, run kl pkg lock to upgrade it")
+	}
 
-		type System struct {
-			AttrPaths []string `json:"attr_paths"`
+	problems := make([]string, 0)
+	for _, pkg := range packages {
+		lp := l.Packages[pkg]
+		if lp == nil {
+			problems = append(problems, fmt.Sprintf("%s is not locked", pkg))
+			continue
 		}
 
-		type Res struct {
-			CommitHash string            `json:"commit_hash"`
-			Version    string            `json:"version"`
-			Systems    map[string]System `json:"systems"`
+		missing := slices.DeleteFunc(slices.Clone(platforms), lp.Locked)
+		if len(missing) > 0 {
+			problems = append(problems, fmt.Sprintf("%s is not locked for %s", pkg, strings.Join(missing, ", ")))
+			continue
 		}
 
-		var res Res
-		err = json.Unmarshal(all, &res)
-		if err != nil {
-			return nil, fn.NewE(err)
+		if fileclient.IsLocalPackageSource(pkg) {
+			llp, err := lockLocalSource(workspacePath, pkg)
+			if err != nil {
+				return fn.NewE(err)
+			}
+			if llp.Source != lp.Source || llp.Hash != lp.Hash {
+				problems = append(problems, fmt.Sprintf("%s changed since it was locked", pkg))
+			}
+			continue
+		}
+
+		if fileclient.IsPackageSource(pkg) {
+			continue
+		}
+
+		if _, version := SplitPackage(pkg); !versionMatches(lp.Version, version) {
+			problems = append(problems, fmt.Sprintf("%s is locked to version %s", pkg, lp.Version))
 		}
+	}
 
-		packages[splits[0]+"@"+res.Version] = fmt.Sprintf("nixpkgs/%s#%s", res.CommitHash, res.Systems[platform].AttrPaths[0])
+	keys := make([]string, 0, len(l.Packages))
+	for k := range l.Packages {
+		keys = append(keys, k)
 	}
+	slices.Sort(keys)
 
-	for k := range packages {
-		splits := strings.Split(k, "@")
-		if !slices.Contains(config.Packages, splits[0]) && !slices.Contains(config.Packages, k) && !slices.Contains(config.Packages, splits[0]+"@latest") {
-			delete(packages, k)
+	for _, k := range keys {
+		if !slices.Contains(packages, k) {
+			problems = append(problems, fmt.Sprintf("%s is locked but not in kl.yml", k))
 		}
 	}
 
-	marshal, err := packages.Marshal()
-	if err != nil {
-		return nil, fn.NewE(err)
+	if len(problems) > 0 {
+		return fn.Errorf("kl.yml and kl.lock disagree, run kl pkg lock to update kl.lock:\n  %s", strings.Join(problems, "\n  "))
 	}
 
-	if err = os.WriteFile("kl.lock", marshal, 0644); err != nil {
-		return nil, fn.NewE(err)
+	return nil
+}
+
+// Installables returns flake installables of packages on platform keyed by
+// name@version, local sources are installed from the workspace at root.
+// every package must be locked
+func (l *Lockfile) Installables(packages []string, platform string, root string) (map[string]string, error) {
+	resp := make(map[string]string, len(packages))
+	for _, pkg := range packages {
+		lp, ok := l.Packages[pkg]
+		if !ok {
+			return nil, fn.Errorf("package %s is not locked", pkg)
+		}
+
+		installable, err := lp.Installable(platform)
+		if err != nil {
+			return nil, fn.NewE(err, fmt.Sprintf("failed to install package %s", pkg))
+		}
+
+		if lp.Source != "" {
+			// version of sources is their revision or hash, so that the box
+			// hash changes with them
+			resp[fmt.Sprintf("%s@%s", pkg, lp.Version)] = sourceInstallable(installable, root)
+			continue
+		}
+
+		name, _ := SplitPackage(pkg)
+		resp[fmt.Sprintf("%s@%s", name, lp.Version)] = installable
+	}
+
+	return resp, nil
+}
+
+// versionMatches reports whether locked satisfies version of a package of
+// kl.yml, versions match as prefixes like the resolve api does
+func versionMatches(locked, version string) bool {
+	if version == "" || version == "latest" {
+		return true
 	}
 
-	return packages, nil
+	return locked == version || strings.HasPrefix(locked, version+".")
 }
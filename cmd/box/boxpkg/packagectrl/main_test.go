@@ -0,0 +1,55 @@
+package packagectrl
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestLockOfflinePlatforms(t *testing.T) {
+	current := CurrentPlatform()
+	other := "aarch64-linux"
+	if current == other {
+		other = "x86_64-linux"
+	}
+
+	tests := []struct {
+		name    string
+		systems []string
+		want    []string
+	}{
+		{name: "locked for the current platform only", systems: []string{current}, want: []string{current}},
+		{name: "locked for every platform", systems: []string{current, other}, want: []string{current, other}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			lp := &LockedPackage{Version: "1.0.0", Systems: map[string]LockedSystem{}}
+			for _, s := range tt.systems {
+				lp.Systems[s] = LockedSystem{Commit: "abc", AttrPath: "tool"}
+			}
+			lf := &Lockfile{Version: lockfileVersion, Platforms: []string{current}, Packages: map[string]*LockedPackage{"tool": lp}}
+			if err := lf.Write(dir); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got, err := Lock(context.Background(), nil, []string{"tool"}, []string{current, other}, dir, LockModeOffline)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(got.Platforms, tt.want) {
+				t.Errorf("platforms = %v, want %v", got.Platforms, tt.want)
+			}
+
+			written, err := ReadLockfile(dir)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(written.Platforms, tt.want) {
+				t.Errorf("platforms of kl.lock = %v, want %v", written.Platforms, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package packagectrl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+)
+
+const defaultNixFlake = "nixpkgs"
+
+// nixResolver resolves packages from a nixpkgs flake with the nix cli, so it
+// works without access to the search api as long as the flake can be fetched
+type nixResolver struct {
+	flake string
+}
+
+func newNixResolver(flake string) *nixResolver {
+	if flake == "" {
+		flake = defaultNixFlake
+	}
+
+	// paths to a checkout of nixpkgs are read as path flakes
+	if strings.HasPrefix(flake, "/") || strings.HasPrefix(flake, ".") {
+		if abs, err := filepath.Abs(flake); err == nil {
+			flake = "path:" + abs
+		}
+	}
+
+	return &nixResolver{flake: flake}
+}
+
+func (n *nixResolver) Name() string {
+	return string(fileclient.PackageResolverNix)
+}
+
+func runNix(ctx context.Context, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath("nix"); err != nil {
+		return nil, fn.Error("nix is not installed, it is required to resolve the package")
+	}
+
+	cmd := exec.CommandContext(ctx, "nix", append([]string{"--extra-experimental-features", "nix-command flakes"}, args...)...)
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fn.Errorf("nix %s: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
+
+type nixFlakeMetadata struct {
+	URL    string `json:"url"`
+	Locked struct {
+		Rev     string `json:"rev"`
+		NarHash string `json:"narHash"`
+	} `json:"locked"`
+}
+
+// lockFlake returns the locked url and revision of the flake, so that
+// packages resolved from it don't change when the flake is updated
+func (n *nixResolver) lockFlake(ctx context.Context) (*nixFlakeMetadata, error) {
+	out, err := runNix(ctx, "flake", "metadata", "--json", n.flake)
+	if err != nil {
+		return nil, fn.NewE(err, fmt.Sprintf("failed to lock flake %s", n.flake))
+	}
+
+	var m nixFlakeMetadata
+	if err := json.Unmarshal(out, &m); err != nil {
+		return nil, fn.NewE(err, fmt.Sprintf("failed to parse metadata of flake %s", n.flake))
+	}
+
+	if m.URL == "" {
+		m.URL = n.flake
+	}
+
+	return &m, nil
+}
+
+type nixSearchResult struct {
+	PName       string `json:"pname"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+}
+
+func (n *nixResolver) Search(ctx context.Context, query string) ([]SearchResult, error) {
+	out, err := runNix(ctx, "search", "--json", n.flake, regexp.QuoteMeta(query))
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	var res map[string]nixSearchResult
+	if err := json.Unmarshal(out, &res); err != nil {
+		return nil, fn.NewE(err, "failed to parse nix search results")
+	}
+
+	if len(res) == 0 {
+		return nil, ErrNotFound
+	}
+
+	resp := make([]SearchResult, 0, len(res))
+	for attr, r := range res {
+		// attrs are searched on the current system, legacyPackages.<system>.
+		// is dropped to get the attr packages are added with
+		name := attr
+		if parts := strings.SplitN(attr, ".", 3); len(parts) == 3 && (parts[0] == "legacyPackages" || parts[0] == "packages") {
+			name = parts[2]
+		}
+
+		resp = append(resp, SearchResult{
+			Name:     name,
+			Versions: []SearchVersion{{Version: r.Version, Summary: r.Description}},
+		})
+	}
+
+	// exact matches first, then shorter names
+	slices.SortFunc(resp, func(a, b SearchResult) int {
+		if (a.Name == query) != (b.Name == query) {
+			if a.Name == query {
+				return -1
+			}
+			return 1
+		}
+		if len(a.Name) != len(b.Name) {
+			return len(a.Name) - len(b.Name)
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return resp, nil
+}
+
+type nixEvalResult struct {
+	Version     string `json:"version"`
+	OutPath     string `json:"outPath"`
+	Description string `json:"description"`
+}
+
+func (n *nixResolver) eval(ctx context.Context, flake, platform, attr string) (*nixEvalResult, error) {
+	out, err := runNix(ctx, "eval", "--json",
+		fmt.Sprintf("%s#legacyPackages.%s.%s", flake, platform, attr),
+		"--apply", `p: { version = p.version or ""; outPath = p.outPath; description = p.meta.description or ""; }`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var res nixEvalResult
+	if err := json.Unmarshal(out, &res); err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	return &res, nil
+}
+
+// Resolve evaluates attr name in the flake, versions other than the one of
+// the attr are looked up in versioned attrs of nixpkgs such as go_1_22
+func (n *nixResolver) Resolve(ctx context.Context, name, version string, platforms []string) (*LockedPackage, error) {
+	m, err := n.lockFlake(ctx)
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	attrs := []string{name}
+	if version != "latest" {
+		attrs = append(attrs, fmt.Sprintf("%s_%s", name, strings.NewReplacer(".", "_", "-", "_").Replace(version)))
+	}
+
+	primary := primaryPlatform(platforms)
+	found := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		res, err := n.eval(ctx, m.URL, primary, attr)
+		if err != nil {
+			continue
+		}
+
+		if !versionMatches(res.Version, version) {
+			found = append(found, res.Version)
+			continue
+		}
+
+		lp := &LockedPackage{Version: res.Version, Systems: map[string]LockedSystem{}, available: []string{primary}, summary: res.Description}
+		for _, platform := range platforms {
+			r := res
+			if platform != primary {
+				if r, err = n.eval(ctx, m.URL, platform, attr); err != nil || r.Version != res.Version {
+					continue
+				}
+				lp.available = append(lp.available, platform)
+			}
+
+			lp.Systems[platform] = LockedSystem{Commit: m.Locked.Rev, Flake: m.URL, AttrPath: attr, StorePath: r.OutPath}
+		}
+		slices.Sort(lp.available)
+
+		return lp, nil
+	}
+
+	if len(found) > 0 {
+		return nil, fn.Errorf("package %s@%s not found in %s, it has version %s", name, version, n.flake, strings.Join(found, ", "))
+	}
+
+	return nil, fn.Errorf("package %s not found in %s", name, n.flake)
+}
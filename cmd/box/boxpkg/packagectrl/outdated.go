@@ -0,0 +1,128 @@
+package packagectrl
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/spinner"
+)
+
+// Outdated compares a package of kl.yml locked in kl.lock with what its
+// resolver serves now. Wanted is the newest version of the locked major
+// version, Latest is the newest version of all
+type Outdated struct {
+	Package string
+	Current string
+	Wanted  string
+	Latest  string
+
+	wanted *LockedPackage
+	latest *LockedPackage
+}
+
+func (o *Outdated) IsOutdated() bool {
+	return o.Current != o.Wanted || o.Current != o.Latest
+}
+
+// Upgrade returns the package of kl.yml upgraded to Wanted, or to Latest when
+// major is set, and its entry of kl.lock
+func (o *Outdated) Upgrade(major bool) (string, *LockedPackage) {
+	lp := o.wanted
+	if major {
+		lp = o.latest
+	}
+
+	if fileclient.IsPackageSource(o.Package) {
+		return o.Package, lp
+	}
+
+	return pinnedLike(o.Package, lp.Version), lp
+}
+
+// pinnedLike returns pkg pinned to version with as many version components
+// as pkg is pinned with, go@1.22 upgraded to 1.23.4 is go@1.23
+func pinnedLike(pkg string, version string) string {
+	name, v := SplitPackage(pkg)
+	if v == "" || v == "latest" {
+		return pkg
+	}
+
+	n := strings.Count(v, ".") + 1
+	parts := strings.Split(version, ".")
+	if len(parts) > n {
+		parts = parts[:n]
+	}
+
+	return fmt.Sprintf("%s@%s", name, strings.Join(parts, "."))
+}
+
+func majorVersion(version string) string {
+	major, _, _ := strings.Cut(version, ".")
+	return major
+}
+
+// CheckOutdated resolves packages locked in lf again with r for platforms,
+// local sources are skipped as they are locked by their content. packages
+// which fail to resolve are reported and skipped
+func CheckOutdated(ctx context.Context, r Resolver, lf *Lockfile, packages []string, platforms []string) []*Outdated {
+	resp := make([]*Outdated, 0, len(packages))
+	for _, pkg := range packages {
+		if fileclient.IsLocalPackageSource(pkg) {
+			continue
+		}
+
+		o, err := checkOutdated(ctx, r, lf.Packages[pkg], pkg, platforms)
+		if err != nil {
+			fn.Warn(fmt.Sprintf("failed to check package %s for updates: %s", pkg, err.Error()))
+			continue
+		}
+
+		resp = append(resp, o)
+	}
+
+	return resp
+}
+
+func checkOutdated(ctx context.Context, r Resolver, lp *LockedPackage, pkg string, platforms []string) (*Outdated, error) {
+	defer spinner.Client.UpdateMessage(fmt.Sprintf("checking package %s for updates", pkg))()
+
+	o := &Outdated{Package: pkg}
+	if lp != nil {
+		o.Current = lp.Version
+	}
+
+	if fileclient.IsPackageSource(pkg) {
+		latest, err := lockFlake(ctx, pkg)
+		if err != nil {
+			return nil, fn.NewE(err)
+		}
+		o.wanted, o.latest = latest, latest
+		o.Wanted, o.Latest = latest.Version, latest.Version
+		return o, nil
+	}
+
+	name, version := SplitPackage(pkg)
+	if o.Current != "" {
+		version = majorVersion(o.Current)
+	}
+
+	latest, err := ResolveVersion(ctx, r, name, "latest", platforms)
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+	o.latest, o.Latest = latest, latest.Version
+
+	o.wanted, o.Wanted = latest, latest.Version
+	if version != "" && version != "latest" && majorVersion(latest.Version) != version {
+		wanted, err := ResolveVersion(ctx, r, name, version, platforms)
+		if err != nil {
+			return nil, fn.NewE(err)
+		}
+		o.wanted, o.Wanted = wanted, wanted.Version
+	}
+
+	return o, nil
+}
@@ -0,0 +1,158 @@
+package packagectrl
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kloudlite/kl/flags"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/spinner"
+	"github.com/kloudlite/kl/pkg/ui/text"
+)
+
+const (
+	// DefaultPrefetchJobs is how many packages are fetched at once
+	DefaultPrefetchJobs = 4
+
+	prefetchAttempts = 3
+	prefetchBackoff  = 2 * time.Second
+)
+
+// Fetcher realises installable into a nix store, args are the nix build args
+// of installable as returned by NixShellArgs
+type Fetcher func(ctx context.Context, args []string) error
+
+// transientNixErrors are nix errors of failed downloads, which are worth
+// retrying unlike evaluation errors
+var transientNixErrors = []string{
+	"unable to download",
+	"unable to fetch",
+	"timed out",
+	"timeout was reached",
+	"connection reset",
+	"connection refused",
+	"could not resolve host",
+	"couldn't resolve host",
+	"http error 5",
+	"ssl connect error",
+	"temporary failure",
+	"some substitutes failed",
+}
+
+func isTransient(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, e := range transientNixErrors {
+		if strings.Contains(msg, e) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Prefetch realises installables keyed by name@version with fetch, jobs of
+// them at a time. failed downloads are retried, every package is attempted
+// and the ones which failed are reported together
+func Prefetch(ctx context.Context, fetch Fetcher, installables map[string]string, jobs int) error {
+	if len(installables) == 0 {
+		return nil
+	}
+
+	if jobs < 1 {
+		jobs = DefaultPrefetchJobs
+	}
+
+	pkgs := make([]string, 0, len(installables))
+	for k := range installables {
+		pkgs = append(pkgs, k)
+	}
+	slices.Sort(pkgs)
+
+	mu := sync.Mutex{}
+	done := 0
+	failed := map[string]error{}
+	restore := spinner.Client.UpdateMessage(fmt.Sprintf("fetching %d package(s) [0/%d]", len(pkgs), len(pkgs)))
+
+	// progress replaces the spinner message as packages finish, so that it
+	// always shows the count of fetched packages
+	progress := func(pkg string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		done++
+		if err != nil {
+			failed[pkg] = err
+		}
+
+		restore()
+		restore = spinner.Client.UpdateMessage(fmt.Sprintf("fetching %d package(s) [%d/%d], %s done", len(pkgs), done, len(pkgs), pkg))
+		if flags.IsVerbose && err == nil {
+			fn.Log(text.Green("[fetched]"), pkg)
+		}
+	}
+
+	sem := make(chan struct{}, jobs)
+	wg := sync.WaitGroup{}
+	for _, pkg := range pkgs {
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(pkg string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			progress(pkg, prefetchOne(ctx, fetch, pkg, installables[pkg], &mu))
+		}(pkg)
+	}
+	wg.Wait()
+	restore()
+
+	if err := ctx.Err(); err != nil {
+		return fn.NewE(err, "fetching packages was interrupted")
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+
+	problems := make([]string, 0, len(failed))
+	for _, pkg := range pkgs {
+		if err, ok := failed[pkg]; ok {
+			problems = append(problems, fmt.Sprintf("%s: %s", pkg, err.Error()))
+		}
+	}
+
+	return fn.Errorf("failed to fetch %d package(s):\n  %s", len(failed), strings.Join(problems, "\n  "))
+}
+
+func prefetchOne(ctx context.Context, fetch Fetcher, pkg, installable string, mu *sync.Mutex) error {
+	var err error
+	for attempt := 1; attempt <= prefetchAttempts; attempt++ {
+		if err = fetch(ctx, NixShellArgs(installable)); err == nil || !isTransient(err) {
+			return err
+		}
+
+		if attempt == prefetchAttempts {
+			break
+		}
+
+		mu.Lock()
+		fn.Warn(fmt.Sprintf("failed to fetch %s, retrying [%d/%d]: %s", pkg, attempt, prefetchAttempts-1, err.Error()))
+		mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * prefetchBackoff):
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,114 @@
+package packagectrl
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/spinner"
+)
+
+var ErrNotFound = fn.Error("not found")
+
+type SearchVersion struct {
+	Version string
+	Summary string
+}
+
+// SearchResult is a package found by a resolver, Versions are newest first
+type SearchResult struct {
+	Name     string
+	Versions []SearchVersion
+}
+
+// Resolver searches packages and locks them to a nixpkgs commit, the
+// resolver of a workspace is selected by packageResolver of kl.yml
+type Resolver interface {
+	Name() string
+	Search(ctx context.Context, query string) ([]SearchResult, error)
+	// Resolve locks version of package name for each of platforms it is
+	// available on, version matches as a prefix and "latest" matches the
+	// newest version
+	Resolve(ctx context.Context, name, version string, platforms []string) (*LockedPackage, error)
+}
+
+// NewResolver returns the resolver selected by cfg, the search api of devbox
+// is used when cfg is nil
+func NewResolver(cfg *fileclient.KLPackageResolver) (Resolver, error) {
+	if cfg == nil {
+		return newAPIResolver(fileclient.PackageResolverDevbox, devboxAPIEndpoint), nil
+	}
+
+	t, err := fileclient.ParsePackageResolverType(string(cfg.Type))
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	switch t {
+	case fileclient.PackageResolverNix:
+		return newNixResolver(cfg.Flake), nil
+	case fileclient.PackageResolverMirror:
+		if cfg.URL == "" {
+			return nil, fn.Error("url of the mirror package resolver is not set in kl.yml")
+		}
+		return newAPIResolver(fileclient.PackageResolverMirror, cfg.URL), nil
+	}
+
+	return newAPIResolver(fileclient.PackageResolverDevbox, devboxAPIEndpoint), nil
+}
+
+// primaryPlatform is the platform of platforms packages are resolved for
+// first, the current platform when it is one of them
+func primaryPlatform(platforms []string) string {
+	if current := CurrentPlatform(); len(platforms) == 0 || slices.Contains(platforms, current) {
+		return current
+	}
+
+	return platforms[0]
+}
+
+// resolvePackage locks pkg of kl.yml with r for every one of platforms
+func resolvePackage(ctx context.Context, r Resolver, pkg string, platforms []string) (*LockedPackage, error) {
+	defer spinner.Client.UpdateMessage(fmt.Sprintf("resolving package %s with %s", pkg, r.Name()))()
+
+	name, version := SplitPackage(pkg)
+	if name == "" {
+		return nil, fn.Errorf("package %q is invalid", pkg)
+	}
+	if version == "" {
+		version = "latest"
+	}
+
+	return ResolveVersion(ctx, r, name, version, platforms)
+}
+
+// ResolveVersion resolves version of package name with r, it fails listing
+// the platforms the package is available for when it is not available for
+// one of platforms
+func ResolveVersion(ctx context.Context, r Resolver, name, version string, platforms []string) (*LockedPackage, error) {
+	lp, err := r.Resolve(ctx, name, version, platforms)
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	missing := make([]string, 0, len(platforms))
+	for _, platform := range platforms {
+		if !lp.Locked(platform) {
+			missing = append(missing, platform)
+		}
+	}
+
+	if len(missing) == 0 {
+		return lp, nil
+	}
+
+	if len(lp.available) == 0 {
+		return nil, fn.Errorf("package %s@%s is not available for %s", name, lp.Version, strings.Join(missing, ", "))
+	}
+
+	return nil, fn.Errorf("package %s@%s is not available for %s, it is available for %s, set platforms in kl.yml to lock it only for those",
+		name, lp.Version, strings.Join(missing, ", "), strings.Join(lp.available, ", "))
+}
@@ -0,0 +1,209 @@
+package packagectrl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/spinner"
+)
+
+// BoxWorkspacePath is where the workspace is mounted in boxes, local sources
+// are installed from it
+const BoxWorkspacePath = "/home/kl/workspace"
+
+// NixShellArgs are args of `nix shell` installing installable, .nix files
+// can't be mixed with flake installables and are installed with --file
+func NixShellArgs(installable string) []string {
+	if strings.HasSuffix(installable, ".nix") {
+		return []string{"--impure", "--file", installable}
+	}
+
+	return []string{installable}
+}
+
+// sourceInstallable returns source of kl.lock as installable in the
+// workspace at root, local sources are locked relative to the workspace
+func sourceInstallable(source, root string) string {
+	switch {
+	case strings.HasPrefix(source, "path:./"):
+		return "path:" + path.Join(root, strings.TrimPrefix(source, "path:"))
+	case strings.HasPrefix(source, "./"):
+		return path.Join(root, source)
+	}
+
+	return source
+}
+
+// lockFlake pins the flake of pkg, such as github:org/repo#tool, to the
+// revision it currently resolves to. nix is required to lock it
+func lockFlake(ctx context.Context, pkg string) (*LockedPackage, error) {
+	defer spinner.Client.UpdateMessage(fmt.Sprintf("locking flake %s", pkg))()
+
+	flake, attr, _ := strings.Cut(pkg, "#")
+	if attr == "" {
+		attr = "default"
+	}
+
+	m, err := newNixResolver(flake).lockFlake(ctx)
+	if err != nil {
+		return nil, fn.NewE(err, fmt.Sprintf("failed to lock package %s", pkg))
+	}
+
+	version := m.Locked.Rev
+	if version == "" {
+		version = strings.TrimPrefix(m.Locked.NarHash, "sha256-")
+	}
+	if len(version) > 12 {
+		version = version[:12]
+	}
+
+	return &LockedPackage{Version: version, Source: fmt.Sprintf("%s#%s", m.URL, attr)}, nil
+}
+
+// lockLocalSource locks a flake or .nix file in the workspace at
+// workspacePath by hash of its content, so that the box is reloaded when it
+// changes. they are installed from the workspace mounted in the box
+func lockLocalSource(workspacePath string, pkg string) (*LockedPackage, error) {
+	p, attr, _ := strings.Cut(strings.TrimPrefix(pkg, "path:"), "#")
+	p, _, _ = strings.Cut(p, "?")
+
+	abs := p
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(workspacePath, p)
+	}
+
+	rel, err := filepath.Rel(workspacePath, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fn.Errorf("package %s must be inside the workspace, only the workspace is mounted in the box", pkg)
+	}
+	rel = "./" + filepath.ToSlash(rel)
+
+	hash, err := hashPath(abs)
+	if err != nil {
+		return nil, fn.NewE(err, fmt.Sprintf("failed to lock package %s", pkg))
+	}
+
+	source := rel
+	if !strings.HasSuffix(p, ".nix") {
+		if attr == "" {
+			attr = "default"
+		}
+		source = fmt.Sprintf("path:%s#%s", rel, attr)
+	}
+
+	return &LockedPackage{Version: hash[:12], Source: source, Hash: "sha256-" + hash}, nil
+}
+
+// hashPath returns sha256 of the file at p, or of the files of the flake in
+// the directory at p, see flakeFiles
+func hashPath(p string) (string, error) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return "", fn.NewE(err)
+	}
+
+	h := sha256.New()
+	if !fi.IsDir() {
+		f, err := os.Open(p)
+		if err != nil {
+			return "", fn.NewE(err)
+		}
+		defer f.Close()
+
+		if _, err := io.Copy(h, f); err != nil {
+			return "", fn.NewE(err)
+		}
+
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	files, err := flakeFiles(p)
+	if err != nil {
+		return "", fn.NewE(err)
+	}
+
+	for _, rel := range files {
+		fp := filepath.Join(p, filepath.FromSlash(rel))
+		fi, err := os.Lstat(fp)
+		if err != nil {
+			// files deleted but still tracked by git
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", fn.NewE(err)
+		}
+
+		switch {
+		case fi.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(fp)
+			if err != nil {
+				return "", fn.NewE(err)
+			}
+			fmt.Fprintf(h, "%s\x00->%s\x00", rel, target)
+		case fi.Mode().IsRegular():
+			b, err := os.ReadFile(fp)
+			if err != nil {
+				return "", fn.NewE(err)
+			}
+			fmt.Fprintf(h, "%s\x00%d\x00", rel, len(b))
+			h.Write(b)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// flakeFiles returns files of the flake in dir a change of which relocks it,
+// sorted and relative to dir. in a git work tree they are the files git
+// doesn't ignore, otherwise flake.nix, flake.lock and the other .nix files
+// of dir, so that dependencies and build outputs in the workspace are not
+// read on every lock
+func flakeFiles(dir string) ([]string, error) {
+	if _, err := exec.LookPath("git"); err == nil {
+		cmd := exec.Command("git", "-C", dir, "ls-files", "-z", "--cached", "--others", "--exclude-standard")
+		if out, err := cmd.Output(); err == nil {
+			files := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+			slices.Sort(files)
+			// unmerged files are listed once per stage
+			return slices.Compact(files), nil
+		}
+	}
+
+	files := make([]string, 0)
+	if err := filepath.WalkDir(dir, func(fp string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() && fp != dir && (d.Name() == ".git" || d.Name() == "node_modules") {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(dir, fp)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if rel == "flake.lock" || (!d.IsDir() && strings.HasSuffix(rel, ".nix")) {
+			files = append(files, rel)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	return files, nil
+}
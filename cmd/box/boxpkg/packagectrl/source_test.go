@@ -0,0 +1,81 @@
+package packagectrl
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHashPathFlake(t *testing.T) {
+	tests := []struct {
+		name    string
+		git     bool
+		change  string
+		changes bool
+	}{
+		{name: "flake.nix", change: "flake.nix", changes: true},
+		{name: "flake.lock", change: "flake.lock", changes: true},
+		{name: "imported nix file", change: "nix/tool.nix", changes: true},
+		{name: "file without git", change: "src/main.go", changes: false},
+		{name: "node_modules without git", change: "node_modules/x/index.js", changes: false},
+		{name: "tracked file", git: true, change: "src/main.go", changes: true},
+		{name: "untracked file", git: true, change: "src/new.go", changes: true},
+		{name: "ignored file", git: true, change: "node_modules/x/index.js", changes: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{
+				"flake.nix":               "{ outputs = _: {}; }",
+				"flake.lock":              "{}",
+				"nix/tool.nix":            "{}",
+				"src/main.go":             "package main",
+				"node_modules/x/index.js": "1",
+				".gitignore":              "node_modules\n",
+			})
+
+			if tt.git {
+				if _, err := exec.LookPath("git"); err != nil {
+					t.Skip("git is not installed")
+				}
+				if out, err := exec.Command("git", "-C", dir, "init", "-q").CombinedOutput(); err != nil {
+					t.Fatalf("git init: %s", out)
+				}
+				if out, err := exec.Command("git", "-C", dir, "add", ".").CombinedOutput(); err != nil {
+					t.Fatalf("git add: %s", out)
+				}
+			}
+
+			before, err := hashPath(dir)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			writeFiles(t, dir, map[string]string{tt.change: "changed"})
+
+			after, err := hashPath(dir)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if changed := before != after; changed != tt.changes {
+				t.Errorf("hash changed = %t when %s changed, want %t", changed, tt.change, tt.changes)
+			}
+		})
+	}
+}
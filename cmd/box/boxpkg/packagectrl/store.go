@@ -0,0 +1,106 @@
+package packagectrl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	fn "github.com/kloudlite/kl/pkg/functions"
+)
+
+// StoreRunner runs a bash script with args where the nix store of boxes is
+// mounted at /nix and returns its stdout
+type StoreRunner func(ctx context.Context, script string, args ...string) (string, error)
+
+// storeScript prefixes script with the setup to run nix as boxes do, nix of
+// the box image is installed in the profile of the kl user
+func storeScript(script string) string {
+	return `export PATH=$PATH:/home/kl/.local/state/nix/profiles/profile/bin
+nix() { command nix --extra-experimental-features "nix-command flakes" "$@"; }
+` + script
+}
+
+// LocalStore runs scripts on this machine, inside a box it queries the nix
+// store of boxes
+func LocalStore(ctx context.Context, script string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "bash", append([]string{"-c", script, "kl-store"}, args...)...)
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fn.Errorf("%s", TailLines(stderr.String(), 10))
+	}
+
+	return string(out), nil
+}
+
+// TailLines returns the last n lines of s, nix logs whole builds and their
+// end carries the error
+func TailLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// StoreFetcher realises installables into the store of run
+func StoreFetcher(run StoreRunner) Fetcher {
+	return func(ctx context.Context, args []string) error {
+		if _, err := run(ctx, storeScript(`nix build --no-link "$@"`), args...); err != nil {
+			return fn.Errorf("nix build %s: %s", strings.Join(args, " "), err.Error())
+		}
+
+		return nil
+	}
+}
+
+// storePathOf returns the store path of lp on platform, which kl.lock holds
+// for packages resolved from nixpkgs. the store path of sources is evaluated
+// without building them
+func storePathOf(ctx context.Context, run StoreRunner, lp *LockedPackage, platform, root string) (string, error) {
+	if lp.Source == "" {
+		return lp.Systems[platform].StorePath, nil
+	}
+
+	installable := sourceInstallable(lp.Source, root)
+	args := []string{installable + ".outPath"}
+	if strings.HasSuffix(installable, ".nix") {
+		args = []string{"--impure", "--file", installable, "outPath"}
+	}
+
+	out, err := run(ctx, storeScript(`nix eval --raw "$@"`), args...)
+	if err != nil {
+		return "", fn.NewE(err, "failed to evaluate store path of "+lp.Source)
+	}
+
+	return strings.TrimSpace(out), nil
+}
+
+// queryStorePath returns the closure size of storePath and the binaries it
+// provides, ok is false when it is not in the store
+func queryStorePath(ctx context.Context, run StoreRunner, storePath string) (int64, []string, bool, error) {
+	out, err := run(ctx, storeScript(`out=$(nix path-info --closure-size "$1" 2>/dev/null) || exit 0
+echo "$out"
+ls -1 "$1/bin" 2>/dev/null || true`), storePath)
+	if err != nil {
+		return 0, nil, false, fn.NewE(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	fields := strings.Fields(lines[0])
+	if len(fields) < 2 {
+		return 0, nil, false, nil
+	}
+
+	var size int64
+	if _, err := fmt.Sscan(fields[len(fields)-1], &size); err != nil {
+		return 0, nil, false, fn.Errorf("unexpected output of nix path-info: %s", lines[0])
+	}
+
+	return size, lines[1:], true, nil
+}
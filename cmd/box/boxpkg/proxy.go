@@ -1,61 +1,141 @@
 package boxpkg
 
 import (
-	"crypto/md5"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/go-connections/nat"
 	"github.com/kloudlite/kl/constants"
+	"github.com/kloudlite/kl/domain/fileclient"
 	"github.com/kloudlite/kl/pkg/functions"
 	"github.com/kloudlite/kl/pkg/ui/spinner"
-
-	"github.com/kloudlite/kl/pkg/egob"
 )
 
 type ProxyConfig struct {
 	// TargetContainerId   string
 	TargetContainerPath string
-	ExposedPorts        []int
+	// Watch is set by kl expose watch, WatchedPorts then replace the ports it
+	// exposed. other syncs keep ports exposed by the watcher, unless ports of
+	// kl.yml listen on them
+	Watch        bool
+	WatchedPorts fileclient.Ports
+}
+
+// proxyPorts returns the ports exposed by proxy p. proxies are created with
+// one port each, older proxies exposed every port of the box at once and
+// list them separated by commas
+func proxyPorts(p types.Container) fileclient.Ports {
+	resp := make(fileclient.Ports, 0, 1)
+	for _, v := range strings.Split(p.Labels[PROXY_PORTS_KEY], ",") {
+		pm, err := fileclient.ParsePortMapping(v)
+		if err != nil {
+			continue
+		}
+		resp = append(resp, pm)
+	}
+
+	return resp
+}
+
+// isLegacyProxy reports whether p exposes every port of a box at once, it is
+// replaced by a proxy per port on the next sync
+func isLegacyProxy(p types.Container) bool {
+	_, ok := p.Labels["port-hash"]
+	return ok
 }
 
-func (c *ProxyConfig) GetHash() string {
-	b, err := egob.Marshal(c)
+func (c *client) listProxies(path string) ([]types.Container, error) {
+	args := filters.NewArgs(
+		dockerLabelFilter(CONT_MARK_KEY, "true"),
+		dockerLabelFilter("proxy", "true"),
+	)
+	if path != "" {
+		args.Add("label", fmt.Sprintf("%s=%s", CONT_PATH_KEY, path))
+	}
+
+	resp, err := c.cli.ContainerList(c.cmd.Context(), container.ListOptions{Filters: args, All: true})
 	if err != nil {
-		return ""
+		return nil, functions.NewE(err, "failed to list containers")
 	}
 
-	hash := md5.New()
-	hash.Write(b)
+	return resp, nil
+}
+
+func (c *client) removeProxy(p types.Container) error {
+	if err := c.cli.ContainerRemove(c.cmd.Context(), p.ID, container.RemoveOptions{
+		Force: true,
+	}); err != nil {
+		return functions.NewE(err, "failed to remove container")
+	}
 
-	return fmt.Sprintf("%x", hash.Sum(nil))
+	return nil
 }
 
+// SyncProxy exposes ports of kl.yml, with the active profile merged over it,
+// and ports of kl expose watch of the box at config.TargetContainerPath on
+// the host, a port of the host can only be exposed by one box at a time.
+// every port is exposed by its own proxy for each of its protocols, so ports
+// are added and removed without touching connections to the other ports
 func (c *client) SyncProxy(config ProxyConfig) error {
 	defer spinner.Client.UpdateMessage("updating port configuration")()
 
-	if err := c.ensureImage(constants.SocatImage); err != nil {
-		return functions.NewE(err, "failed to pull image")
+	kf, err := c.KLFile()
+	if err != nil {
+		return functions.NewE(err)
 	}
+	ports := kf.Ports.Split()
+	watched := config.WatchedPorts.Split()
 
-	existingProxies, err := c.cli.ContainerList(c.cmd.Context(), container.ListOptions{
-		Filters: filters.NewArgs(
-			dockerLabelFilter(CONT_MARK_KEY, "true"),
-			dockerLabelFilter("proxy", "true"),
-		),
-	})
+	allProxies, err := c.listProxies("")
 	if err != nil {
-		return functions.NewE(err, "failed to list containers")
+		return functions.NewE(err)
 	}
 
-	if len(existingProxies) > 0 {
-		portHash := existingProxies[0].Labels["port-hash"]
-		if portHash == config.GetHash() && existingProxies[0].State == "running" {
-			return nil
+	// proxies created before every box had its own proxy carry no path and
+	// are replaced by the proxies of this box
+	existingProxies := make([]types.Container, 0, len(allProxies))
+	for _, p := range allProxies {
+		pth, ok := p.Labels[CONT_PATH_KEY]
+		if !ok || pth == config.TargetContainerPath {
+			existingProxies = append(existingProxies, p)
+			continue
+		}
+
+		for _, pm := range proxyPorts(p) {
+			if i := ports.Index(pm); i != -1 {
+				return functions.Errorf("port %s can't be exposed, %s is already exposed by the box of %s", ports[i], pm.HostAddress(), pth)
+			}
+			if i := watched.Index(pm); i != -1 {
+				return functions.Errorf("port %s can't be exposed, %s is already exposed by the box of %s", watched[i], pm.HostAddress(), pth)
+			}
 		}
 	}
 
+	if !config.Watch {
+		for _, p := range existingProxies {
+			if p.Labels[PROXY_WATCH_KEY] != "true" {
+				continue
+			}
+
+			for _, pm := range proxyPorts(p) {
+				if watched.Index(pm) == -1 {
+					watched = append(watched, pm)
+				}
+			}
+		}
+	}
+
+	// ports of kl.yml win over ports of the watcher
+	watched = slices.DeleteFunc(watched, func(pm fileclient.PortMapping) bool {
+		return ports.Index(pm) != -1
+	})
+
 	targetContainers, err := c.cli.ContainerList(c.cmd.Context(), container.ListOptions{
 		Filters: filters.NewArgs(
 			dockerLabelFilter(CONT_MARK_KEY, "true"),
@@ -66,80 +146,110 @@ func (c *client) SyncProxy(config ProxyConfig) error {
 		return functions.NewE(err, "failed to list containers")
 	}
 
+	// ports are exposed when the box is started
 	if len(targetContainers) == 0 {
 		return nil
 	}
 
-	if len(existingProxies) > 0 {
-		if err := c.cli.ContainerKill(c.cmd.Context(), existingProxies[0].ID, "SIGKILL"); err != nil {
-			return functions.NewE(err, "failed to stop container")
+	targetIpAddress := ""
+	if n, ok := targetContainers[0].NetworkSettings.Networks["kloudlite"]; ok && n != nil {
+		targetIpAddress = n.IPAddress
+	}
+	if targetIpAddress == "" {
+		return functions.Errorf("box of %s is not connected to the kloudlite network", config.TargetContainerPath)
+	}
+
+	// proxies which still expose a wanted port of the running box are kept
+	exposed := make(map[string]bool, len(existingProxies))
+	added, removed := make([]string, 0), make([]string, 0)
+	for _, p := range existingProxies {
+		wanted := ports
+		if p.Labels[PROXY_WATCH_KEY] == "true" {
+			wanted = watched
+		}
+
+		pp := proxyPorts(p)
+		keep := !isLegacyProxy(p) && p.State == "running" && len(pp) == 1 &&
+			p.Labels[PROXY_TARGET_KEY] == targetIpAddress &&
+			slices.Contains(wanted, pp[0]) && !exposed[pp[0].String()]
+		if keep {
+			exposed[pp[0].String()] = true
+			continue
+		}
+
+		if err := c.removeProxy(p); err != nil {
+			return functions.NewE(err)
+		}
+		removed = append(removed, pp.Strings()...)
+	}
+
+	for i, pm := range append(slices.Clone(ports), watched...) {
+		if exposed[pm.String()] {
+			continue
 		}
 
-		if err = c.cli.ContainerRemove(c.cmd.Context(), existingProxies[0].ID, container.RemoveOptions{
-			Force: true,
-		}); err != nil {
-			return functions.NewE(err, "failed to remove container")
+		if err := c.createProxy(config.TargetContainerPath, targetIpAddress, pm, i >= len(ports)); err != nil {
+			return functions.NewE(err, fmt.Sprintf("failed to expose port %s", pm))
 		}
+		exposed[pm.String()] = true
+		added = append(added, pm.String())
 	}
 
-	if len(config.ExposedPorts) == 0 {
-		return nil
+	if len(added) > 0 || len(removed) > 0 {
+		recordEvent(config.TargetContainerPath, EventProxySynced, fmt.Sprintf("ports exposed: [%s], removed: [%s]", strings.Join(added, ", "), strings.Join(removed, ", ")))
+	}
+
+	return nil
+}
+
+// createProxy exposes pm, which has one protocol, see PortMapping.Split.
+// proxies of kl expose watch are labelled as watched
+func (c *client) createProxy(path string, targetIpAddress string, pm fileclient.PortMapping, watched bool) error {
+	if err := c.ensureImage(constants.SocatImage); err != nil {
+		return functions.NewE(err, "failed to pull image")
+	}
+
+	listen := fmt.Sprintf("TCP-LISTEN:%d,fork,reuseaddr", pm.Container)
+	connect := fmt.Sprintf("TCP:%s:%d", targetIpAddress, pm.Container)
+	if pm.Protocol == fileclient.PortProtocolUDP {
+		listen = fmt.Sprintf("UDP-RECVFROM:%d,fork", pm.Container)
+		connect = fmt.Sprintf("UDP-SENDTO:%s:%d", targetIpAddress, pm.Container)
 	}
 
-	targetContainer := targetContainers[0]
-	targetIpAddress := targetContainer.NetworkSettings.Networks["kloudlite"].IPAddress
-	socatCommand := ""
-	for _, port := range config.ExposedPorts {
-		socatCommand += fmt.Sprintf(`socat TCP-LISTEN:%d,fork TCP:%s:%d & `, port, targetIpAddress, port)
-		socatCommand += fmt.Sprintf(`socat UDP-RECVFROM:%d,fork UDP-SENDTO:%s:%d & `, port, targetIpAddress, port)
+	labels := map[string]string{
+		CONT_MARK_KEY:    "true",
+		"proxy":          "true",
+		CONT_PATH_KEY:    path,
+		PROXY_PORTS_KEY:  pm.String(),
+		PROXY_TARGET_KEY: targetIpAddress,
+	}
+	if watched {
+		labels[PROXY_WATCH_KEY] = "true"
 	}
-	socatCommand += "tail -f /dev/null"
 
+	port := nat.Port(fmt.Sprintf("%d/%s", pm.Container, pm.Protocol))
 	resp, err := c.cli.ContainerCreate(c.cmd.Context(), &container.Config{
-		Image: constants.SocatImage,
-		Labels: map[string]string{
-			CONT_MARK_KEY: "true",
-			"proxy":       "true",
-			"port-hash":   config.GetHash(),
-		},
-		ExposedPorts: func() nat.PortSet {
-			ports := nat.PortSet{}
-			for _, port := range config.ExposedPorts {
-				ports[nat.Port(fmt.Sprintf("%d/tcp", port))] = struct{}{}
-				ports[nat.Port(fmt.Sprintf("%d/udp", port))] = struct{}{}
-			}
-			return ports
-		}(),
-		Entrypoint: []string{"sh", "-c", socatCommand},
+		Image:        constants.SocatImage,
+		Labels:       labels,
+		ExposedPorts: nat.PortSet{port: {}},
+		Entrypoint:   []string{"socat", listen, connect},
 	}, &container.HostConfig{
-		PortBindings: func() nat.PortMap {
-			portBindings := nat.PortMap{}
-			for _, port := range config.ExposedPorts {
-				portBindings[nat.Port(fmt.Sprintf("%d/tcp", port))] = []nat.PortBinding{
-					{
-						HostPort: fmt.Sprintf("%d", port),
-					},
-				}
-				portBindings[nat.Port(fmt.Sprintf("%d/udp", port))] = []nat.PortBinding{
-					{
-						HostPort: fmt.Sprintf("%d", port),
-					},
-				}
-			}
-			return portBindings
-		}(),
+		PortBindings: nat.PortMap{
+			port: []nat.PortBinding{{HostIP: pm.Bind, HostPort: strconv.Itoa(pm.Host)}},
+		},
 	}, &network.NetworkingConfig{
 		EndpointsConfig: map[string]*network.EndpointSettings{
 			"kloudlite": {},
 		},
 	}, nil, "")
-
 	if err != nil {
 		return functions.NewE(err, "failed to create container")
 	}
 
 	if err := c.cli.ContainerStart(c.cmd.Context(), resp.ID, container.StartOptions{}); err != nil {
+		_ = c.cli.ContainerRemove(c.cmd.Context(), resp.ID, container.RemoveOptions{Force: true})
 		return functions.NewE(err, "failed to start container")
 	}
+
 	return nil
 }
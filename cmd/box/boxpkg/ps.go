@@ -7,7 +7,7 @@ import (
 )
 
 func (c *client) PrintBoxes(conts []Cntr) error {
-	header := table.Row{table.HeaderText("container name"), table.HeaderText("path"), table.HeaderText("state")}
+	header := table.Row{table.HeaderText("container name"), table.HeaderText("path"), table.HeaderText("state"), table.HeaderText("address"), table.HeaderText("ssh port"), table.HeaderText("tunnel")}
 	rows := make([]table.Row, 0)
 
 	for _, a := range conts {
@@ -34,6 +34,34 @@ func (c *client) PrintBoxes(conts []Cntr) error {
 				}
 				return pth
 			}(),
+			func() string {
+				ip := a.IP
+				if ip == "" {
+					ip = "-"
+				}
+
+				if a.Name == c.containerName {
+					return text.Colored(ip, 2)
+				}
+				return ip
+			}(),
+			func() string {
+				if a.Name == c.containerName {
+					return text.Colored(a.Labels[SSH_PORT_KEY], 2)
+				}
+				return a.Labels[SSH_PORT_KEY]
+			}(),
+			func() string {
+				t := "-"
+				if a.Tunnel {
+					t = "yes"
+				}
+
+				if a.Name == c.containerName {
+					return text.Colored(t, 2)
+				}
+				return t
+			}(),
 		})
 	}
 
@@ -2,32 +2,61 @@ package boxpkg
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"strings"
 
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/kloudlite/kl/cmd/box/boxpkg/hashctrl"
 	"github.com/kloudlite/kl/domain/envclient"
+	"github.com/kloudlite/kl/domain/fileclient"
 	fn "github.com/kloudlite/kl/pkg/functions"
 	"github.com/kloudlite/kl/pkg/ui/text"
 )
 
 func (c *client) Reload() error {
+	if err := c.rememberProfile(); err != nil {
+		return fn.NewE(err)
+	}
 
 	wpath, err := os.Getwd()
 	if err != nil {
 		return fn.NewE(err)
 	}
 
+	prev, _ := hashctrl.BoxHashFile(wpath)
+
 	if err := hashctrl.SyncBoxHash(c.apic, c.fc, wpath); err != nil {
 		return fn.NewE(err)
 	}
-	return nil
+
+	next, err := hashctrl.BoxHashFile(wpath)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	if prev != nil && prev.KLConfHash == next.KLConfHash {
+		return nil
+	}
+
+	if !envclient.InsideBox() {
+		if cr, err := c.containerAtPath(c.cwd); err != nil || cr.State != "running" {
+			return nil
+		}
+	}
+
+	return c.RunHooks(fileclient.HookOnReload)
 }
 
+// ConfirmBoxRestart applies changes of the box hash file to the box of the
+// workspace. changes of env vars and mounts alone are reloaded into the
+// running box, other changes need the box to be restarted, which is
+// confirmed first as it ends every process of the box
 func (c *client) ConfirmBoxRestart() error {
 	if envclient.InsideBox() {
-		return nil
+		return c.reloadInsideBox()
 	}
 	existingContainers, err := c.cli.ContainerList(context.Background(), container.ListOptions{
 		Filters: filters.NewArgs(
@@ -49,12 +78,19 @@ func (c *client) ConfirmBoxRestart() error {
 		return err
 	}
 
-	cntrHash := existingContainers[0].Labels[KLCONFIG_HASH_KEY]
-
-	if pe.KLConfHash == cntrHash {
+	if pe.KLConfHash == c.appliedKLConfHash(existingContainers[0]) {
 		return nil
 	}
 
+	if rh := existingContainers[0].Labels[KLRESTART_HASH_KEY]; rh != "" && rh == pe.RestartHash {
+		err := c.reloadContainer(existingContainers[0].ID)
+		if err == nil {
+			c.RecordEvent(EventReloaded, "env vars and mounts reloaded into the running box")
+			return nil
+		}
+		fn.Warn(fmt.Sprintf("failed to reload the box, it needs to be restarted: %s", err.Error()))
+	}
+
 	fn.Logf(text.Yellow("[#] Environments may have been updated. to reflect the changes, do you want to restart the container? [Y/n] "))
 	if !fn.Confirm("Y", "Y") {
 		return nil
@@ -67,6 +103,22 @@ func (c *client) ConfirmBoxRestart() error {
 	if err = c.Start(); err != nil {
 		return err
 	}
+	c.RecordEvent(EventRestarted, "box restarted as kl.yml changed")
 
 	return nil
 }
+
+// appliedKLConfHash returns the kl config hash the box cr was last set up or
+// reloaded with. the label of the container is the hash it was created with,
+// which is stale once the box is reloaded, so it is read from the box first
+func (c *client) appliedKLConfHash(cr types.Container) string {
+	if cr.State == "running" {
+		out, err := c.execAsRoot(context.Background(), cr.ID, `cat "$1"`, boxKLConfHashFile)
+		if err == nil {
+			return strings.TrimSpace(out)
+		}
+		fn.Debug("failed to read kl config hash of the box: " + err.Error())
+	}
+
+	return cr.Labels[KLCONFIG_HASH_KEY]
+}
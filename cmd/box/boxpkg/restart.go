@@ -64,5 +64,7 @@ func (c *client) restartBoxContainer() error {
 	if err = c.Start(); err != nil {
 		return err
 	}
+	c.RecordEvent(EventRestarted, "box restarted")
+
 	return nil
 }
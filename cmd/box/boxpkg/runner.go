@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/kloudlite/kl/pkg/functions"
@@ -32,6 +33,21 @@ type Cntr struct {
 	Name   string
 	Labels map[string]string
 	State  ContState
+	IP     string
+	// Tunnel is whether the box holds the tunnel to the cluster
+	Tunnel bool
+}
+
+func containerIP(c types.Container) string {
+	if c.NetworkSettings == nil {
+		return ""
+	}
+
+	if n, ok := c.NetworkSettings.Networks["kloudlite"]; ok && n != nil {
+		return n.IPAddress
+	}
+
+	return ""
 }
 
 var NotFoundErr = functions.Error("container not found")
@@ -68,6 +84,8 @@ func (c *client) listContainer(labels map[string]string) ([]Cntr, error) {
 				Name:   crlist[0].ID,
 				Labels: crlist[0].Labels,
 				State:  ContState(c2.State),
+				IP:     containerIP(c2),
+				Tunnel: holdsTunnel(c2),
 			}
 			defCrs = append(defCrs, defCr)
 			continue
@@ -77,6 +95,8 @@ func (c *client) listContainer(labels map[string]string) ([]Cntr, error) {
 			Name:   c2.Names[0],
 			Labels: c2.Labels,
 			State:  ContState(c2.State),
+			IP:     containerIP(c2),
+			Tunnel: holdsTunnel(c2),
 		}
 
 		if strings.Contains(defCr.Name, "/") {
@@ -0,0 +1,446 @@
+package boxpkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/kloudlite/kl/cmd/box/boxpkg/hashctrl"
+	"github.com/kloudlite/kl/cmd/box/boxpkg/packagectrl"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/spinner"
+)
+
+// SnapshotRepo is the repository box snapshots are committed to, tags are
+// the workspace path hash followed by the snapshot name
+const SnapshotRepo = "localhost/kl/box-snapshot"
+
+const (
+	// snapshotHomeArchive holds the home of the box in the snapshot image, as
+	// the kl-home-cache volume is not part of a commit
+	snapshotHomeArchive = "/var/lib/kl-snapshot/home.tar.gz"
+	// snapshotStash is where files which must not end up in a snapshot are
+	// moved while the box is committed, it is a tmpfs
+	snapshotStash = "/dev/shm/kl-snapshot"
+)
+
+// snapshotHomeExcludes are paths of /home/kl bind mounted from the host
+var snapshotHomeExcludes = []string{"kl/workspace", "kl/.ssh", "kl/.gitconfig"}
+
+// snapshotStashPaths are the vpn keys of this device, and env vars and
+// mounts of the environment, which start.sh writes again on start
+var snapshotStashPaths = []string{"/etc/wireguard", "/tmp/kl-env", "/tmp/kl-env.json", "/tmp/mount.sh"}
+
+var snapshotNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+type Snapshot struct {
+	Name    string
+	Path    string
+	Image   string
+	Created time.Time
+	Size    int64
+	// Active is set when the box of the workspace runs from the snapshot
+	Active bool
+}
+
+func snapshotTag(hashName string, name string) string {
+	hash := strings.TrimPrefix(hashName, "hash-")
+	if len(hash) > 12 {
+		hash = hash[:12]
+	}
+
+	return fmt.Sprintf("%s:%s-%s", SnapshotRepo, hash, name)
+}
+
+func (c *client) snapshotFromImage(is image.Summary) *Snapshot {
+	s := &Snapshot{
+		Name:    is.Labels[SNAPSHOT_NAME_KEY],
+		Path:    is.Labels[SNAPSHOT_PATH_KEY],
+		Created: time.Unix(is.Created, 0),
+		Size:    is.Size,
+	}
+
+	for _, t := range is.RepoTags {
+		if strings.HasPrefix(t, SnapshotRepo+":") {
+			s.Image = t
+			break
+		}
+	}
+	s.Active = s.Image != "" && s.Image == c.env.Snapshot
+
+	return s
+}
+
+// ListSnapshots returns snapshots of the box of the current workspace, or of
+// every workspace when all is set, newest first
+func (c *client) ListSnapshots(all bool) ([]*Snapshot, error) {
+	args := filters.NewArgs(filters.Arg("reference", SnapshotRepo))
+	if !all {
+		hashName, err := hashctrl.BoxHashFileName(c.cwd)
+		if err != nil {
+			return nil, fn.NewE(err)
+		}
+		args.Add("label", fmt.Sprintf("%s=%s", SNAPSHOT_HASH_KEY, hashName))
+	}
+
+	images, err := c.cli.ImageList(c.Context(), image.ListOptions{Filters: args})
+	if err != nil {
+		return nil, fn.NewE(err, "failed to list snapshots")
+	}
+
+	resp := make([]*Snapshot, 0, len(images))
+	for _, is := range images {
+		if s := c.snapshotFromImage(is); s.Image != "" {
+			resp = append(resp, s)
+		}
+	}
+	slices.SortFunc(resp, func(a, b *Snapshot) int { return b.Created.Compare(a.Created) })
+
+	return resp, nil
+}
+
+// findSnapshot looks name up in snapshots of the current workspace, then in
+// snapshots of every workspace by image, so that snapshots handed over by a
+// teammate can be restored
+func (c *client) findSnapshot(name string) (*Snapshot, error) {
+	snapshots, err := c.ListSnapshots(false)
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	for _, s := range snapshots {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+
+	all, err := c.ListSnapshots(true)
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	for _, s := range all {
+		if s.Image == name || strings.TrimPrefix(s.Image, SnapshotRepo+":") == name {
+			return s, nil
+		}
+	}
+
+	return nil, fn.Errorf("snapshot %s not found, list snapshots with kl box snapshot list --all", name)
+}
+
+// execAsRoot runs script with bash as root in the container, and returns
+// its output
+func (c *client) execAsRoot(ctx context.Context, containerID string, script string, args ...string) (string, error) {
+	execResp, err := c.cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		User:         "root",
+		Cmd:          append([]string{"bash", "-c", script, "kl-snapshot"}, args...),
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return "", fn.NewE(err, "failed to create exec")
+	}
+
+	resp, err := c.cli.ContainerExecAttach(ctx, execResp.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return "", fn.NewE(err)
+	}
+	defer resp.Close()
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if _, err := stdcopy.StdCopy(stdout, stderr, resp.Reader); err != nil {
+		return "", fn.NewE(err)
+	}
+
+	exitCode, err := c.getExecExitCode(ctx, execResp.ID)
+	if err != nil {
+		return "", fn.NewE(err)
+	}
+
+	if exitCode != 0 {
+		return "", fn.Errorf("%s", packagectrl.TailLines(stderr.String(), 10))
+	}
+
+	return stdout.String(), nil
+}
+
+// CreateSnapshot commits the running box of the current workspace, with an
+// archive of its home, as snapshot name
+func (c *client) CreateSnapshot(name string, force bool) (*Snapshot, error) {
+	if !snapshotNameRegex.MatchString(name) {
+		return nil, fn.Errorf("snapshot name %q must start with a letter or digit, and only contain letters, digits, '_', '.' and '-'", name)
+	}
+
+	cr, err := c.containerAtPath(c.cwd)
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+	if cr.State != "running" {
+		return nil, fn.Error("box must be running to snapshot it, start it with kl box start")
+	}
+
+	hashName, err := hashctrl.BoxHashFileName(c.cwd)
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	ref := snapshotTag(hashName, name)
+	if ok, err := c.imageExists(ref); err == nil && ok && !force {
+		return nil, fn.Errorf("snapshot %s already exists, use --force to replace it", name)
+	}
+
+	ctx := c.Context()
+
+	restore := spinner.Client.UpdateMessage("archiving home of the box")
+	excludes := make([]string, 0, len(snapshotHomeExcludes))
+	for _, e := range snapshotHomeExcludes {
+		excludes = append(excludes, "--exclude="+e)
+	}
+	if _, err := c.execAsRoot(ctx, cr.ID, `set -o errexit
+archive="$1"; shift
+mkdir -p "$(dirname "$archive")"
+tar -C /home -czpf "$archive" --numeric-owner "$@" kl`, append([]string{snapshotHomeArchive}, excludes...)...); err != nil {
+		restore()
+		return nil, fn.NewE(err, "failed to archive home of the box")
+	}
+	restore()
+
+	// the archive is only needed in the image, it is removed from the box
+	// however committing goes
+	defer c.execAsRoot(context.Background(), cr.ID, `rm -rf "$(dirname "$1")"`, snapshotHomeArchive)
+
+	if err := c.stashSnapshotPaths(ctx, cr.ID); err != nil {
+		c.unstashSnapshotPaths(context.Background(), cr.ID)
+		return nil, fn.NewE(err)
+	}
+
+	restore = spinner.Client.UpdateMessage(fmt.Sprintf("committing box as snapshot %s", name))
+	_, err = c.cli.ContainerCommit(ctx, cr.ID, container.CommitOptions{
+		Reference: ref,
+		Comment:   fmt.Sprintf("kl box snapshot %s of %s", name, c.cwd),
+		Pause:     true,
+		Config: &container.Config{
+			Labels: map[string]string{
+				SNAPSHOT_NAME_KEY: name,
+				SNAPSHOT_PATH_KEY: c.cwd,
+				SNAPSHOT_HASH_KEY: hashName,
+			},
+		},
+	})
+	restore()
+
+	if uerr := c.unstashSnapshotPaths(context.Background(), cr.ID); uerr != nil {
+		fn.Warn(fmt.Sprintf("failed to move files of the box back after committing it, restart the box to write them again: %s", uerr.Error()))
+	}
+
+	if err != nil {
+		return nil, fn.NewE(err, "failed to commit the box")
+	}
+
+	c.RecordEvent(EventSnapshotCreated, fmt.Sprintf("snapshot %s created as %s", name, ref))
+
+	return c.findSnapshot(name)
+}
+
+// stashSnapshotPaths moves snapshotStashPaths out of the container layer,
+// so that they are not committed
+func (c *client) stashSnapshotPaths(ctx context.Context, containerID string) error {
+	_, err := c.execAsRoot(ctx, containerID, `set -o errexit
+stash="$1"; shift
+for p in "$@"; do
+  if [ -e "$p" ]; then
+    mkdir -p "$stash$(dirname "$p")"
+    mv "$p" "$stash$p"
+  fi
+done`, append([]string{snapshotStash}, snapshotStashPaths...)...)
+	if err != nil {
+		return fn.NewE(err, "failed to move files out of the box before committing it")
+	}
+
+	return nil
+}
+
+func (c *client) unstashSnapshotPaths(ctx context.Context, containerID string) error {
+	_, err := c.execAsRoot(ctx, containerID, `set -o errexit
+stash="$1"; shift
+for p in "$@"; do
+  if [ -e "$stash$p" ]; then
+    rm -rf "$p"
+    mv "$stash$p" "$p"
+  fi
+done
+rm -rf "$stash"`, append([]string{snapshotStash}, snapshotStashPaths...)...)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	return nil
+}
+
+// RestoreSnapshot restores the home of the box from snapshot name, unless
+// skipHome is set, and restarts the box from the snapshot
+func (c *client) RestoreSnapshot(name string, skipHome bool) error {
+	s, err := c.findSnapshot(name)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	if err := c.Stop(); err != nil {
+		return fn.NewE(err)
+	}
+
+	if !skipHome {
+		if err := c.restoreSnapshotHome(s); err != nil {
+			return fn.NewE(err)
+		}
+	}
+
+	c.env.Snapshot = s.Image
+	if err := c.fc.SelectEnv(*c.env); err != nil {
+		return fn.NewE(err)
+	}
+	c.RecordEvent(EventSnapshotRestored, fmt.Sprintf("snapshot %s of %s restored from %s", s.Name, s.Path, s.Image))
+
+	return c.Start()
+}
+
+// HomeCacheUsers names containers other than the box of the workspace which
+// mount the kl-home-cache volume, stopped ones included, they share the home
+// RestoreSnapshot replaces
+func (c *client) HomeCacheUsers() ([]string, error) {
+	crs, err := c.cli.ContainerList(c.Context(), container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("volume", "kl-home-cache")),
+	})
+	if err != nil {
+		return nil, fn.NewE(err, "failed to list containers")
+	}
+
+	resp := make([]string, 0, len(crs))
+	for _, cr := range crs {
+		if cr.Labels[CONT_WORKSPACE_MARK_KEY] == "true" && cr.Labels[CONT_PATH_KEY] == c.cwd {
+			continue
+		}
+
+		d := describeContainer(cr)
+		if cr.State != "running" {
+			d += " (stopped)"
+		}
+		resp = append(resp, d)
+	}
+
+	return resp, nil
+}
+
+// restoreSnapshotHome replaces the home in the kl-home-cache volume with the
+// home archive of s, with a container of the snapshot image. the archive is
+// extracted next to the home, which is only swapped with it once extracted,
+// so that files created after the snapshot are not kept and the home is
+// kept when extracting fails. the volume is shared by every box, their home
+// is replaced too
+const restoreHomeScript = `set -o errexit
+tmp=$(mktemp -d /home/.kl-restore.XXXXXX)
+trap 'rm -rf "$tmp"' EXIT
+tar -C "$tmp" -xzpf "$1" --numeric-owner
+if [ ! -d "$tmp/kl" ]; then
+  echo "home archive $1 holds no home" >&2
+  exit 1
+fi
+if [ -e /home/kl ]; then
+  mv /home/kl "$tmp/kl.old"
+fi
+if ! mv "$tmp/kl" /home/kl; then
+  mv "$tmp/kl.old" /home/kl
+  exit 1
+fi`
+
+func (c *client) restoreSnapshotHome(s *Snapshot) error {
+	defer spinner.Client.UpdateMessage("restoring home of the box")()
+
+	if err := c.ensureCacheExist(); err != nil {
+		return fn.NewE(err)
+	}
+
+	ctx := c.Context()
+	hc := &container.HostConfig{
+		NetworkMode: "none",
+		Mounts: []mount.Mount{
+			{Type: mount.TypeVolume, Source: "kl-home-cache", Target: "/home"},
+		},
+	}
+	c.runtime.ConfigureHost(hc)
+
+	// labels of the box the snapshot was committed from are inherited, they
+	// are overridden so that this container is not taken for a box
+	resp, err := c.cli.ContainerCreate(ctx, &container.Config{
+		User:       "root",
+		Image:      s.Image,
+		Entrypoint: []string{"bash", "-c", restoreHomeScript, "kl-snapshot", snapshotHomeArchive},
+		Labels: map[string]string{
+			CONT_MARK_KEY:           "true",
+			CONT_WORKSPACE_MARK_KEY: "false",
+			CONT_PATH_KEY:           c.cwd,
+		},
+	}, hc, nil, nil, "")
+	if err != nil {
+		return fn.NewE(err, "failed to create container to restore home")
+	}
+	defer c.cli.ContainerRemove(context.Background(), resp.ID, container.RemoveOptions{Force: true})
+
+	waitCh, errCh := c.cli.ContainerWait(ctx, resp.ID, container.WaitConditionNextExit)
+	if err := c.cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		return fn.NewE(err, "failed to start container to restore home")
+	}
+
+	select {
+	case err := <-errCh:
+		return fn.NewE(err)
+	case w := <-waitCh:
+		if w.StatusCode == 0 {
+			return nil
+		}
+
+		out := new(bytes.Buffer)
+		if rc, err := c.cli.ContainerLogs(context.Background(), resp.ID, container.LogsOptions{ShowStderr: true, ShowStdout: true}); err == nil {
+			stdcopy.StdCopy(out, out, rc)
+			rc.Close()
+		}
+		return fn.Errorf("failed to restore home of snapshot %s: %s", s.Name, packagectrl.TailLines(out.String(), 10))
+	}
+}
+
+// RemoveSnapshot removes snapshot name, the box stops running from it when
+// it was restored from it
+func (c *client) RemoveSnapshot(name string) error {
+	s, err := c.findSnapshot(name)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	if _, err := c.cli.ImageRemove(c.Context(), s.Image, image.RemoveOptions{PruneChildren: true}); err != nil {
+		if errdefs.IsConflict(err) {
+			return fn.Errorf("snapshot %s is used by a box, stop it with kl box stop before removing the snapshot", s.Name)
+		}
+		return fn.NewE(err, fmt.Sprintf("failed to remove snapshot %s", s.Name))
+	}
+
+	if s.Active {
+		c.env.Snapshot = ""
+		if err := c.fc.SelectEnv(*c.env); err != nil {
+			return fn.NewE(err)
+		}
+	}
+	c.RecordEvent(EventSnapshotRemoved, fmt.Sprintf("snapshot %s removed", s.Name))
+
+	return nil
+}
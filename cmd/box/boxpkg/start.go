@@ -11,7 +11,6 @@ import (
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
-	"github.com/kloudlite/kl/constants"
 	"github.com/kloudlite/kl/domain/fileclient"
 
 	"github.com/kloudlite/kl/cmd/box/boxpkg/hashctrl"
@@ -30,7 +29,12 @@ func (c *client) Start() error {
 		return fn.NewE(err)
 	}
 
-	if err := c.ensureImage(constants.GetBoxImageName()); err != nil {
+	if err := c.rememberProfile(); err != nil {
+		return fn.NewE(err)
+	}
+
+	image, err := c.ensureBoxImage()
+	if err != nil {
 		return fn.NewE(err)
 	}
 
@@ -44,15 +48,18 @@ func (c *client) Start() error {
 			return c.Start()
 		}
 	} else {
-		klconfHash, err := hashctrl.GenerateKLConfigHash(c.klfile)
+		klconfHash, err := hashctrl.GenerateKLConfigHash(c.klfile, c.cwd)
 		if err != nil {
 			return fn.NewE(err)
 		}
 		if klconfHash != boxHash.KLConfHash {
+			c.RecordEvent(EventHashChanged, "kl.yml changed, box hash synced")
 			err = hashctrl.SyncBoxHash(c.apic, c.fc, c.cwd)
 			if err != nil {
 				return functions.NewE(err)
 			}
+			// read again below, the container is labeled with the synced hashes
+			boxHash = nil
 		}
 	}
 	if boxHash == nil {
@@ -98,11 +105,23 @@ func (c *client) Start() error {
 
 	}
 
-	_, err = c.startContainer(boxHash.KLConfHash)
+	_, hooks, err := c.startContainer(image, boxHash)
 	if err != nil {
 		return fn.NewE(err)
 	}
 
+	for _, h := range hooks {
+		if err := c.RunHooks(h); err != nil {
+			return fn.NewE(err)
+		}
+	}
+
+	// the box may have a new address, proxies pointing to the old one are
+	// recreated
+	if err := c.SyncProxy(ProxyConfig{TargetContainerPath: c.cwd}); err != nil {
+		fn.Warn(fmt.Sprintf("failed to expose ports: %s", err.Error()))
+	}
+
 	if c.env.SSHPort == 0 {
 		existingContainers, err := c.cli.ContainerList(context.Background(), container.ListOptions{
 			Filters: filters.NewArgs(
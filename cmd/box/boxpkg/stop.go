@@ -1,5 +1,22 @@
 package boxpkg
 
+import (
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+)
+
 func (c *client) Stop() error {
-	return c.stopContainer(c.cwd)
+	cr, err := c.containerAtPath(c.cwd)
+	if err == nil && cr.State == "running" {
+		if err := c.RunHooks(fileclient.HookPreStop); err != nil {
+			return fn.NewE(err, "box is not stopped")
+		}
+	}
+
+	if err := c.stopContainer(c.cwd); err != nil {
+		return fn.NewE(err)
+	}
+	c.RecordEvent(EventStopped, "box stopped")
+
+	return nil
 }
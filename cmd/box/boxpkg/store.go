@@ -0,0 +1,149 @@
+package boxpkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/kloudlite/kl/cmd/box/boxpkg/hashctrl"
+	"github.com/kloudlite/kl/cmd/box/boxpkg/packagectrl"
+	"github.com/kloudlite/kl/constants"
+	"github.com/kloudlite/kl/domain/envclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/spinner"
+)
+
+// StoreRunner returns a runner of scripts against the kl-nix-store volume
+// shared by boxes and a func releasing it. outside of a box scripts run in a
+// container of the box image, which is removed when it is released
+func (c *client) StoreRunner() (packagectrl.StoreRunner, func(), error) {
+	if envclient.InsideBox() {
+		return packagectrl.LocalStore, func() {}, nil
+	}
+
+	containerID, err := c.startStoreContainer()
+	if err != nil {
+		return nil, nil, fn.NewE(err)
+	}
+
+	release := func() {
+		c.cli.ContainerRemove(context.Background(), containerID, container.RemoveOptions{Force: true})
+	}
+
+	return func(ctx context.Context, script string, args ...string) (string, error) {
+		return c.runInStoreContainer(ctx, containerID, script, args)
+	}, release, nil
+}
+
+// PrefetchPackages realises installables keyed by name@version into the
+// kl-nix-store volume shared by boxes, so that boxes install them without
+// fetching
+func (c *client) PrefetchPackages(installables map[string]string, jobs int) error {
+	if len(installables) == 0 {
+		return nil
+	}
+
+	run, release, err := c.StoreRunner()
+	if err != nil {
+		return fn.NewE(err)
+	}
+	defer release()
+
+	return packagectrl.Prefetch(c.Context(), packagectrl.StoreFetcher(run), installables, jobs)
+}
+
+// prefetchBoxPackages prefetches packages of the box hash of the workspace
+// before the box starts, failures are left to the box to report as it
+// installs the packages itself
+func (c *client) prefetchBoxPackages() {
+	boxHash, err := hashctrl.BoxHashFile(c.cwd)
+	if err != nil {
+		return
+	}
+
+	if err := c.PrefetchPackages(boxHash.PackageHashes, packagectrl.DefaultPrefetchJobs); err != nil {
+		fn.Warn(fmt.Sprintf("failed to prefetch packages, the box will fetch them as it starts: %s", err.Error()))
+	}
+}
+
+func (c *client) startStoreContainer() (string, error) {
+	defer spinner.Client.UpdateMessage("starting nix store container")()
+
+	if err := c.ensureImage(constants.GetBoxImageName()); err != nil {
+		return "", fn.NewE(err)
+	}
+
+	if err := c.ensureCacheExist(); err != nil {
+		return "", fn.NewE(err)
+	}
+
+	hc := &container.HostConfig{
+		AutoRemove: true,
+		Mounts: []mount.Mount{
+			{Type: mount.TypeVolume, Source: "kl-nix-store", Target: "/nix"},
+			{Type: mount.TypeVolume, Source: "kl-home-cache", Target: "/home"},
+		},
+		// local package sources are built from the workspace
+		Binds: []string{fmt.Sprintf("%s:%s:ro,z", c.cwd, packagectrl.BoxWorkspacePath)},
+	}
+	c.runtime.ConfigureHost(hc)
+
+	resp, err := c.cli.ContainerCreate(context.Background(), &container.Config{
+		User:       fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+		Image:      constants.GetBoxImageName(),
+		Entrypoint: []string{"sleep", "infinity"},
+		Labels: map[string]string{
+			CONT_MARK_KEY:       "true",
+			CONT_STORE_MARK_KEY: "true",
+			CONT_PATH_KEY:       c.cwd,
+		},
+	}, hc, nil, nil, "")
+	if err != nil {
+		return "", fn.NewE(err, "failed to create nix store container")
+	}
+
+	if err := c.cli.ContainerStart(context.Background(), resp.ID, container.StartOptions{}); err != nil {
+		c.cli.ContainerRemove(context.Background(), resp.ID, container.RemoveOptions{Force: true})
+		return "", fn.NewE(err, "failed to start nix store container")
+	}
+
+	return resp.ID, nil
+}
+
+func (c *client) runInStoreContainer(ctx context.Context, containerID string, script string, args []string) (string, error) {
+	execResp, err := c.cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          append([]string{"bash", "-c", script, "kl-store"}, args...),
+		WorkingDir:   packagectrl.BoxWorkspacePath,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return "", fn.NewE(err, "failed to create exec")
+	}
+
+	resp, err := c.cli.ContainerExecAttach(ctx, execResp.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return "", fn.NewE(err)
+	}
+	defer resp.Close()
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if _, err := stdcopy.StdCopy(stdout, stderr, resp.Reader); err != nil {
+		return "", fn.NewE(err)
+	}
+
+	exitCode, err := c.getExecExitCode(ctx, execResp.ID)
+	if err != nil {
+		return "", fn.NewE(err)
+	}
+
+	if exitCode != 0 {
+		return "", fn.Errorf("%s", packagectrl.TailLines(stderr.String(), 10))
+	}
+
+	return stdout.String(), nil
+}
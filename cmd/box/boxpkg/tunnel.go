@@ -0,0 +1,236 @@
+package boxpkg
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/kloudlite/kl/constants"
+	"github.com/kloudlite/kl/domain/envclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/spinner"
+)
+
+// the workspace peer of the local cluster is pinned to
+// constants.InterceptWorkspaceServiceIp and every box of the device shares
+// its wireguard keys, so only the box holding that address is connected to
+// the cluster and receives intercepted traffic, one box at a time. every
+// other box gets an address from docker and runs without the tunnel, the
+// address is moved between boxes with kl box intercept
+
+// tunnelScript brings the tunnels of the box up or down, it is run as root
+const tunnelScript = "/tunnel.sh"
+
+// holdsTunnel reports whether cr holds constants.InterceptWorkspaceServiceIp,
+// stopped containers keep the address they were given in their ipam config
+func holdsTunnel(cr types.Container) bool {
+	if cr.NetworkSettings == nil {
+		return false
+	}
+
+	n, ok := cr.NetworkSettings.Networks["kloudlite"]
+	if !ok || n == nil {
+		return false
+	}
+
+	if n.IPAMConfig != nil && n.IPAMConfig.IPv4Address == constants.InterceptWorkspaceServiceIp {
+		return true
+	}
+
+	return n.IPAddress == constants.InterceptWorkspaceServiceIp
+}
+
+func containerName(cr types.Container) string {
+	if len(cr.Names) == 0 {
+		return cr.ID
+	}
+
+	return strings.TrimPrefix(cr.Names[0], "/")
+}
+
+// describeContainer is how cr is named in messages, boxes by their path
+func describeContainer(cr types.Container) string {
+	if p, ok := cr.Labels[CONT_PATH_KEY]; ok && cr.Labels[CONT_WORKSPACE_MARK_KEY] == "true" {
+		return fmt.Sprintf("the box of %s", p)
+	}
+
+	return fmt.Sprintf("container %s", containerName(cr))
+}
+
+// tunnelHolder returns the container holding the tunnel other than the box
+// of path, nil when the tunnel can be given to the box of path. containers
+// which are not boxes, such as devcontainers, are returned as well
+func (c *client) tunnelHolder(path string) (*types.Container, error) {
+	existingContainers, err := c.cli.ContainerList(context.Background(), container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("network", "kloudlite")),
+	})
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	for _, d := range existingContainers {
+		if d.Labels[CONT_WORKSPACE_MARK_KEY] == "true" && d.Labels[CONT_PATH_KEY] == path {
+			continue
+		}
+
+		if holdsTunnel(d) {
+			return &d, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// connectKloudlite connects the container with id to the kloudlite network
+// again, with ip or an address from docker when ip is empty
+func (c *client) connectKloudlite(id string, ip string) error {
+	ctx := context.Background()
+	if err := c.cli.NetworkDisconnect(ctx, "kloudlite", id, true); err != nil {
+		return fn.NewE(err, "failed to disconnect from kloudlite network")
+	}
+
+	es := &network.EndpointSettings{}
+	if ip != "" {
+		es.IPAMConfig = &network.EndpointIPAMConfig{IPv4Address: ip}
+	}
+
+	if err := c.cli.NetworkConnect(ctx, "kloudlite", id, es); err != nil {
+		return fn.NewE(err, "failed to connect to kloudlite network")
+	}
+
+	return nil
+}
+
+// retargetProxies points proxies of the box of path to its current address
+func (c *client) retargetProxies(path string) error {
+	cr, err := c.containerAtPath(path)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	ip := containerIP(*cr)
+	if ip == "" {
+		return nil
+	}
+
+	proxies, err := c.listProxies(path)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	for _, p := range proxies {
+		if p.Labels[PROXY_TARGET_KEY] == ip || isLegacyProxy(p) {
+			continue
+		}
+
+		if err := c.removeProxy(p); err != nil {
+			return fn.NewE(err)
+		}
+
+		for _, pm := range proxyPorts(p) {
+			if err := c.createProxy(path, ip, pm, p.Labels[PROXY_WATCH_KEY] == "true"); err != nil {
+				return fn.NewE(err, fmt.Sprintf("failed to expose port %s", pm))
+			}
+		}
+	}
+
+	return nil
+}
+
+// releaseTunnel brings the tunnels of box cr down and gives it an address
+// from docker, so that another box can hold the tunnel
+func (c *client) releaseTunnel(cr types.Container) error {
+	defer spinner.Client.UpdateMessage(fmt.Sprintf("moving the tunnel off %s", describeContainer(cr)))()
+
+	running := cr.State == "running"
+	if running {
+		if _, err := c.execAsRoot(context.Background(), cr.ID, tunnelScript+` down`); err != nil {
+			fn.Warnf("failed to bring the tunnel of %s down: %s", describeContainer(cr), err.Error())
+		}
+	}
+
+	if err := c.connectKloudlite(cr.ID, ""); err != nil {
+		return fn.NewE(err)
+	}
+
+	if running {
+		if err := c.retargetProxies(cr.Labels[CONT_PATH_KEY]); err != nil {
+			return fn.NewE(err)
+		}
+	}
+
+	return nil
+}
+
+// MoveTunnel connects the running box of path to the cluster of the team,
+// and routes intercepted traffic to it. the tunnel is moved off the box
+// holding it, which keeps running without it
+func (c *client) MoveTunnel(path string) error {
+	if path == "" {
+		p, err := envclient.GetWorkspacePath()
+		if err != nil {
+			return fn.NewE(err)
+		}
+		path = p
+	}
+
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	target, err := c.containerAtPath(path)
+	if err != nil {
+		return fn.NewE(err)
+	}
+	if target.State != "running" {
+		return fn.Errorf("box of %s is not running, start it with kl box start", path)
+	}
+
+	holder, err := c.tunnelHolder(path)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	if holder != nil {
+		if holder.Labels[CONT_WORKSPACE_MARK_KEY] != "true" {
+			return fn.Errorf("the tunnel is held by %s, which is not a box. stop it to move the tunnel to the box of %s", describeContainer(*holder), path)
+		}
+
+		if err := c.releaseTunnel(*holder); err != nil {
+			return fn.NewE(err)
+		}
+	}
+
+	if !holdsTunnel(*target) {
+		defer spinner.Client.UpdateMessage(fmt.Sprintf("connecting the box of %s to the cluster", path))()
+
+		if err := c.connectKloudlite(target.ID, constants.InterceptWorkspaceServiceIp); err != nil {
+			return fn.NewE(err)
+		}
+
+		if _, err := c.execAsRoot(context.Background(), target.ID, tunnelScript+` up`); err != nil {
+			return fn.NewE(err, fmt.Sprintf("failed to bring the tunnel of the box of %s up", path))
+		}
+
+		if err := c.retargetProxies(path); err != nil {
+			return fn.NewE(err)
+		}
+	}
+
+	if err := c.k3s.SetInterceptTarget(constants.InterceptWorkspaceServiceIp); err != nil {
+		return fn.NewE(err)
+	}
+
+	if holder != nil {
+		recordEvent(path, EventTunnelMoved, fmt.Sprintf("tunnel moved from %s", describeContainer(*holder)))
+	}
+
+	return nil
+}
@@ -13,6 +13,7 @@ import (
 	"path"
 	"runtime"
 	"strconv"
+	"sync/atomic"
 	"text/template"
 	"time"
 
@@ -26,11 +27,11 @@ import (
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/volume"
-	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/go-connections/nat"
 	"github.com/kloudlite/kl/cmd/box/boxpkg/hashctrl"
 	"github.com/kloudlite/kl/constants"
 	"github.com/kloudlite/kl/domain/fileclient"
+	containerruntime "github.com/kloudlite/kl/pkg/container-runtime"
 	fn "github.com/kloudlite/kl/pkg/functions"
 
 	"github.com/kloudlite/kl/pkg/sshclient"
@@ -127,14 +128,7 @@ func (c *client) ensureImage(i string) error {
 		return nil
 	}
 
-	out, err := c.cli.ImagePull(context.Background(), i, image.PullOptions{})
-	if err != nil {
-		return fn.NewE(err, fmt.Sprintf("failed to pull image %s", i))
-	}
-	defer out.Close()
-
-	jsonmessage.DisplayJSONMessagesStream(out, os.Stdout, os.Stdout.Fd(), true, nil)
-	return nil
+	return containerruntime.PullImage(c.Context(), c.cli, i)
 }
 
 func (c *client) restartContainer(path string) error {
@@ -160,6 +154,9 @@ func (c *client) restartContainer(path string) error {
 		return fn.NewE(err)
 	}
 
+	// recorded before, the restart kills kl when it runs inside the box
+	c.RecordEvent(EventRestarted, "box restarted")
+
 	timeOut := 0
 	if err := c.cli.ContainerRestart(context.Background(), existingContainers[0].ID, container.StopOptions{
 		Signal:  "SIGKILL",
@@ -171,19 +168,21 @@ func (c *client) restartContainer(path string) error {
 	return nil
 }
 
-func (c *client) startContainer(klconfHash string) (string, error) {
+// startContainer starts the box of the workspace, and returns hooks of the
+// lifecycle steps it went through, none when the box was already running
+func (c *client) startContainer(image string, boxHash *hashctrl.PersistedEnv) (string, []fileclient.HookName, error) {
 	defer spinner.Client.UpdateMessage("starting container please wait")()
-	err := c.stopOtherContainers()
+	err := c.stopOtherTeamContainers()
 	if err != nil {
-		return "", fn.NewE(err)
+		return "", nil, fn.NewE(err)
 	}
 
 	if err := c.ensurePublicKey(); err != nil {
-		return "", fn.NewE(err)
+		return "", nil, fn.NewE(err)
 	}
 
 	if err := c.ensureCacheExist(); err != nil {
-		return "", fn.NewE(err)
+		return "", nil, fn.NewE(err)
 	}
 
 	existingContainers, err := c.cli.ContainerList(context.Background(), container.ListOptions{
@@ -196,136 +195,142 @@ func (c *client) startContainer(klconfHash string) (string, error) {
 	})
 
 	if err != nil {
-		return "", fn.Error("failed to list containers")
+		return "", nil, fn.Error("failed to list containers")
+	}
+
+	if len(existingContainers) == 0 || existingContainers[0].State != "running" {
+		c.prefetchBoxPackages()
 	}
 
 	if len(existingContainers) > 0 {
 		if existingContainers[0].State != "running" {
 			if err := c.cli.ContainerStart(context.Background(), existingContainers[0].ID, container.StartOptions{}); err != nil {
-				return "", fn.NewE(err)
+				return "", nil, fn.NewE(err)
 			}
 
 			sshPortStr, ok := existingContainers[0].Labels[SSH_PORT_KEY]
 			if !ok {
-				return "", fn.Error("failed to get ssh port")
+				return "", nil, fn.Error("failed to get ssh port")
 			}
 
 			sshPort, err := strconv.Atoi(sshPortStr)
 			if err != nil {
-				return "", fn.NewE(err)
+				return "", nil, fn.NewE(err)
 			}
 
 			if err := c.waitForSshReady(sshPort, existingContainers[0].ID); err != nil {
-				return "", fn.NewE(err)
+				return "", nil, fn.NewE(err)
 			}
+			c.RecordEvent(EventStarted, fmt.Sprintf("box started with ssh port %d", sshPort))
+
+			return existingContainers[0].ID, []fileclient.HookName{fileclient.HookPostStart}, nil
 		}
 
-		return existingContainers[0].ID, nil
+		return existingContainers[0].ID, nil, nil
 	}
 
 	sshPort, err := c.getFreePort()
 	if err != nil {
-		return "", fn.Error("failed to get free port")
+		return "", nil, fn.Error("failed to get free port")
 	}
 
 	vmounts, err := c.generateMounts()
 	if err != nil {
-		return "", fn.NewE(err)
+		return "", nil, fn.NewE(err)
 	}
 
 	boxhashFileName, err := hashctrl.BoxHashFileName(c.cwd)
 	if err != nil {
-		return "", fn.NewE(err)
+		return "", nil, fn.NewE(err)
 	}
 
-	hostName, err := os.Hostname()
+	holder, err := c.tunnelHolder(c.cwd)
 	if err != nil {
-		return "", fn.NewE(err)
+		return "", nil, fn.NewE(err)
 	}
 
-	currentSystemConfig, err := fileclient.GetExtraData()
+	// the tunnel of a box of another team is dead, as only the cluster of
+	// the current team runs, it is moved to this box
+	if holder != nil && holder.Labels[CONT_WORKSPACE_MARK_KEY] == "true" && holder.Labels[CONT_TEAM_KEY] != c.klfile.TeamName {
+		if err := c.releaseTunnel(*holder); err != nil {
+			return "", nil, fn.NewE(err)
+		}
+		holder = nil
+	}
+
+	staticIP := holder == nil
+	if !staticIP {
+		fn.Warnf("%s holds the tunnel to the cluster, and only one box can. this box starts without access to the cluster and can't receive intercepts, move the tunnel to it with kl box intercept once it runs", describeContainer(*holder))
+	}
+
+	boxEnv, err := c.boxEnv(boxhashFileName, sshPort)
 	if err != nil {
-		return "", fn.NewE(err)
+		return "", nil, fn.NewE(err)
 	}
-	clusterConfig, err := c.fc.GetClusterConfig(currentSystemConfig.SelectedTeam)
 
-	resp, err := c.cli.ContainerCreate(context.Background(), &container.Config{
+	endpointSettings := &network.EndpointSettings{}
+	if staticIP {
+		endpointSettings.IPAMConfig = &network.EndpointIPAMConfig{
+			IPv4Address: constants.InterceptWorkspaceServiceIp,
+		}
+	}
+
+	cfg := &container.Config{
 		User:  fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
-		Image: constants.GetBoxImageName(),
+		Image: image,
 		Labels: map[string]string{
 			CONT_MARK_KEY:           "true",
 			CONT_WORKSPACE_MARK_KEY: "true",
 			CONT_PATH_KEY:           c.cwd,
 			SSH_PORT_KEY:            fmt.Sprintf("%d", sshPort),
-			KLCONFIG_HASH_KEY:       klconfHash,
-		},
-		Env: []string{
-			fmt.Sprintf("KL_HASH_FILE=/.cache/kl/box-hash/%s", boxhashFileName),
-			fmt.Sprintf("SSH_PORT=%d", sshPort),
-			fmt.Sprintf("KL_WORKSPACE=%s", c.cwd),
-			"KLCONFIG_PATH=/home/kl/workspace/kl.yml",
-			fmt.Sprintf("KL_DNS=%s", constants.KLDNS),
-			fmt.Sprintf("KL_BASE_URL=%s", constants.BaseURL),
-			fmt.Sprintf("KL_HOST_USER=%s", hostName),
-			fmt.Sprintf("CLUSTER_GATEWAY_IP=%s", clusterConfig.GatewayIP),
-			fmt.Sprintf("CLUSTER_IP_RANGE=%s", clusterConfig.ClusterCIDR),
-			fmt.Sprintf("KL_TEAM_NAME=%s", currentSystemConfig.SelectedTeam),
+			KLCONFIG_HASH_KEY:       boxHash.KLConfHash,
+			KLRESTART_HASH_KEY:      boxHash.RestartHash,
+			CONT_TEAM_KEY:           c.klfile.TeamName,
 		},
+		Env:          boxEnv,
 		Hostname:     "box",
 		ExposedPorts: nat.PortSet{nat.Port(fmt.Sprintf("%d/tcp", sshPort)): {}},
-	}, &container.HostConfig{
-		ExtraHosts: []string{
-			fmt.Sprintf("k3s-cluster.local:%s", constants.K3sServerIp),
-		},
-		Privileged:  true,
-		NetworkMode: "kloudlite",
-		PortBindings: nat.PortMap{
-			nat.Port(fmt.Sprintf("%d/tcp", sshPort)): []nat.PortBinding{
-				{
-					HostPort: fmt.Sprintf("%d", sshPort),
-				},
-			},
-		},
-		Binds: func() []string {
-			binds := make([]string, 0, len(vmounts))
-			for _, m := range vmounts {
-				binds = append(binds, fmt.Sprintf("%s:%s:z", m.Source, m.Target))
-			}
-			binds = append(binds, fmt.Sprintf("%s:/home/kl/workspace:z", c.cwd))
-			return binds
-		}(),
-	}, &network.NetworkingConfig{
+	}
+
+	if image != constants.GetBoxImageName() {
+		if cfg.Entrypoint, cfg.Cmd, err = c.boxEntrypoint(); err != nil {
+			return "", nil, fn.NewE(err)
+		}
+	}
+
+	resp, err := c.cli.ContainerCreate(context.Background(), cfg, c.boxHostConfig(sshPort, vmounts), &network.NetworkingConfig{
 		EndpointsConfig: map[string]*network.EndpointSettings{
-			"kloudlite": {
-				IPAMConfig: &network.EndpointIPAMConfig{
-					IPv4Address: constants.InterceptWorkspaceServiceIp,
-				},
-			},
+			"kloudlite": endpointSettings,
 		},
 	}, nil, fmt.Sprintf("kl-%s", boxhashFileName[len(boxhashFileName)-8:]))
 	if err != nil {
-		return "", fn.NewE(err, "failed to create container")
+		return "", nil, fn.NewE(err, "failed to create container")
 	}
 
 	if err := c.cli.ContainerStart(context.Background(), resp.ID, container.StartOptions{}); err != nil {
-		return "", fn.NewE(err, "failed to start container")
+		return "", nil, fn.NewE(err, "failed to start container")
 	}
 
 	if err := c.waitForSshReady(sshPort, resp.ID); err != nil {
-		return "", fn.NewE(err)
+		return "", nil, fn.NewE(err)
 	}
+	c.RecordEvent(EventCreated, fmt.Sprintf("box created from image %s with ssh port %d", image, sshPort))
 
-	return resp.ID, nil
+	return resp.ID, []fileclient.HookName{fileclient.HookOnCreate, fileclient.HookPostStart}, nil
 }
 
-func (c *client) stopOtherContainers() error {
-	defer spinner.Client.UpdateMessage("stopping other containers")()
+// stopOtherTeamContainers removes the stopped box of the workspace when it
+// was created for another team, so that it is created again for the team
+// of kl.yml. boxes of other workspaces keep running, see releaseTunnel
+func (c *client) stopOtherTeamContainers() error {
+	defer spinner.Client.UpdateMessage("checking other workspaces")()
 
 	existingContainers, err := c.cli.ContainerList(context.Background(), container.ListOptions{
 		All: true,
 		Filters: filters.NewArgs(
 			dockerLabelFilter(CONT_MARK_KEY, "true"),
 			dockerLabelFilter(CONT_WORKSPACE_MARK_KEY, "true"),
+			dockerLabelFilter(CONT_PATH_KEY, c.cwd),
 		),
 	})
 	if err != nil {
@@ -333,22 +338,10 @@ func (c *client) stopOtherContainers() error {
 	}
 
 	for _, d := range existingContainers {
-		if d.Labels[CONT_PATH_KEY] != c.cwd {
-			spinner.Client.Stop()
-			fn.Logf(text.Yellow(fmt.Sprintf("[#] another workspace is active and running at %s. this action will stop that workspace and terminate all the processes running in the that container. do you want to proceed? [Y/n]", d.Labels[CONT_PATH_KEY])))
-			if !fn.Confirm("y", "y") {
-				return fn.NewE(fn.NewE(UserCanceled))
-			}
-
+		if d.State != "running" {
 			if err := c.stopContainer(d.Labels[CONT_PATH_KEY]); err != nil {
 				return fn.NewE(err)
 			}
-		} else {
-			if d.State != "running" {
-				if err := c.stopContainer(d.Labels[CONT_PATH_KEY]); err != nil {
-					return fn.NewE(err)
-				}
-			}
 		}
 	}
 
@@ -371,7 +364,7 @@ func (c *client) stopContainer(path string) error {
 	}
 
 	for _, c2 := range existingContainers {
-		if c2.Labels["kl-team"] == c.klfile.TeamName {
+		if c2.Labels[CONT_TEAM_KEY] == c.klfile.TeamName {
 			continue
 		}
 		timeOut := 0
@@ -403,18 +396,25 @@ func (c *client) getFreePort() (int, error) {
 	if err != nil {
 		return 0, fn.NewE(err)
 	}
+	// ports of other workspaces are reserved even when their boxes are stopped
+	used := map[int]bool{}
+	for pth, v := range data.SelectedEnvs {
+		if v != nil && pth != c.cwd {
+			used[v.SSHPort] = true
+		}
+	}
+
 	for {
 		port := rand.Intn(65535-1024) + 1025
+		if used[port] {
+			continue
+		}
+
 		addr := fmt.Sprintf(":%d", port)
 		listener, err := net.Listen("tcp", addr)
 		if err == nil {
 			listener.Close()
 			resp = port
-			for _, v := range data.SelectedEnvs {
-				if v.SSHPort == resp {
-					continue
-				}
-			}
 			c.env.SSHPort = resp
 			break
 		}
@@ -422,6 +422,69 @@ func (c *client) getFreePort() (int, error) {
 	return resp, nil
 }
 
+// boxEnv is env of the box of c.cwd
+func (c *client) boxEnv(boxhashFileName string, sshPort int) ([]string, error) {
+	hostName, err := os.Hostname()
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	currentSystemConfig, err := fileclient.GetExtraData()
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+	clusterConfig, err := c.fc.GetClusterConfig(currentSystemConfig.SelectedTeam)
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	return []string{
+		"IN_DEV_BOX=true",
+		fmt.Sprintf("KL_HASH_FILE=/.cache/kl/box-hash/%s", boxhashFileName),
+		fmt.Sprintf("SSH_PORT=%d", sshPort),
+		fmt.Sprintf("KL_WORKSPACE=%s", c.cwd),
+		"KLCONFIG_PATH=/home/kl/workspace/kl.yml",
+		fmt.Sprintf("KL_DNS=%s", constants.KLDNS),
+		fmt.Sprintf("KL_BASE_URL=%s", constants.BaseURL),
+		fmt.Sprintf("KL_HOST_USER=%s", hostName),
+		fmt.Sprintf("CLUSTER_GATEWAY_IP=%s", clusterConfig.GatewayIP),
+		fmt.Sprintf("CLUSTER_IP_RANGE=%s", clusterConfig.ClusterCIDR),
+		fmt.Sprintf("KL_TEAM_NAME=%s", currentSystemConfig.SelectedTeam),
+		fmt.Sprintf("KL_TUNNEL_IP=%s", constants.InterceptWorkspaceServiceIp),
+		containerruntime.BoxEnv(c.runtime),
+	}, nil
+}
+
+// boxHostConfig is host config of the box of c.cwd, with settings of the
+// container runtime applied
+func (c *client) boxHostConfig(sshPort int, vmounts []mount.Mount) *container.HostConfig {
+	hc := &container.HostConfig{
+		ExtraHosts: []string{
+			fmt.Sprintf("k3s-cluster.local:%s", constants.K3sServerIp),
+		},
+		Privileged:  true,
+		NetworkMode: "kloudlite",
+		PortBindings: nat.PortMap{
+			nat.Port(fmt.Sprintf("%d/tcp", sshPort)): []nat.PortBinding{
+				{
+					HostPort: fmt.Sprintf("%d", sshPort),
+				},
+			},
+		},
+		Binds: func() []string {
+			binds := make([]string, 0, len(vmounts))
+			for _, m := range vmounts {
+				binds = append(binds, fmt.Sprintf("%s:%s:z", m.Source, m.Target))
+			}
+			binds = append(binds, fmt.Sprintf("%s:/home/kl/workspace:z", c.cwd))
+			return binds
+		}(),
+	}
+
+	c.runtime.ConfigureHost(hc)
+	return hc
+}
+
 func (c *client) generateMounts() ([]mount.Mount, error) {
 	td, err := os.MkdirTemp("", "kl-tmp")
 	if err != nil {
@@ -439,7 +502,6 @@ func (c *client) generateMounts() ([]mount.Mount, error) {
 
 	sshPath := path.Join(userHomeDir, ".ssh", "id_rsa.pub")
 	//rsaPath := path.Join(userHomeDir, ".ssh", "id_rsa")
-	sshDir := path.Join(userHomeDir, ".ssh")
 
 	akByte, err := os.ReadFile(sshPath)
 	if err != nil {
@@ -450,8 +512,6 @@ func (c *client) generateMounts() ([]mount.Mount, error) {
 
 	akTmpPath := path.Join(td, "authorized_keys")
 
-	gitConfigPath := path.Join(userHomeDir, ".gitconfig")
-
 	akByte, err = os.ReadFile(path.Join(userHomeDir, ".ssh", "authorized_keys"))
 	if err == nil {
 		ak += fmt.Sprint("\n", string(akByte))
@@ -497,6 +557,20 @@ func (c *client) generateMounts() ([]mount.Mount, error) {
 		return nil, fn.NewE(err)
 	}
 
+	return c.boxMounts(akTmpPath)
+}
+
+// boxMounts returns mounts of the box, authorized_keys of the box are not
+// mounted when akPath is empty
+func (c *client) boxMounts(akPath string) ([]mount.Mount, error) {
+	userHomeDir, err := fileclient.GetUserHomeDir()
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	sshDir := path.Join(userHomeDir, ".ssh")
+	gitConfigPath := path.Join(userHomeDir, ".gitconfig")
+
 	configFolder, err := fileclient.GetConfigFolder()
 	if err != nil {
 		return nil, fn.NewE(err)
@@ -507,23 +581,23 @@ func (c *client) generateMounts() ([]mount.Mount, error) {
 		//{Type: mount.TypeBind, Source: rsaPath, Target: "/tmp/ssh2/id_rsa", ReadOnly: true},
 		//  NOTE: never change the order of ssh mount
 		{Type: mount.TypeBind, Source: sshDir, Target: "/home/kl/.ssh", ReadOnly: true},
-		{Type: mount.TypeBind, Source: akTmpPath, Target: "/home/kl/.ssh/authorized_keys", ReadOnly: true},
-		//{Type: mount.TypeBind, Source: gitConfigPath, Target: "/tmp/gitconfig/.gitconfig", ReadOnly: true},
-		{Type: mount.TypeVolume, Source: "kl-nix-store", Target: "/nix"},
-		{Type: mount.TypeBind, Source: configFolder, Target: "/.cache/kl"},
 	}
+	if akPath != "" {
+		volumes = append(volumes, mount.Mount{Type: mount.TypeBind, Source: akPath, Target: "/home/kl/.ssh/authorized_keys", ReadOnly: true})
+	}
+	volumes = append(volumes,
+		//{Type: mount.TypeBind, Source: gitConfigPath, Target: "/tmp/gitconfig/.gitconfig", ReadOnly: true},
+		mount.Mount{Type: mount.TypeVolume, Source: "kl-nix-store", Target: "/nix"},
+		mount.Mount{Type: mount.TypeBind, Source: configFolder, Target: "/.cache/kl"},
+	)
+
 	_, err = os.Stat(gitConfigPath)
 	if err == nil {
 		volumes = append(volumes, mount.Mount{Type: mount.TypeBind, Source: gitConfigPath, Target: "/home/kl/.gitconfig", ReadOnly: true})
 	}
 
-	dockerSock := "/var/run/docker.sock"
-	// if runtime.GOOS == constants.RuntimeWindows {
-	// 	dockerSock = "\\\\.\\pipe\\docker_engine"
-	// }
-
 	volumes = append(volumes,
-		mount.Mount{Type: mount.TypeVolume, Source: dockerSock, Target: "/var/run/host-docker.sock"},
+		mount.Mount{Type: mount.TypeBind, Source: c.runtime.SocketPath(), Target: containerruntime.BoxSocketPath},
 	)
 
 	return volumes, nil
@@ -533,6 +607,10 @@ func (c *client) generateMounts() ([]mount.Mount, error) {
 func (c *client) SyncVpn(wg string) error {
 	defer spinner.Client.UpdateMessage("validating vpn configuration")()
 
+	if err := containerruntime.RequirePrivileged(c.runtime, "wireguard"); err != nil {
+		return fn.NewE(err)
+	}
+
 	err := c.ensureImage(constants.GetWireguardImageName())
 	if err != nil {
 		return err
@@ -692,6 +770,10 @@ func (c *client) ConnectClusterToTeam(cConfig *fileclient.TeamClusterConfig) err
 }
 
 func (c *client) EnsureK3SCluster(team string) error {
+	if err := containerruntime.RequirePrivileged(c.runtime, "the local cluster"); err != nil {
+		return fn.NewE(err)
+	}
+
 	err := c.ensureImage(constants.GetK3SImageName())
 	if err != nil {
 		return err
@@ -819,60 +901,56 @@ func (c *client) containerAtPath(path string) (*types.Container, error) {
 	return &existingContainers[0], nil
 }
 
+// sshReadyTimeout is how long a box may take to get ready for ssh, it
+// starts over whenever the box is done installing packages, as installing
+// them can take much longer on the first start
+const sshReadyTimeout = 3 * time.Minute
+
 func (c *client) waitForSshReady(port int, containerId string) error {
 	defer spinner.Client.UpdateMessage("waiting for ssh to be ready")()
 
-	ctx, cf := context.WithTimeout(context.Background(), 1*time.Minute)
+	ctx, cf := context.WithCancel(context.Background())
 	defer cf()
 
-	if c.verbose {
-		go func() {
-			rc, err := c.cli.ContainerLogs(ctx, containerId, container.LogsOptions{
-				ShowStdout: true,
-				ShowStderr: true,
-				Since:      time.Now().Format(time.RFC3339),
-				Follow:     true,
-			})
-
-			if r := bufio.NewScanner(rc); err == nil {
-				for r.Scan() {
-					l := r.Text()
-					if len(l) > 8 {
-						l = l[8:]
-					}
-					fn.Log(text.Blue("[box]"), l)
-				}
+	var installing atomic.Bool
+	go func() {
+		rc, err := c.cli.ContainerLogs(ctx, containerId, container.LogsOptions{
+			ShowStdout: true,
+			ShowStderr: true,
+			Since:      time.Now().Format(time.RFC3339),
+			Follow:     true,
+		})
+		if err != nil {
+			return
+		}
+		defer rc.Close()
+
+		done := func() {}
+		r := bufio.NewScanner(rc)
+		for r.Scan() {
+			l := r.Text()
+			if len(l) > 8 {
+				l = l[8:]
 			}
-		}()
-	} else {
-		go func() {
-			cf := func() {}
-			rc, err := c.cli.ContainerLogs(ctx, containerId, container.LogsOptions{
-				ShowStdout: true,
-				ShowStderr: true,
-				Since:      time.Now().Format(time.RFC3339),
-				Follow:     true,
-			})
 
-			if r := bufio.NewScanner(rc); err == nil {
-				for r.Scan() {
-					l := r.Text()
-					if len(l) > 8 {
-						l = l[8:]
-					}
-
-					if l == "kloudlite-entrypoint:INSTALLING_PACKAGES" {
-						cf = spinner.Client.UpdateMessage("installing nix packages")
-					} else if l == "kloudlite-entrypoint:INSTALLING_PACKAGES_DONE" {
-						cf()
-					}
+			switch l {
+			case "kloudlite-entrypoint:INSTALLING_PACKAGES":
+				installing.Store(true)
+				if !c.verbose {
+					done = spinner.Client.UpdateMessage("installing nix packages")
 				}
+			case "kloudlite-entrypoint:INSTALLING_PACKAGES_DONE":
+				installing.Store(false)
+				done()
 			}
-		}()
-	}
 
-	t := time.Now()
+			if c.verbose {
+				fn.Log(text.Blue("[box]"), l)
+			}
+		}
+	}()
 
+	deadline := time.Now().Add(sshReadyTimeout)
 	for {
 		cj, err := c.cli.ContainerInspect(context.TODO(), containerId)
 		if err != nil {
@@ -880,34 +958,26 @@ func (c *client) waitForSshReady(port int, containerId string) error {
 		}
 
 		if cj.State != nil && !cj.State.Running {
-			rc, err := c.cli.ContainerLogs(context.Background(), containerId, container.LogsOptions{
-				ShowStdout: false,
-				ShowStderr: true,
-				Follow:     false,
-				Since:      t.Format(time.RFC3339),
-			})
-
-			if r := bufio.NewScanner(rc); err == nil {
-				logs := ""
-				for r.Scan() {
-					l := r.Text()
-					if len(l) > 8 {
-						l = l[8:]
-					}
-
-					logs += fmt.Sprintf("%s %s\n", text.Yellow("[stderr]"), l)
-				}
-
-				return fn.NewE(fn.Errorf("failed to start container"), logs)
-			}
-
-			return fn.Errorf("container is not running")
+			return c.startFailure(containerId, fn.Errorf("box exited with code %d before ssh was ready", cj.State.ExitCode))
 		}
 
 		if err := sshclient.CheckSSHConnection(sshConf("localhost", port)); err == nil {
 			break
 		}
 
+		// packages are installed before sshd starts, however long it takes
+		if installing.Load() {
+			deadline = time.Now().Add(sshReadyTimeout)
+		}
+
+		if time.Now().After(deadline) {
+			err := c.startFailure(containerId, fn.Errorf("box didn't get ready for ssh within %s", sshReadyTimeout))
+			if serr := c.cli.ContainerStop(context.Background(), containerId, container.StopOptions{}); serr != nil {
+				fn.Warnf("failed to stop the box: %s", serr.Error())
+			}
+			return err
+		}
+
 		time.Sleep(1 * time.Second)
 	}
 	return nil
@@ -0,0 +1,70 @@
+package box
+
+import (
+	"time"
+
+	"github.com/kloudlite/kl/cmd/box/boxpkg"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/table"
+	"github.com/kloudlite/kl/pkg/ui/text"
+	"github.com/spf13/cobra"
+)
+
+var eventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "show what happened to the box",
+	Long: `show what happened to the box
+
+events are recorded by kl when the box is created, started, stopped, restarted or
+fails to start, when kl.yml changes, env vars are reloaded, ports are exposed and
+apps are intercepted. they are kept after the box is stopped.`,
+	Example: `  kl box events         # show the last 20 events
+  kl box events -n 100  # show the last 100 events`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := listEvents(cmd, args); err != nil {
+			fn.PrintError(err)
+			return
+		}
+	},
+}
+
+func listEvents(cmd *cobra.Command, args []string) error {
+	c, err := boxpkg.NewClient(cmd, args)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	events, err := c.Events()
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	if n := fn.ParseIntFlag(cmd, "tail"); n > 0 && len(events) > n {
+		events = events[len(events)-n:]
+	}
+
+	if len(events) == 0 && fn.ParseStringFlag(cmd, "output") == "table" {
+		fn.Log(text.Yellow("no events recorded for the box of this workspace"))
+		return nil
+	}
+
+	header := table.Row{table.HeaderText("time"), table.HeaderText("event"), table.HeaderText("message")}
+	rows := make([]table.Row, 0, len(events))
+	for _, e := range events {
+		t := string(e.Type)
+		if e.Type == boxpkg.EventStartFailed {
+			t = text.Red(t)
+		}
+
+		rows = append(rows, table.Row{e.Time.Local().Format(time.DateTime), t, e.Message})
+	}
+
+	fn.Println(table.Table(&header, rows, cmd))
+
+	return nil
+}
+
+func init() {
+	eventsCmd.Flags().IntP("tail", "n", 20, "number of events to show from the end, 0 shows all")
+	fn.WithOutputVariant(eventsCmd)
+}
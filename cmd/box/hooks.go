@@ -0,0 +1,78 @@
+package box
+
+import (
+	"github.com/kloudlite/kl/cmd/box/boxpkg"
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/spf13/cobra"
+)
+
+var hooksCmd = &cobra.Command{
+	Use:   "hooks",
+	Short: "manage lifecycle hooks of the box",
+}
+
+var hooksRunCmd = &cobra.Command{
+	Use:   "run <hook>",
+	Short: "run a lifecycle hook of kl.yml in the box",
+	Long: `run a lifecycle hook of kl.yml in the box
+
+Hooks:
+  onCreate    run when the box container is created
+  postStart   run after the box is started
+  onReload    run after kl box reload changed the box configuration
+  preStop     run before the box is stopped
+`,
+	Example: `  kl box hooks run postStart`,
+	Args:    cobra.ExactArgs(1),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		resp := make([]string, 0, len(fileclient.HookNames))
+		for _, h := range fileclient.HookNames {
+			resp = append(resp, string(h))
+		}
+		return resp, cobra.ShellCompDirectiveNoFileComp
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		hook, err := fileclient.ParseHookName(args[0])
+		if err != nil {
+			fn.PrintError(err)
+			return
+		}
+
+		fc, err := fileclient.New()
+		if err != nil {
+			fn.PrintError(err)
+			return
+		}
+
+		kf, err := fc.GetKlFile("")
+		if err != nil {
+			fn.PrintError(err)
+			return
+		}
+
+		if len(kf.Hooks.Get(hook)) == 0 {
+			fn.Warnf("no commands defined for hook %s in kl.yml\n", hook)
+			return
+		}
+
+		c, err := boxpkg.NewClient(cmd, nil)
+		if err != nil {
+			fn.PrintError(err)
+			return
+		}
+
+		if err := c.RunHooks(hook); err != nil {
+			fn.PrintError(err)
+			return
+		}
+	},
+}
+
+func init() {
+	hooksCmd.AddCommand(hooksRunCmd)
+}
@@ -0,0 +1,39 @@
+package box
+
+import (
+	"github.com/kloudlite/kl/cmd/box/boxpkg"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/text"
+	"github.com/spf13/cobra"
+)
+
+var interceptCmd = &cobra.Command{
+	Use:   "intercept",
+	Short: "connect a box to the cluster and route intercepted traffic to it",
+	Long: `connect a box to the cluster and route intercepted traffic to it
+
+only one box at a time holds the tunnel to the cluster of the team, see kl box ls.
+the tunnel is moved to the box of the current workspace, or of --box, and the box
+holding it keeps running without it.`,
+	Example: `  kl box intercept                      # move the tunnel to the box of this workspace
+  kl box intercept --box ~/src/payments  # move the tunnel to the box of another workspace`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := boxpkg.NewClient(cmd, args)
+		if err != nil {
+			fn.PrintError(err)
+			return
+		}
+
+		path := fn.ParseStringFlag(cmd, "box")
+		if err := c.MoveTunnel(path); err != nil {
+			fn.PrintError(err)
+			return
+		}
+
+		fn.Log(text.Green("[#] the box is connected to the cluster, intercepted traffic is routed to it"))
+	},
+}
+
+func init() {
+	interceptCmd.Flags().String("box", "", "path of the workspace of the box, defaults to the current workspace")
+}
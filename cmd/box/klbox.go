@@ -33,7 +33,22 @@ func init() {
 	fileclient.OnlyOutsideBox(infoCmd)
 	BoxCmd.AddCommand(infoCmd)
 
+	fileclient.OnlyOutsideBox(logsCmd)
+	BoxCmd.AddCommand(logsCmd)
+
+	BoxCmd.AddCommand(eventsCmd)
+
+	BoxCmd.AddCommand(snapshotCmd)
+
 	fileclient.OnlyOutsideBox(stopAllCmd)
 	BoxCmd.AddCommand(stopAllCmd)
 
+	fileclient.OnlyOutsideBox(interceptCmd)
+	BoxCmd.AddCommand(interceptCmd)
+
+	BoxCmd.AddCommand(hooksCmd)
+
+	fileclient.OnlyInsideBox(applyCmd)
+	BoxCmd.AddCommand(applyCmd)
+
 }
@@ -0,0 +1,52 @@
+package box
+
+import (
+	"os"
+
+	"github.com/kloudlite/kl/cmd/box/boxpkg"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/spf13/cobra"
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "show output of the box",
+	Long: `show output of the box
+
+output of the entrypoint of the box, sshd and start.sh, which sets up packages, env
+vars and mounts. logs are gone once the box is stopped, see kl box events for what
+happened to it before.`,
+	Example: `  kl box logs                 # show all logs of the box
+  kl box logs -f --since 5m   # follow logs, starting 5 minutes ago
+  kl box logs --tail 100      # show the last 100 lines`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := showLogs(cmd, args); err != nil {
+			fn.PrintError(err)
+			return
+		}
+	},
+}
+
+func showLogs(cmd *cobra.Command, args []string) error {
+	c, err := boxpkg.NewClient(cmd, args)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	tail := fn.ParseStringFlag(cmd, "tail")
+	if tail == "all" {
+		tail = ""
+	}
+
+	return c.Logs(boxpkg.LogsOptions{
+		Follow: fn.ParseBoolFlag(cmd, "follow"),
+		Since:  fn.ParseStringFlag(cmd, "since"),
+		Tail:   tail,
+	}, os.Stdout, os.Stderr)
+}
+
+func init() {
+	logsCmd.Flags().BoolP("follow", "f", false, "keep streaming new logs")
+	logsCmd.Flags().String("since", "", "show logs since a timestamp, or a duration such as 10m")
+	logsCmd.Flags().String("tail", "all", "number of lines to show from the end")
+}
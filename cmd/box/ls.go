@@ -9,6 +9,12 @@ import (
 var psCmd = &cobra.Command{
 	Use:   "ls",
 	Short: "list all running boxes",
+	Long: `list all running boxes
+
+every box of this device shares its tunnel to the cluster of the team, so only
+one box at a time is connected to the cluster, resolves its services and
+receives intercepted traffic, it is marked in the tunnel column. the first box
+started holds the tunnel, move it to another box with kl box intercept.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		c, err := boxpkg.NewClient(cmd, args)
 		if err != nil {
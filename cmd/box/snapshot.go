@@ -0,0 +1,198 @@
+package box
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/kloudlite/kl/cmd/box/boxpkg"
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/table"
+	"github.com/kloudlite/kl/pkg/ui/text"
+	"github.com/spf13/cobra"
+)
+
+var snapshotCmd = &cobra.Command{
+	Use:     "snapshot",
+	Aliases: []string{"snapshots"},
+	Short:   "save the box to restore it later",
+	Long: `save the box to restore it later
+
+a snapshot commits the box with an archive of its home, which holds shell history,
+language caches and tool configs. restoring a snapshot restores the home and runs the
+box from the snapshot, until the snapshot is removed.
+
+snapshots are images tagged ` + boxpkg.SnapshotRepo + `:<workspace hash>-<name>, they can
+be handed over with docker save and docker load, and restored by their tag. keys of
+the vpn of this device are left out, but files mounted from configs and secrets of the
+environment are part of the box, only hand snapshots over to members of the team.`,
+}
+
+var snapshotCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "snapshot the running box",
+	Example: `  kl box snapshot create warm
+  kl box snapshot create warm --force   # replace snapshot warm`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := boxpkg.NewClient(cmd, nil)
+		if err != nil {
+			fn.PrintError(err)
+			return
+		}
+
+		s, err := c.CreateSnapshot(args[0], fn.ParseBoolFlag(cmd, "force"))
+		if err != nil {
+			fn.PrintError(err)
+			return
+		}
+
+		fn.Log(text.Green(fmt.Sprintf("snapshot %s created as %s (%s)", s.Name, s.Image, units.HumanSize(float64(s.Size)))))
+	},
+}
+
+var snapshotListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "list snapshots of the box",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := listSnapshots(cmd); err != nil {
+			fn.PrintError(err)
+			return
+		}
+	},
+}
+
+func listSnapshots(cmd *cobra.Command) error {
+	c, err := boxpkg.NewClient(cmd, nil)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	all := fn.ParseBoolFlag(cmd, "all")
+	snapshots, err := c.ListSnapshots(all)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	if len(snapshots) == 0 && fn.ParseStringFlag(cmd, "output") == "table" {
+		fn.Log(text.Yellow("no snapshots found, create one with kl box snapshot create <name>"))
+		return nil
+	}
+
+	header := table.Row{table.HeaderText("name"), table.HeaderText("created"), table.HeaderText("size"), table.HeaderText("image")}
+	if all {
+		header = append(header, table.HeaderText("path"))
+	}
+
+	rows := make([]table.Row, 0, len(snapshots))
+	for _, s := range snapshots {
+		name := s.Name
+		if s.Active {
+			name = text.Green(fmt.Sprintf("%s (active)", s.Name))
+		}
+
+		row := table.Row{name, s.Created.Local().Format(time.DateTime), units.HumanSize(float64(s.Size)), s.Image}
+		if all {
+			row = append(row, s.Path)
+		}
+		rows = append(rows, row)
+	}
+
+	fn.Println(table.Table(&header, rows, cmd))
+
+	return nil
+}
+
+var snapshotRestoreCmd = &cobra.Command{
+	Use:   "restore <name>",
+	Short: "restore the box from a snapshot",
+	Long: `restore the box from a snapshot
+
+the box is stopped, its home is replaced with the home of the snapshot and it is
+started from the snapshot. files of the home which are not in the snapshot are
+removed. the home is shared by every box, so it is replaced in boxes of other
+workspaces too, stopped ones included. snapshots of other workspaces are restored by their tag.`,
+	Example: `  kl box snapshot restore warm
+  kl box snapshot restore 3f2a9c1d04e7-warm   # snapshot of another workspace
+  kl box snapshot restore warm --skip-home     # keep the home as it is`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := boxpkg.NewClient(cmd, nil)
+		if err != nil {
+			fn.PrintError(err)
+			return
+		}
+
+		skipHome := fn.ParseBoolFlag(cmd, "skip-home")
+		if !skipHome {
+			others, err := c.HomeCacheUsers()
+			if err != nil {
+				fn.PrintError(err)
+				return
+			}
+
+			if len(others) > 0 {
+				fn.Warnf("home is shared by every box, it is replaced in %s too. pass --skip-home to keep it", strings.Join(others, ", "))
+			}
+		}
+
+		if !fn.ParseBoolFlag(cmd, "yes") {
+			fn.Logf(text.Yellow(fmt.Sprintf("[#] this will stop the box and replace it with snapshot %s, processes of the box are terminated. do you want to proceed? [y/N] ", args[0])))
+			if !fn.Confirm("y", "n") {
+				return
+			}
+		}
+
+		if err := c.RestoreSnapshot(args[0], skipHome); err != nil {
+			fn.PrintError(err)
+			return
+		}
+	},
+}
+
+var snapshotRmCmd = &cobra.Command{
+	Use:     "rm <name>",
+	Aliases: []string{"remove", "delete"},
+	Short:   "remove a snapshot",
+	Long: `remove a snapshot
+
+a box restored from the snapshot is started from its image again the next time it starts.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := boxpkg.NewClient(cmd, nil)
+		if err != nil {
+			fn.PrintError(err)
+			return
+		}
+
+		if err := c.RemoveSnapshot(args[0]); err != nil {
+			fn.PrintError(err)
+			return
+		}
+
+		fn.Log(text.Green(fmt.Sprintf("snapshot %s removed", args[0])))
+	},
+}
+
+func init() {
+	snapshotCreateCmd.Flags().Bool("force", false, "replace the snapshot if it exists")
+
+	snapshotListCmd.Flags().BoolP("all", "a", false, "list snapshots of every workspace")
+	fn.WithOutputVariant(snapshotListCmd)
+
+	snapshotRestoreCmd.Flags().BoolP("yes", "y", false, "restore without confirmation")
+	snapshotRestoreCmd.Flags().Bool("skip-home", false, "keep the home of the box as it is")
+
+	snapshotCmd.AddCommand(snapshotCreateCmd)
+	snapshotCmd.AddCommand(snapshotListCmd)
+	snapshotCmd.AddCommand(snapshotRestoreCmd)
+	snapshotCmd.AddCommand(snapshotRmCmd)
+
+	fileclient.OnlyOutsideBox(snapshotCreateCmd)
+	fileclient.OnlyOutsideBox(snapshotListCmd)
+	fileclient.OnlyOutsideBox(snapshotRestoreCmd)
+	fileclient.OnlyOutsideBox(snapshotRmCmd)
+}
@@ -5,8 +5,8 @@ import (
 	"fmt"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
-	dockerclient "github.com/docker/docker/client"
 	"github.com/kloudlite/kl/cmd/box/boxpkg"
+	containerruntime "github.com/kloudlite/kl/pkg/container-runtime"
 	fn "github.com/kloudlite/kl/pkg/functions"
 	"github.com/kloudlite/kl/pkg/ui/spinner"
 	"github.com/kloudlite/kl/pkg/ui/text"
@@ -34,7 +34,7 @@ var stopAllCmd = &cobra.Command{
 func stopAllContainers() error {
 	defer spinner.Client.UpdateMessage("stopping running containers")()
 
-	c, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation())
+	c, err := containerruntime.NewClient()
 	if err != nil {
 		return fn.NewE(err)
 	}
@@ -25,6 +25,10 @@ var cloneCmd = &cobra.Command{
 	},
 }
 
+func init() {
+	fn.WithKlFileLayer(cloneCmd)
+}
+
 func envClone(cmd *cobra.Command, args []string) error {
 	if len(args) == 0 {
 		return fn.Error("env name is required")
@@ -66,7 +70,7 @@ func envClone(cmd *cobra.Command, args []string) error {
 
 	if klFile.DefaultEnv == "" {
 		klFile.DefaultEnv = env.Metadata.Name
-		if err := fc.WriteKLFile(*klFile); err != nil {
+		if err := fc.WriteKLFileLayer(fileclient.ParseKLFileLayer(cmd), *klFile); err != nil {
 			return err
 		}
 	}
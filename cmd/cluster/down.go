@@ -4,8 +4,8 @@ import (
 	"fmt"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
-	dockerclient "github.com/docker/docker/client"
 	"github.com/kloudlite/kl/k3s"
+	containerruntime "github.com/kloudlite/kl/pkg/container-runtime"
 	"github.com/kloudlite/kl/pkg/functions"
 	"github.com/kloudlite/kl/pkg/ui/spinner"
 	"github.com/spf13/cobra"
@@ -26,7 +26,7 @@ var downCmd = &cobra.Command{
 
 func StopK3sServer(cmd *cobra.Command) error {
 	defer spinner.Client.UpdateMessage("stopping k3s server")()
-	cli, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation())
+	cli, err := containerruntime.NewClient()
 	if err != nil {
 		return err
 	}
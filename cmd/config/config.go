@@ -0,0 +1,25 @@
+package config
+
+import (
+	"github.com/kloudlite/kl/domain/fileclient"
+	"github.com/spf13/cobra"
+)
+
+var Cmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage settings of kl",
+	Long:  `get and set settings of kl on this machine.`,
+}
+
+const keyRuntime = "runtime"
+
+var keys = []string{keyRuntime}
+
+func init() {
+	Cmd.Aliases = append(Cmd.Aliases, "cfg")
+
+	fileclient.OnlyOutsideBox(setCmd)
+	fileclient.OnlyOutsideBox(getCmd)
+	Cmd.AddCommand(setCmd)
+	Cmd.AddCommand(getCmd)
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kloudlite/kl/domain/fileclient"
+	containerruntime "github.com/kloudlite/kl/pkg/container-runtime"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/text"
+	"github.com/spf13/cobra"
+)
+
+var getCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "get value of a setting",
+	Long: `get value of a setting
+
+Settings:
+  runtime   container runtime used for boxes and the local cluster
+`,
+	Example: `  kl config get runtime`,
+	Args:    cobra.ExactArgs(1),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) == 0 {
+			return keys, cobra.ShellCompDirectiveNoFileComp
+		}
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := getConfig(args[0]); err != nil {
+			fn.PrintError(err)
+			return
+		}
+	},
+}
+
+func getConfig(key string) error {
+	switch key {
+	case keyRuntime:
+		s, err := fileclient.GetContainerRuntime()
+		if err != nil {
+			return fn.NewE(err)
+		}
+
+		if s == "" {
+			s = string(containerruntime.Auto)
+		}
+
+		r, err := containerruntime.Get()
+		if err != nil {
+			return fn.NewE(err)
+		}
+
+		fn.Log(fmt.Sprintf("%s (using %s at %s)", s, text.Blue(string(r.Name())), r.SocketPath()))
+		return nil
+	default:
+		return fn.Errorf("unknown setting %q, must be one of %s", key, strings.Join(keys, ", "))
+	}
+}
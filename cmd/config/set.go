@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kloudlite/kl/domain/fileclient"
+	containerruntime "github.com/kloudlite/kl/pkg/container-runtime"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/text"
+	"github.com/spf13/cobra"
+)
+
+var setCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "set value of a setting",
+	Long: `set value of a setting
+
+Settings:
+  runtime   container runtime used for boxes and the local cluster, one of auto, docker or podman
+`,
+	Example: `  kl config set runtime podman
+  kl config set runtime auto`,
+	Args: cobra.ExactArgs(2),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		switch len(args) {
+		case 0:
+			return keys, cobra.ShellCompDirectiveNoFileComp
+		case 1:
+			if args[0] == keyRuntime {
+				resp := make([]string, 0, len(containerruntime.Names))
+				for _, n := range containerruntime.Names {
+					resp = append(resp, string(n))
+				}
+				return resp, cobra.ShellCompDirectiveNoFileComp
+			}
+		}
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := setConfig(args[0], args[1]); err != nil {
+			fn.PrintError(err)
+			return
+		}
+	},
+}
+
+func setConfig(key, value string) error {
+	switch key {
+	case keyRuntime:
+		n, err := containerruntime.ParseName(value)
+		if err != nil {
+			return fn.NewE(err)
+		}
+
+		// auto is the default, so it is not persisted
+		s := string(n)
+		if n == containerruntime.Auto {
+			s = ""
+		}
+
+		if err := fileclient.SaveContainerRuntime(s); err != nil {
+			return fn.NewE(err)
+		}
+
+		r, err := containerruntime.Get()
+		if err != nil {
+			return fn.NewE(err)
+		}
+
+		fn.Log(fmt.Sprintf("container runtime set to %s, using %s at %s", text.Blue(string(n)), text.Blue(string(r.Name())), r.SocketPath()))
+		fn.Log(text.Yellow("restart running boxes with `kl box restart` to apply it"))
+		return nil
+	default:
+		return fn.Errorf("unknown setting %q, must be one of %s", key, strings.Join(keys, ", "))
+	}
+}
@@ -0,0 +1,16 @@
+package env
+
+import (
+	"github.com/kloudlite/kl/domain/fileclient"
+	"github.com/spf13/cobra"
+)
+
+var Cmd = &cobra.Command{
+	Use:   "env",
+	Short: "follow env vars of the box",
+}
+
+func init() {
+	fileclient.OnlyInsideBox(watchCmd)
+	Cmd.AddCommand(watchCmd)
+}
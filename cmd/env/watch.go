@@ -0,0 +1,193 @@
+package env
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kloudlite/kl/cmd/box/boxpkg"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/text"
+	"github.com/spf13/cobra"
+)
+
+const (
+	watchInterval = time.Second
+	stopTimeout   = 10 * time.Second
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch [-- command...]",
+	Short: "watch env vars reloaded into the box",
+	Long: `watch env vars reloaded into the box
+
+env vars of kl.yml are reloaded into the running box when they change, without restarting
+it. changed keys are printed, and the command, when given, is restarted with the new env.`,
+	Example: `  kl env watch                 # print keys of env vars which change
+  kl env watch -- go run .     # restart go run . with the new env on every change`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := watchEnv(args); err != nil {
+			fn.PrintError(err)
+			return
+		}
+	},
+}
+
+func readEnv() (map[string]string, error) {
+	b, err := os.ReadFile(boxpkg.BoxEnvJSONFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]string{}, nil
+		}
+		return nil, fn.NewE(err)
+	}
+
+	env := map[string]string{}
+	if err := json.Unmarshal(b, &env); err != nil {
+		return nil, fn.NewE(err, fmt.Sprintf("failed to parse %s", boxpkg.BoxEnvJSONFile))
+	}
+
+	return env, nil
+}
+
+// diffEnv returns keys set or changed in next, and keys removed from prev
+func diffEnv(prev, next map[string]string) ([]string, []string) {
+	changed, removed := make([]string, 0), make([]string, 0)
+	for k, v := range next {
+		if pv, ok := prev[k]; !ok || pv != v {
+			changed = append(changed, k)
+		}
+	}
+	for k := range prev {
+		if _, ok := next[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+	slices.Sort(changed)
+	slices.Sort(removed)
+
+	return changed, removed
+}
+
+// commandEnv returns env of this process with env vars of prev replaced by
+// those of next
+func commandEnv(prev, next map[string]string) []string {
+	resp := make([]string, 0, len(next))
+	for _, e := range os.Environ() {
+		k, _, _ := strings.Cut(e, "=")
+		if _, ok := prev[k]; ok {
+			continue
+		}
+		if _, ok := next[k]; ok {
+			continue
+		}
+		resp = append(resp, e)
+	}
+
+	for k, v := range next {
+		resp = append(resp, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	return resp
+}
+
+type watchedCommand struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+}
+
+func startCommand(args []string, env []string) (*watchedCommand, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, fn.NewE(err, fmt.Sprintf("failed to start %s", strings.Join(args, " ")))
+	}
+
+	wc := &watchedCommand{cmd: cmd, done: make(chan struct{})}
+	go func() {
+		defer close(wc.done)
+		if err := cmd.Wait(); err != nil {
+			fn.Log(text.Yellow("[env]"), fmt.Sprintf("%s exited: %s", args[0], err.Error()))
+			return
+		}
+		fn.Log(text.Blue("[env]"), fmt.Sprintf("%s exited", args[0]))
+	}()
+
+	return wc, nil
+}
+
+// stop terminates the command, it is killed when it doesn't exit in time
+func (wc *watchedCommand) stop() {
+	select {
+	case <-wc.done:
+		return
+	default:
+	}
+
+	_ = wc.cmd.Process.Signal(syscall.SIGTERM)
+	select {
+	case <-wc.done:
+	case <-time.After(stopTimeout):
+		_ = wc.cmd.Process.Kill()
+		<-wc.done
+	}
+}
+
+func watchEnv(args []string) error {
+	prev, err := readEnv()
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	var wc *watchedCommand
+	if len(args) > 0 {
+		if wc, err = startCommand(args, commandEnv(prev, prev)); err != nil {
+			return fn.NewE(err)
+		}
+		defer func() { wc.stop() }()
+	}
+
+	fn.Log(text.Blue("[env]"), fmt.Sprintf("watching %d env var(s) of the box", len(prev)))
+
+	for range time.Tick(watchInterval) {
+		next, err := readEnv()
+		if err != nil {
+			fn.Warn(err.Error())
+			continue
+		}
+
+		if maps.Equal(prev, next) {
+			continue
+		}
+
+		changed, removed := diffEnv(prev, next)
+		if len(changed) > 0 {
+			fn.Log(text.Blue("[env]"), "changed:", strings.Join(changed, ", "))
+		}
+		if len(removed) > 0 {
+			fn.Log(text.Blue("[env]"), "removed:", strings.Join(removed, ", "))
+		}
+
+		if wc != nil {
+			fn.Log(text.Blue("[env]"), fmt.Sprintf("restarting %s", strings.Join(args, " ")))
+			wc.stop()
+			if wc, err = startCommand(args, commandEnv(prev, next)); err != nil {
+				return fn.NewE(err)
+			}
+		}
+
+		prev = next
+	}
+
+	return nil
+}
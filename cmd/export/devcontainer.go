@@ -0,0 +1,75 @@
+package export
+
+import (
+	"os"
+
+	"github.com/kloudlite/kl/cmd/box/boxpkg"
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/text"
+	"github.com/spf13/cobra"
+)
+
+var devcontainerCmd = &cobra.Command{
+	Use:   "devcontainer",
+	Short: "export workspace as devcontainer.json",
+	Long: `export workspace as devcontainer.json
+
+The generated devcontainer.json uses the kl box image with the env, mounts and ports of the
+box of this workspace, so editors supporting devcontainers can attach to the same setup.
+It holds paths of this machine, so it is not meant to be committed. it is printed, or
+written to --output, which must be ignored by git, an existing file is only replaced
+with --force.
+`,
+	Example: `  kl export devcontainer
+  kl export devcontainer -o .devcontainer/kl.devcontainer.json
+  kl export devcontainer -o .devcontainer/kl.devcontainer.json --force`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := exportDevContainer(cmd, args); err != nil {
+			fn.PrintError(err)
+			return
+		}
+	},
+}
+
+func exportDevContainer(cmd *cobra.Command, args []string) error {
+	out := fn.ParseStringFlag(cmd, "output")
+
+	if out != "" && !fn.ParseBoolFlag(cmd, "force") {
+		if _, err := os.Stat(out); err == nil {
+			return fn.Errorf("%s already exists, replace it with --force", out)
+		}
+	}
+
+	c, err := boxpkg.NewClient(cmd, args)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	dc, err := c.DevContainer()
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	if out == "" {
+		b, err := fileclient.MarshalDevContainer(dc)
+		if err != nil {
+			return fn.NewE(err)
+		}
+
+		fn.Printf("%s", b)
+		return nil
+	}
+
+	if err := fileclient.WriteDevContainer(out, dc); err != nil {
+		return fn.NewE(err)
+	}
+
+	fn.Log(text.Green("devcontainer exported to " + out))
+	return nil
+}
+
+func init() {
+	devcontainerCmd.Flags().StringP("output", "o", "", "path of the devcontainer.json to write, printed when empty")
+	devcontainerCmd.Flags().BoolP("force", "f", false, "replace the file at --output if it exists")
+}
@@ -0,0 +1,17 @@
+package export
+
+import (
+	"github.com/kloudlite/kl/domain/fileclient"
+	"github.com/spf13/cobra"
+)
+
+var Cmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export workspace configuration",
+	Long:  `export configuration of the workspace to formats of other tools.`,
+}
+
+func init() {
+	fileclient.OnlyOutsideBox(devcontainerCmd)
+	Cmd.AddCommand(devcontainerCmd)
+}
@@ -11,5 +11,7 @@ var Cmd = &cobra.Command{
 func init() {
 	Cmd.AddCommand(portsCmd)
 	Cmd.AddCommand(syncCmd)
+	Cmd.AddCommand(rmCmd)
+	Cmd.AddCommand(watchCmd)
 	portsCmd.Aliases = []string{"ports"}
 }
@@ -1,9 +1,8 @@
 package expose
 
 import (
+	"fmt"
 	"os"
-	"slices"
-	"strconv"
 
 	"github.com/kloudlite/kl/cmd/box/boxpkg"
 	"github.com/kloudlite/kl/domain/fileclient"
@@ -14,13 +13,20 @@ import (
 )
 
 var portsCmd = &cobra.Command{
-	Use:   "port",
+	Use:   "port [bind:][host:]container[/protocol]...",
 	Short: "expose ports",
 	Long: `
-This command will add ports to your kl-config file.
+This command will add ports to your kl-config file, and expose them on the host
+while the box is running. ports are exposed on every address of the host over
+tcp and udp unless a bind address or protocol is given, a port which listens on the
+same host port as one of kl.yml replaces it.
 `,
 	Example: ` 
   kl expose ports 8080 3000
+  kl expose port 9000:80                # port 80 of the box on port 9000 of the host
+  kl expose port 127.0.0.1:5432:5432    # only reachable from the host
+  kl expose port 53/udp
+  kl expose port 8080/tcp               # only tcp
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := exposePorts(cmd, args); err != nil {
@@ -30,37 +36,63 @@ This command will add ports to your kl-config file.
 	},
 }
 
+func parsePortArgs(args []string) (fileclient.Ports, error) {
+	if len(args) == 0 {
+		return nil, functions.Errorf("no ports provided. please provide ports using %s", text.Yellow("kl expose port 8080 3000"))
+	}
+
+	resp := make(fileclient.Ports, 0, len(args))
+	for _, arg := range args {
+		pm, err := fileclient.ParsePortMapping(arg)
+		if err != nil {
+			return nil, functions.NewE(err)
+		}
+		resp = append(resp, pm)
+	}
+
+	return resp, nil
+}
+
 func exposePorts(cmd *cobra.Command, args []string) error {
 	fc, err := fileclient.New()
 	if err != nil {
 		return functions.NewE(err)
 	}
 
-	cwd, err := os.Getwd()
+	klFile, err := fc.GetKlFile("")
 	if err != nil {
 		return functions.NewE(err)
 	}
 
-	klFile, err := fc.GetKlFile("")
+	ports, err := parsePortArgs(args)
 	if err != nil {
 		return functions.NewE(err)
 	}
 
-	if len(args) == 0 {
-		return functions.Errorf("no ports provided. please provide ports using %s", text.Yellow("kl expose port 8080 3000"))
+	for _, pm := range ports {
+		if i := klFile.Ports.Index(pm); i != -1 {
+			if klFile.Ports[i] != pm {
+				fn.Log(text.Yellow(fmt.Sprintf("[#] port %s replaces %s", pm, klFile.Ports[i])))
+			}
+			klFile.Ports[i] = pm
+			continue
+		}
+		klFile.Ports = append(klFile.Ports, pm)
 	}
 
-	for _, arg := range args {
-		port, err := strconv.Atoi(arg)
-		if err != nil {
-			return functions.NewE(err, "port should be an integer")
-		}
-		if !slices.Contains(klFile.Ports, port) {
-			klFile.Ports = append(klFile.Ports, port)
-		}
+	if err := fc.WriteKLFileLayer(fileclient.ParseKLFileLayer(cmd), *klFile); err != nil {
+		return functions.NewE(err)
 	}
 
-	if err := fc.WriteKLFile(*klFile); err != nil {
+	return syncPorts(cmd, args, boxpkg.ProxyConfig{})
+}
+
+// syncPorts exposes ports of kl.yml with the active profile merged over it,
+// and ports of config, of the box of the current directory. ports are
+// exposed when the box is started if it isn't running
+func syncPorts(cmd *cobra.Command, args []string, config boxpkg.ProxyConfig) error {
+	cwd, err := os.Getwd()
+	if err != nil {
 		return functions.NewE(err)
 	}
 
@@ -74,12 +106,14 @@ func exposePorts(cmd *cobra.Command, args []string) error {
 		return functions.NewE(err)
 	}
 
-	if err = c.SyncProxy(boxpkg.ProxyConfig{
-		ExposedPorts:        klFile.Ports,
-		TargetContainerPath: containerWorkspacePath,
-	}); err != nil {
+	config.TargetContainerPath = containerWorkspacePath
+	if err = c.SyncProxy(config); err != nil {
 		return fn.NewE(err)
 	}
 
 	return nil
 }
+
+func init() {
+	fn.WithKlFileLayer(portsCmd)
+}
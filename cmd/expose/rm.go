@@ -0,0 +1,74 @@
+package expose
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/kloudlite/kl/cmd/box/boxpkg"
+	"github.com/kloudlite/kl/domain/fileclient"
+	"github.com/kloudlite/kl/pkg/functions"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/text"
+	"github.com/spf13/cobra"
+)
+
+var rmCmd = &cobra.Command{
+	Use:   "rm [bind:][host:]container[/protocol]...",
+	Short: "stop exposing ports",
+	Long: `
+This command will remove ports from your kl-config file, and stop exposing them
+on the host. a port is matched by the host port it listens on, connections to
+other ports are kept open.
+`,
+	Example: ` 
+  kl expose rm 8080 3000
+  kl expose rm 53/udp
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := removePorts(cmd, args); err != nil {
+			fn.PrintError(err)
+			return
+		}
+	},
+}
+
+func removePorts(cmd *cobra.Command, args []string) error {
+	fc, err := fileclient.New()
+	if err != nil {
+		return functions.NewE(err)
+	}
+
+	klFile, err := fc.GetKlFile("")
+	if err != nil {
+		return functions.NewE(err)
+	}
+
+	ports, err := parsePortArgs(args)
+	if err != nil {
+		return functions.NewE(err)
+	}
+
+	for _, pm := range ports {
+		if klFile.Ports.Index(pm) == -1 {
+			return functions.Errorf("port %s is not exposed", pm)
+		}
+
+		klFile.Ports = slices.DeleteFunc(klFile.Ports, func(p fileclient.PortMapping) bool {
+			if !p.Conflicts(pm) {
+				return false
+			}
+			fn.Log(text.Yellow(fmt.Sprintf("[#] removed port %s", p)))
+			return true
+		})
+	}
+
+	if err := fc.WriteKLFileLayer(fileclient.ParseKLFileLayer(cmd), *klFile); err != nil {
+		return functions.NewE(err)
+	}
+
+	return syncPorts(cmd, args, boxpkg.ProxyConfig{})
+}
+
+func init() {
+	fn.WithKlFileLayer(rmCmd)
+}
@@ -1,11 +1,7 @@
 package expose
 
 import (
-	"os"
-
 	"github.com/kloudlite/kl/cmd/box/boxpkg"
-	"github.com/kloudlite/kl/domain/fileclient"
-	"github.com/kloudlite/kl/pkg/functions"
 	fn "github.com/kloudlite/kl/pkg/functions"
 	"github.com/spf13/cobra"
 )
@@ -28,34 +24,5 @@ This command will sync ports to your kl-config file.
 }
 
 func sync(cmd *cobra.Command, args []string) error {
-	fc, err := fileclient.New()
-	if err != nil {
-		return functions.NewE(err)
-	}
-
-	cwd, err := os.Getwd()
-	if err != nil {
-		return functions.NewE(err)
-	}
-	klFile, err := fc.GetKlFile("")
-	if err != nil {
-		return functions.NewE(err)
-	}
-	containerWorkspacePath := cwd
-	if val, ok := os.LookupEnv("KL_WORKSPACE"); ok {
-		containerWorkspacePath = val
-	}
-
-	c, err := boxpkg.NewClient(cmd, args)
-	if err != nil {
-		return functions.NewE(err)
-	}
-
-	if err = c.SyncProxy(boxpkg.ProxyConfig{
-		ExposedPorts:        klFile.Ports,
-		TargetContainerPath: containerWorkspacePath,
-	}); err != nil {
-		return fn.NewE(err)
-	}
-	return nil
+	return syncPorts(cmd, args, boxpkg.ProxyConfig{})
 }
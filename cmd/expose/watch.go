@@ -0,0 +1,251 @@
+package expose
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/kloudlite/kl/cmd/box/boxpkg"
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/text"
+	"github.com/spf13/cobra"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "expose ports processes of the box start listening on",
+	Long: `expose ports processes of the box start listening on
+
+tcp ports processes of the running box listen on are detected, and exposed on the
+same port of the host once confirmed, or right away with --yes. they stop being
+exposed when nothing listens on them anymore or watch exits, and are never written
+to kl.yml, use kl expose port to keep them. kl expose port and kl box start keep them
+exposed, unless a port of kl.yml listens on the same port.
+
+ports can be limited with expose of kl.yml, deny wins over allow:
+
+  expose:
+    allow: ["3000-9999"]
+    deny: ["5432", "6379"]`,
+	Example: `  kl expose watch         # ask before exposing a detected port
+  kl expose watch --yes   # expose detected ports right away`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := watchPorts(cmd, args); err != nil {
+			fn.PrintError(err)
+			return
+		}
+	},
+}
+
+type portWatcher struct {
+	cmd  *cobra.Command
+	args []string
+	c    boxpkg.BoxClient
+	yes  bool
+
+	// listeners found on the last poll, by port
+	seen map[int]boxpkg.Listener
+	// ports exposed by the watcher, and ports which were declined until they
+	// stop listening
+	exposed  fileclient.Ports
+	declined map[int]bool
+	// ports of kl.yml, with the active profile merged over it, the proxies
+	// were last synced with
+	synced  fileclient.Ports
+	lastErr string
+}
+
+func watchPorts(cmd *cobra.Command, args []string) error {
+	c, err := boxpkg.NewClient(cmd, args)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	interval, err := cmd.Flags().GetDuration("interval")
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	w := &portWatcher{
+		cmd:      cmd,
+		args:     args,
+		c:        c,
+		yes:      fn.ParseBoolFlag(cmd, "yes"),
+		seen:     map[int]boxpkg.Listener{},
+		declined: map[int]bool{},
+	}
+
+	// the root command exits on these signals, they are handled here
+	// instead, so ports exposed by the watcher are removed before exiting
+	signal.Reset(syscall.SIGINT, syscall.SIGTERM)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	fn.Log(text.Blue("[#] watching ports of the box, press ctrl+c to stop"))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.poll(); err != nil {
+			return fn.NewE(err)
+		}
+
+		select {
+		case <-sigs:
+			return w.stop()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *portWatcher) logEvent(tag string, msg string) {
+	fn.Log(fmt.Sprintf("%s %s %s", text.Blue(time.Now().Format(time.TimeOnly)), tag, msg))
+}
+
+// poll compares ports the box listens on with the last poll, and syncs
+// proxies when ports are exposed or removed by the watcher or kl.yml
+func (w *portWatcher) poll() error {
+	kf, err := w.c.KLFile()
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	listeners, err := w.c.ListeningPorts()
+	if err != nil {
+		// the box may be restarting, ports are detected again once it runs
+		if err.Error() != w.lastErr {
+			fn.Warn(fmt.Sprintf("failed to read ports of the box: %s", err.Error()))
+		}
+		w.lastErr = err.Error()
+		return nil
+	}
+	w.lastErr = ""
+
+	changed := !slices.Equal(w.synced, kf.Ports)
+
+	current := make(map[int]boxpkg.Listener, len(listeners))
+	for _, l := range listeners {
+		current[l.Port] = l
+		if prev, ok := w.seen[l.Port]; ok && prev == l {
+			continue
+		}
+
+		if w.onListen(kf, l) {
+			changed = true
+		}
+	}
+
+	for port := range w.seen {
+		if _, ok := current[port]; ok {
+			continue
+		}
+
+		delete(w.declined, port)
+		i := slices.IndexFunc(w.exposed, func(pm fileclient.PortMapping) bool { return pm.Container == port })
+		if i == -1 {
+			w.logEvent(text.Yellow("[-]"), fmt.Sprintf("port %d stopped listening", port))
+			continue
+		}
+
+		w.logEvent(text.Yellow("[-]"), fmt.Sprintf("port %d stopped listening, no longer exposed on %s", port, w.exposed[i].HostAddress()))
+		w.exposed = slices.Delete(w.exposed, i, i+1)
+		changed = true
+	}
+	w.seen = current
+
+	if !changed {
+		return nil
+	}
+
+	return w.sync(kf)
+}
+
+// onListen reports a new listener, and exposes it when it is allowed and
+// confirmed. it reports whether the watcher exposed it
+func (w *portWatcher) onListen(kf *fileclient.KLFileType, l boxpkg.Listener) bool {
+	if l.Loopback {
+		w.logEvent(text.Blue("[#]"), fmt.Sprintf("port %d only listens on loopback, listen on 0.0.0.0 to expose it", l.Port))
+		return false
+	}
+
+	if i := slices.IndexFunc(kf.Ports, func(pm fileclient.PortMapping) bool {
+		return pm.Container == l.Port && slices.Contains(pm.Protocols(), fileclient.PortProtocolTCP)
+	}); i != -1 {
+		w.logEvent(text.Blue("[#]"), fmt.Sprintf("port %d is listening, exposed on %s by kl.yml", l.Port, kf.Ports[i].HostAddress()))
+		return false
+	}
+
+	if !kf.Expose.Allows(l.Port) {
+		w.logEvent(text.Blue("[#]"), fmt.Sprintf("port %d is listening, not exposed as expose of kl.yml denies it", l.Port))
+		return false
+	}
+
+	// listeners are tcp sockets, so only tcp is exposed
+	pm := fileclient.NewPortMapping(l.Port)
+	pm.Protocol = fileclient.PortProtocolTCP
+	if i := kf.Ports.Index(pm); i != -1 {
+		w.logEvent(text.Blue("[#]"), fmt.Sprintf("port %d is listening, not exposed as port %s of kl.yml uses %s", l.Port, kf.Ports[i], pm.HostAddress()))
+		return false
+	}
+
+	if w.exposed.Index(pm) != -1 || w.declined[l.Port] {
+		return false
+	}
+
+	if !w.yes {
+		fn.Logf("%s port %d is listening, expose it on %s? [Y/n] ", text.Yellow("[?]"), l.Port, pm.HostAddress())
+		if !fn.Confirm("y", "y") {
+			w.declined[l.Port] = true
+			return false
+		}
+	}
+
+	w.exposed = append(w.exposed, pm)
+	w.logEvent(text.Green("[+]"), fmt.Sprintf("port %d is listening, exposed on %s", l.Port, pm.HostAddress()))
+	return true
+}
+
+// sync exposes ports of kl.yml and those exposed by the watcher, ports of
+// the watcher which conflict with kl.yml are dropped
+func (w *portWatcher) sync(kf *fileclient.KLFileType) error {
+	w.exposed = slices.DeleteFunc(w.exposed, func(pm fileclient.PortMapping) bool {
+		if i := kf.Ports.Index(pm); i != -1 {
+			w.logEvent(text.Yellow("[-]"), fmt.Sprintf("port %d is exposed by port %s of kl.yml instead", pm.Container, kf.Ports[i]))
+			return true
+		}
+		return false
+	})
+
+	if err := syncPorts(w.cmd, w.args, boxpkg.ProxyConfig{Watch: true, WatchedPorts: w.exposed}); err != nil {
+		return fn.NewE(err)
+	}
+	w.synced = slices.Clone(kf.Ports)
+
+	return nil
+}
+
+// stop removes ports exposed by the watcher
+func (w *portWatcher) stop() error {
+	if len(w.exposed) == 0 {
+		return nil
+	}
+
+	kf, err := w.c.KLFile()
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	w.exposed = nil
+	return w.sync(kf)
+}
+
+func init() {
+	watchCmd.Flags().BoolP("yes", "y", false, "expose detected ports without asking")
+	watchCmd.Flags().Duration("interval", 2*time.Second, "how often ports of the box are checked")
+	fileclient.OnlyOutsideBox(watchCmd)
+}
@@ -0,0 +1,108 @@
+package images
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/kloudlite/kl/constants"
+	"github.com/kloudlite/kl/flags"
+	containerruntime "github.com/kloudlite/kl/pkg/container-runtime"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/spinner"
+	"github.com/kloudlite/kl/pkg/ui/text"
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "export every image used by this version of kl to a tarball",
+	Long: `export every image used by this version of kl to a tarball
+
+the tarball is loaded with kl images import on machines without access to the registry.
+it is gzip compressed when the file ends with .gz or .tgz.`,
+	Example: `  kl images export
+  kl images export -f kl-images.tar.gz`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := exportImages(cmd); err != nil {
+			fn.PrintError(err)
+			return
+		}
+	},
+}
+
+func exportImages(cmd *cobra.Command) error {
+	out := fn.ParseStringFlag(cmd, "file")
+	if out == "" {
+		out = fmt.Sprintf("kl-images-%s.tar", flags.Version)
+	}
+
+	cli, err := containerruntime.NewClient()
+	if err != nil {
+		return fn.NewE(err)
+	}
+	defer cli.Close()
+
+	refs := constants.GetImageNames()
+	missing := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		ok, err := containerruntime.ImageExists(cmd.Context(), cli, ref)
+		if err != nil {
+			return fn.NewE(err)
+		}
+		if !ok {
+			missing = append(missing, ref)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fn.Errorf("images %s are not present, pull them with kl images pull", strings.Join(missing, ", "))
+	}
+
+	defer spinner.Client.UpdateMessage(fmt.Sprintf("exporting images to %s", out))()
+
+	rc, err := cli.ImageSave(cmd.Context(), refs)
+	if err != nil {
+		return fn.NewE(err, "failed to export images")
+	}
+	defer rc.Close()
+
+	if err := writeTarball(out, rc); err != nil {
+		os.Remove(out)
+		return fn.NewE(err, fmt.Sprintf("failed to write %s", out))
+	}
+
+	fn.Log(text.Green(fmt.Sprintf("exported %d image(s) to %s", len(refs), out)))
+	return nil
+}
+
+func writeTarball(path string, r io.Reader) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if !strings.HasSuffix(path, ".gz") && !strings.HasSuffix(path, ".tgz") {
+		if _, err := io.Copy(f, r); err != nil {
+			return err
+		}
+		return f.Close()
+	}
+
+	gw := gzip.NewWriter(f)
+	if _, err := io.Copy(gw, r); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func init() {
+	exportCmd.Flags().StringP("file", "f", "", "path of the tarball to write, defaults to kl-images-<version>.tar")
+}
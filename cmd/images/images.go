@@ -0,0 +1,24 @@
+package images
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var Cmd = &cobra.Command{
+	Use:   "images",
+	Short: "manage container images used by kl",
+	Long: `manage container images used by kl
+
+kl runs boxes, the k3s cluster, the vpn and port proxies from images, most of them tagged
+with its version. they are pulled when first needed, these commands pull them up front, move them to machines without
+access to the registry and remove images left from previous versions of kl.`,
+}
+
+func init() {
+	Cmd.Aliases = append(Cmd.Aliases, "image")
+
+	Cmd.AddCommand(pullCmd)
+	Cmd.AddCommand(exportCmd)
+	Cmd.AddCommand(importCmd)
+	Cmd.AddCommand(pruneCmd)
+}
@@ -0,0 +1,54 @@
+package images
+
+import (
+	"fmt"
+	"os"
+
+	containerruntime "github.com/kloudlite/kl/pkg/container-runtime"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/spinner"
+	"github.com/kloudlite/kl/pkg/ui/text"
+	"github.com/spf13/cobra"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "import images from a tarball written by kl images export",
+	Example: `  kl images import kl-images-v1.0.0.tar
+  kl images import kl-images.tar.gz`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := importImages(cmd, args[0]); err != nil {
+			fn.PrintError(err)
+			return
+		}
+	},
+}
+
+func importImages(cmd *cobra.Command, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fn.NewE(err)
+	}
+	defer f.Close()
+
+	cli, err := containerruntime.NewClient()
+	if err != nil {
+		return fn.NewE(err)
+	}
+	defer cli.Close()
+
+	defer spinner.Client.UpdateMessage(fmt.Sprintf("importing images from %s", path))()
+
+	loaded, err := containerruntime.LoadImages(cmd.Context(), cli, f)
+	if err != nil {
+		return fn.NewE(err, fmt.Sprintf("failed to import images from %s", path))
+	}
+
+	for _, ref := range loaded {
+		fn.Log(text.Green("[loaded]"), ref)
+	}
+
+	fn.Log(text.Green(fmt.Sprintf("imported %d image(s)", len(loaded))))
+	return nil
+}
@@ -0,0 +1,108 @@
+package images
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/errdefs"
+	"github.com/kloudlite/kl/constants"
+	"github.com/kloudlite/kl/flags"
+	containerruntime "github.com/kloudlite/kl/pkg/container-runtime"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/text"
+	"github.com/spf13/cobra"
+)
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "remove images left from previous versions of kl",
+	Long: `remove images left from previous versions of kl
+
+images of kl tagged with a version other than the current one are removed, images used
+by containers are kept.`,
+	Example: `  kl images prune
+  kl images prune --yes   # remove without confirmation`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := pruneImages(cmd); err != nil {
+			fn.PrintError(err)
+			return
+		}
+	},
+}
+
+// splitRef splits ref into its repo and tag, the port of a registry is not
+// read as tag
+func splitRef(ref string) (string, string) {
+	i := strings.LastIndex(ref, ":")
+	if i == -1 || strings.Contains(ref[i:], "/") {
+		return ref, ""
+	}
+	return ref[:i], ref[i+1:]
+}
+
+func pruneImages(cmd *cobra.Command) error {
+	cli, err := containerruntime.NewClient()
+	if err != nil {
+		return fn.NewE(err)
+	}
+	defer cli.Close()
+
+	images, err := cli.ImageList(cmd.Context(), image.ListOptions{})
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	repos := constants.GetImageRepos()
+	current := constants.GetImageNames()
+
+	stale := make([]string, 0)
+	for _, i := range images {
+		for _, ref := range i.RepoTags {
+			repo, tag := splitRef(ref)
+			if !slices.Contains(repos, repo) || tag == flags.Version || slices.Contains(current, ref) {
+				continue
+			}
+			stale = append(stale, ref)
+		}
+	}
+
+	if len(stale) == 0 {
+		fn.Log(text.Green("no images of previous versions found"))
+		return nil
+	}
+
+	slices.Sort(stale)
+	for _, ref := range stale {
+		fn.Log(text.Yellow("[stale]"), ref)
+	}
+
+	if !fn.ParseBoolFlag(cmd, "yes") {
+		fn.Printf(text.Yellow("remove %d image(s)? (y/N): "), len(stale))
+		if !fn.Confirm("Y", "N") {
+			return nil
+		}
+	}
+
+	var removed int
+	for _, ref := range stale {
+		if _, err := cli.ImageRemove(cmd.Context(), ref, image.RemoveOptions{PruneChildren: true}); err != nil {
+			if errdefs.IsConflict(err) {
+				fn.Warn(fmt.Sprintf("image %s is used by a container, it is kept", ref))
+				continue
+			}
+			return fn.NewE(err, fmt.Sprintf("failed to remove image %s", ref))
+		}
+
+		fn.Log(text.Green("[removed]"), ref)
+		removed++
+	}
+
+	fn.Log(text.Green(fmt.Sprintf("removed %d image(s)", removed)))
+	return nil
+}
+
+func init() {
+	pruneCmd.Flags().BoolP("yes", "y", false, "remove images without confirmation")
+}
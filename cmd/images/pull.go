@@ -0,0 +1,66 @@
+package images
+
+import (
+	"fmt"
+
+	"github.com/kloudlite/kl/constants"
+	containerruntime "github.com/kloudlite/kl/pkg/container-runtime"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/text"
+	"github.com/spf13/cobra"
+)
+
+var pullCmd = &cobra.Command{
+	Use:   "pull",
+	Short: "pull every image used by this version of kl",
+	Long: `pull every image used by this version of kl
+
+images which are already present are skipped, unless --force is set.`,
+	Example: `  kl images pull
+  kl images pull --force   # pull images again even if they are present`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := pullImages(cmd); err != nil {
+			fn.PrintError(err)
+			return
+		}
+	},
+}
+
+func pullImages(cmd *cobra.Command) error {
+	cli, err := containerruntime.NewClient()
+	if err != nil {
+		return fn.NewE(err)
+	}
+	defer cli.Close()
+
+	force := fn.ParseBoolFlag(cmd, "force")
+
+	var pulled int
+	for _, ref := range constants.GetImageNames() {
+		if !force {
+			ok, err := containerruntime.ImageExists(cmd.Context(), cli, ref)
+			if err != nil {
+				return fn.NewE(err)
+			}
+
+			if ok {
+				fn.Log(text.Blue("[present]"), ref)
+				continue
+			}
+		}
+
+		if err := containerruntime.PullImage(cmd.Context(), cli, ref); err != nil {
+			return fn.NewE(err)
+		}
+
+		fn.Log(text.Green("[pulled]"), ref)
+		pulled++
+	}
+
+	fn.Log(text.Green(fmt.Sprintf("pulled %d image(s)", pulled)))
+	return nil
+}
+
+func init() {
+	pullCmd.Flags().Bool("force", false, "pull images even if they are present")
+}
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/kloudlite/kl/cmd/box/boxpkg"
 	"github.com/kloudlite/kl/domain/apiclient"
 	"github.com/kloudlite/kl/domain/fileclient"
 	fn "github.com/kloudlite/kl/pkg/functions"
@@ -47,6 +48,18 @@ func startIntercept(apic apiclient.ApiClient, fc fileclient.FileClient, cmd *cob
 		return err
 	}
 
+	// the box is resolved first, so that no intercept is left applied when
+	// it can't receive intercepted traffic
+	c, err := boxpkg.NewClient(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	targetIP, err := c.InterceptTarget()
+	if err != nil {
+		return err
+	}
+
 	appsList, err := apic.ListApps(accName, currentEnv.Name)
 	if err != nil {
 		return err
@@ -122,7 +135,12 @@ func startIntercept(apic apiclient.ApiClient, fc fileclient.FileClient, cmd *cob
 		return err
 	}
 
-	fn.Log(text.Green(fmt.Sprintf("intercept app port forwarded to localhost:%v", devicePort)))
+	if err := c.TargetIntercepts(targetIP); err != nil {
+		return err
+	}
+	c.RecordEvent(boxpkg.EventInterceptAdded, fmt.Sprintf("%s:%d intercepted to port %d", selectedApp.Name, selectedApp.Port, devicePort))
+
+	fn.Log(text.Green(fmt.Sprintf("intercept app port forwarded to localhost:%v of this box", devicePort)))
 	fn.Log("Please check if vpn is connected to your device, if not please connect it using sudo kl vpn start. Ignore this message if already connected.")
 
 	return nil
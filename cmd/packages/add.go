@@ -8,7 +8,6 @@ import (
 	"github.com/kloudlite/kl/domain/fileclient"
 	"github.com/kloudlite/kl/pkg/functions"
 	fn "github.com/kloudlite/kl/pkg/functions"
-	"github.com/kloudlite/kl/pkg/ui/spinner"
 	"os"
 	"slices"
 
@@ -18,6 +17,10 @@ import (
 var addCmd = &cobra.Command{
 	Use:   "add",
 	Short: "add new package",
+	Example: `  kl pkg add go@1.22           # add go pinned to 1.22
+  kl pkg add go                # select a package and version in fzf
+  kl pkg add go --version latest
+  kl pkg add go --yes          # add the best match with its newest version`,
 	Run: func(cmd *cobra.Command, args []string) {
 		fc, err := fileclient.New()
 		if err != nil {
@@ -56,9 +59,18 @@ func addPackages(apic apiclient.ApiClient, fc fileclient.FileClient, cmd *cobra.
 		return functions.Error("name is required")
 	}
 
-	name, hashpkg, err := Resolve(cmd.Context(), name)
-	if err != nil {
-		return functions.NewE(err)
+	// flakes and .nix files are installed as they are, they are pinned in
+	// kl.lock when the box hash is synced
+	installable := name
+	if !fileclient.IsPackageSource(name) {
+		r, err := newCachedResolver(klConf.PackageResolver)
+		if err != nil {
+			return functions.NewE(err)
+		}
+
+		if name, installable, err = Resolve(cmd.Context(), r, name, klConf.LockPlatforms(), ParseSelection(cmd)); err != nil {
+			return functions.NewE(err)
+		}
 	}
 
 	cwd, err := os.Getwd()
@@ -71,18 +83,15 @@ func addPackages(apic apiclient.ApiClient, fc fileclient.FileClient, cmd *cobra.
 		return functions.NewE(err)
 	}
 
-	spinner.Client.Pause()
-	_, err = fn.Exec(fmt.Sprintf("nix shell nixpkgs/%s --command echo downloaded", hashpkg), nil)
-	if err != nil {
+	if err := c.PrefetchPackages(map[string]string{name: installable}, 1); err != nil {
 		return functions.NewE(err)
 	}
-	spinner.Client.Resume()
 	if slices.Contains(klConf.Packages, name) {
 		return nil
 	}
 
 	klConf.Packages = append(klConf.Packages, name)
-	err = fc.WriteKLFile(*klConf)
+	err = fc.WriteKLFileLayer(fileclient.ParseKLFileLayer(cmd), *klConf)
 	if err != nil {
 		return functions.NewE(err)
 	}
@@ -102,4 +111,6 @@ func addPackages(apic apiclient.ApiClient, fc fileclient.FileClient, cmd *cobra.
 
 func init() {
 	addCmd.Flags().StringP("name", "n", "", "name of the package to install")
+	withSelectionFlags(addCmd)
+	fn.WithKlFileLayer(addCmd)
 }
@@ -0,0 +1,148 @@
+package packages
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"github.com/docker/go-units"
+	"github.com/kloudlite/kl/cmd/box/boxpkg"
+	"github.com/kloudlite/kl/cmd/box/boxpkg/packagectrl"
+	"github.com/kloudlite/kl/domain/envclient"
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/table"
+	"github.com/kloudlite/kl/pkg/ui/text"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+var infoCmd = &cobra.Command{
+	Use:   "info <name>",
+	Short: "show details of a package of kl.lock",
+	Long: `show details of a package of kl.lock
+
+shows the locked version, nixpkgs commit, attr path and store path of the package
+on the current platform, with its summary, and its closure size and binaries when it
+is fetched into the nix store of boxes.`,
+	Example: `  kl pkg info go
+  kl pkg info go@1.22 -o json`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := packageInfo(cmd, args); err != nil {
+			fn.PrintError(err)
+			return
+		}
+	},
+}
+
+// findPackage returns the package of packages matching name, by its name or
+// as it is written in kl.yml
+func findPackage(packages []string, name string) (string, error) {
+	i := slices.IndexFunc(packages, func(p string) bool {
+		n, _ := packagectrl.SplitPackage(p)
+		return p == name || (!fileclient.IsPackageSource(p) && n == name)
+	})
+	if i == -1 {
+		return "", fn.Errorf("package %s is not in kl.yml", name)
+	}
+
+	return packages[i], nil
+}
+
+func packageInfo(cmd *cobra.Command, args []string) error {
+	fc, err := fileclient.New()
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	kf, err := fc.GetKlFile("")
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	pkg, err := findPackage(packagectrl.LockedPackages(*kf), args[0])
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	wpath, err := envclient.GetWorkspacePath()
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	r, err := packagectrl.NewResolver(kf.PackageResolver)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	lf, err := packagectrl.ReadLockfile(wpath)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	c, err := boxpkg.NewClient(cmd, nil)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	run, release, err := c.StoreRunner()
+	if err != nil {
+		return fn.NewE(err)
+	}
+	defer release()
+
+	info, err := packagectrl.Info(cmd.Context(), r, run, lf, pkg, packagectrl.CurrentPlatform(), packagectrl.BoxWorkspacePath)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	switch fn.ParseStringFlag(cmd, "output") {
+	case "json":
+		b, err := json.Marshal(info)
+		if err != nil {
+			return fn.NewE(err)
+		}
+		fn.Println(string(b))
+	case "yaml", "yml":
+		b, err := yaml.Marshal(info)
+		if err != nil {
+			return fn.NewE(err)
+		}
+		fn.Println(string(b))
+	default:
+		printPackageInfo(info)
+	}
+
+	return nil
+}
+
+func printPackageInfo(info *packagectrl.PackageInfo) {
+	kv := func(k, v string) {
+		if v != "" {
+			table.KVOutput(k, v, true)
+		}
+	}
+
+	fn.Println()
+	kv("Package:", info.Package)
+	kv("Version:", info.Version)
+	kv("Summary:", info.Summary)
+	kv("Platform:", info.Platform)
+	kv("Commit:", info.Commit)
+	kv("Attr Path:", info.AttrPath)
+	kv("Source:", info.Source)
+	kv("Store Path:", info.StorePath)
+
+	if !info.Fetched {
+		fn.Log(text.Yellow("[#] package is not fetched into the nix store of boxes, run kl pkg install to fetch it"))
+		return
+	}
+
+	kv("Closure Size:", units.HumanSize(float64(info.ClosureSize)))
+	kv("Binaries:", strings.Join(info.Binaries, ", "))
+}
+
+func init() {
+	fn.WithOutputVariant(infoCmd)
+}
@@ -0,0 +1,90 @@
+package packages
+
+import (
+	"fmt"
+
+	"github.com/kloudlite/kl/cmd/box/boxpkg"
+	"github.com/kloudlite/kl/cmd/box/boxpkg/packagectrl"
+	"github.com/kloudlite/kl/domain/envclient"
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/text"
+	"github.com/spf13/cobra"
+)
+
+var installCmd = &cobra.Command{
+	Use:   "install",
+	Short: "fetch every package of kl.lock into the nix store of boxes",
+	Long: `fetch every package of kl.lock into the nix store of boxes
+
+packages of kl.yml and of all its profiles are locked, then fetched in parallel into
+the nix store shared by boxes, so that boxes start without fetching them. failed
+downloads are retried. packages are fetched the same way whenever a box starts.`,
+	Example: `  kl pkg install        # fetch every package of kl.lock
+  kl pkg install -j 8   # fetch 8 packages at a time`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := installPackages(cmd, args); err != nil {
+			fn.PrintError(err)
+			return
+		}
+	},
+}
+
+func installPackages(cmd *cobra.Command, args []string) error {
+	fc, err := fileclient.New()
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	kf, err := fc.GetKlFile("")
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	wpath, err := envclient.GetWorkspacePath()
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	r, err := packagectrl.NewResolver(kf.PackageResolver)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	pkgs := packagectrl.LockedPackages(*kf)
+	lf, err := packagectrl.Lock(cmd.Context(), r, pkgs, kf.LockPlatforms(), wpath, packagectrl.LockModeAuto)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	installables, err := lf.Installables(pkgs, packagectrl.CurrentPlatform(), packagectrl.BoxWorkspacePath)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	if len(installables) == 0 {
+		fn.Log(text.Yellow("no packages in kl.yml"))
+		return nil
+	}
+
+	c, err := boxpkg.NewClient(cmd, args)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	jobs, err := cmd.Flags().GetInt("jobs")
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	if err := c.PrefetchPackages(installables, jobs); err != nil {
+		return fn.NewE(err)
+	}
+
+	fn.Log(text.Green(fmt.Sprintf("fetched %d package(s)", len(installables))))
+	return nil
+}
+
+func init() {
+	installCmd.Flags().IntP("jobs", "j", packagectrl.DefaultPrefetchJobs, "number of packages to fetch at a time")
+}
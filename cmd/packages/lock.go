@@ -0,0 +1,108 @@
+package packages
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kloudlite/kl/cmd/box/boxpkg/packagectrl"
+	"github.com/kloudlite/kl/domain/envclient"
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/table"
+	"github.com/kloudlite/kl/pkg/ui/text"
+	"github.com/spf13/cobra"
+)
+
+var lockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "lock packages of kl.yml in kl.lock",
+	Long: `lock packages of kl.yml in kl.lock
+
+kl.lock pins every package to a nixpkgs commit, attr path and store path for each
+platform listed in platforms of kl.yml, x86_64-linux and aarch64-linux when it
+lists none. boxes install packages from kl.lock without resolving them
+when they are locked, set KL_LOCK_MODE to offline, update or strict to change how
+kl.lock is synced when boxes start.`,
+	Example: `  kl pkg lock            # resolve packages missing from kl.lock
+  kl pkg lock --offline  # prune kl.lock without resolving, fails if a package is not locked
+  kl pkg lock --update   # resolve every package again
+  kl pkg lock --strict   # fail if kl.yml and kl.lock disagree, e.g. in CI`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := lockPackages(cmd); err != nil {
+			fn.PrintError(err)
+			return
+		}
+	},
+}
+
+func lockPackages(cmd *cobra.Command) error {
+	mode := packagectrl.LockModeAuto
+	for _, m := range []packagectrl.LockMode{packagectrl.LockModeOffline, packagectrl.LockModeUpdate, packagectrl.LockModeStrict} {
+		if fn.ParseBoolFlag(cmd, string(m)) {
+			mode = m
+		}
+	}
+
+	fc, err := fileclient.New()
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	kf, err := fc.GetKlFile("")
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	wpath, err := envclient.GetWorkspacePath()
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	r, err := packagectrl.NewResolver(kf.PackageResolver)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	pkgs := packagectrl.LockedPackages(*kf)
+	platforms := kf.LockPlatforms()
+	lf, err := packagectrl.Lock(cmd.Context(), r, pkgs, platforms, wpath, mode)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	if mode == packagectrl.LockModeStrict {
+		fn.Log(text.Green("kl.lock is in sync with kl.yml"))
+		return nil
+	}
+
+	header := table.Row{table.HeaderText("package"), table.HeaderText("version"), table.HeaderText("platforms"), table.HeaderText("store path")}
+	rows := make([]table.Row, 0, len(pkgs))
+
+	current := packagectrl.CurrentPlatform()
+	slices.Sort(pkgs)
+	for _, p := range pkgs {
+		lp := lf.Packages[p]
+
+		storePath := lp.Systems[current].StorePath
+		if !lp.Complete(platforms) {
+			storePath = fmt.Sprintf("%s %s", storePath, text.Yellow("(incomplete)"))
+		}
+
+		rows = append(rows, table.Row{text.Bold(p), lp.Version, strings.Join(lp.Platforms(), ", "), storePath})
+	}
+
+	fn.Println(table.Table(&header, rows, cmd))
+	table.TotalResults(len(pkgs), true)
+
+	return nil
+}
+
+func init() {
+	lockCmd.Flags().Bool(string(packagectrl.LockModeOffline), false, "lock without resolving packages, fails if a package of kl.yml is not locked")
+	lockCmd.Flags().Bool(string(packagectrl.LockModeUpdate), false, "resolve every package again")
+	lockCmd.Flags().Bool(string(packagectrl.LockModeStrict), false, "fail if kl.yml and kl.lock disagree, kl.lock is not written")
+	lockCmd.MarkFlagsMutuallyExclusive(string(packagectrl.LockModeOffline), string(packagectrl.LockModeUpdate), string(packagectrl.LockModeStrict))
+
+	fn.WithOutputVariant(lockCmd)
+}
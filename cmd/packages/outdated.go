@@ -0,0 +1,86 @@
+package packages
+
+import (
+	"github.com/kloudlite/kl/cmd/box/boxpkg/packagectrl"
+	"github.com/kloudlite/kl/domain/envclient"
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/table"
+	"github.com/kloudlite/kl/pkg/ui/text"
+	"github.com/spf13/cobra"
+)
+
+var outdatedCmd = &cobra.Command{
+	Use:   "outdated",
+	Short: "list packages of kl.lock which have newer versions",
+	Long: `list packages of kl.lock which have newer versions
+
+wanted is the newest version of the locked major version, which kl pkg upgrade
+upgrades to, latest is the newest version, which kl pkg upgrade --major upgrades to.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := listOutdated(cmd); err != nil {
+			fn.PrintError(err)
+			return
+		}
+	},
+}
+
+func listOutdated(cmd *cobra.Command) error {
+	fc, err := fileclient.New()
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	kf, err := fc.GetKlFile("")
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	wpath, err := envclient.GetWorkspacePath()
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	r, err := packagectrl.NewResolver(kf.PackageResolver)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	lf, err := packagectrl.ReadLockfile(wpath)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	outdated := packagectrl.CheckOutdated(cmd.Context(), r, lf, kf.Packages, kf.LockPlatforms())
+
+	header := table.Row{table.HeaderText("package"), table.HeaderText("current"), table.HeaderText("wanted"), table.HeaderText("latest")}
+	rows := make([]table.Row, 0, len(outdated))
+	for _, o := range outdated {
+		if !o.IsOutdated() {
+			continue
+		}
+
+		wanted, latest := o.Wanted, o.Latest
+		if wanted != o.Current {
+			wanted = text.Green(wanted)
+		}
+		if latest != o.Wanted {
+			latest = text.Yellow(latest)
+		}
+
+		rows = append(rows, table.Row{text.Bold(o.Package), o.Current, wanted, latest})
+	}
+
+	if len(rows) == 0 && fn.ParseStringFlag(cmd, "output") == "table" {
+		fn.Log(text.Green("all packages are up to date"))
+		return nil
+	}
+
+	fn.Println(table.Table(&header, rows, cmd))
+
+	return nil
+}
+
+func init() {
+	fn.WithOutputVariant(outdatedCmd)
+}
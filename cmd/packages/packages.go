@@ -25,4 +25,10 @@ func init() {
 	Cmd.AddCommand(rmCmd)
 	fileclient.OnlyInsideBox(searchCmd)
 	Cmd.AddCommand(searchCmd)
+	Cmd.AddCommand(lockCmd)
+	Cmd.AddCommand(outdatedCmd)
+	Cmd.AddCommand(upgradeCmd)
+	Cmd.AddCommand(installCmd)
+	Cmd.AddCommand(infoCmd)
+	Cmd.AddCommand(whichCmd)
 }
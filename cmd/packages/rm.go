@@ -58,7 +58,7 @@ func rmPackages(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	if err = fc.WriteKLFile(*klConf); err != nil {
+	if err = fc.WriteKLFileLayer(fileclient.ParseKLFileLayer(cmd), *klConf); err != nil {
 		return fn.NewE(err)
 	}
 
@@ -87,4 +87,5 @@ func rmPackages(cmd *cobra.Command, args []string) error {
 
 func init() {
 	rmCmd.Flags().StringP("name", "n", "", "name of the package to remove")
+	fn.WithKlFileLayer(rmCmd)
 }
@@ -34,9 +34,12 @@ func searchPackages(cmd *cobra.Command, args []string) error {
 		return functions.Error("name is required")
 	}
 
-	defer spinner.Client.UpdateMessage(fmt.Sprintf("searching for package %s", name))()
+	r, err := newResolver()
+	if err != nil {
+		return functions.NewE(err)
+	}
 
-	sr, err := Search(cmd.Context(), name)
+	sr, err := Search(cmd.Context(), r, name)
 	if err != nil {
 		return functions.NewE(err)
 	}
@@ -46,7 +49,7 @@ func searchPackages(cmd *cobra.Command, args []string) error {
 	header := table.Row{table.HeaderText("#"), table.HeaderText("name"), table.HeaderText("versions")}
 	rows := make([]table.Row, 0)
 
-	for i, p := range sr.Packages {
+	for i, p := range sr {
 		versions := make([]string, 0)
 		for j, v := range p.Versions {
 			if j >= 10 {
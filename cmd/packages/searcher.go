@@ -2,165 +2,187 @@ package packages
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/kloudlite/kl/pkg/ui/fzf"
-	"github.com/kloudlite/kl/pkg/ui/spinner"
-	"io"
-	"net/http"
-	"net/url"
 	"os"
 	"strings"
 
+	"github.com/kloudlite/kl/cmd/box/boxpkg/packagectrl"
+	"github.com/kloudlite/kl/domain/fileclient"
+	"github.com/kloudlite/kl/pkg/ui/fzf"
+	"github.com/kloudlite/kl/pkg/ui/spinner"
+
 	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
-type PackageInfo struct {
-	ID           int      `json:"id"`
-	CommitHash   string   `json:"commit_hash"`
-	System       string   `json:"system"`
-	LastUpdated  int      `json:"last_updated"`
-	StoreHash    string   `json:"store_hash"`
-	StoreName    string   `json:"store_name"`
-	StoreVersion string   `json:"store_version"`
-	MetaName     string   `json:"meta_name"`
-	MetaVersion  []string `json:"meta_version"`
-	AttrPaths    []string `json:"attr_paths"`
-	Version      string   `json:"version"`
-	Summary      string   `json:"summary"`
-}
+// newResolver returns the package resolver selected in kl.yml
+func newResolver() (packagectrl.Resolver, error) {
+	fc, err := fileclient.New()
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
 
-type PackageVersion struct {
-	PackageInfo
+	kf, err := fc.GetKlFile("")
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
 
-	Name    string                 `json:"name"`
-	Systems map[string]PackageInfo `json:"systems,omitempty"`
+	return newCachedResolver(kf.PackageResolver)
 }
 
-type Package struct {
-	Name        string           `json:"name"`
-	NumVersions int              `json:"num_versions"`
-	Versions    []PackageVersion `json:"versions,omitempty"`
-}
+// newCachedResolver returns the resolver of cfg with its results cached for
+// the ttl set by KL_PACKAGE_CACHE_TTL
+func newCachedResolver(cfg *fileclient.KLPackageResolver) (packagectrl.Resolver, error) {
+	ttl, err := packagectrl.CacheTTLFromEnv()
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
 
-type SearchResults struct {
-	NumResults int       `json:"num_results"`
-	Packages   []Package `json:"packages,omitempty"`
+	return packagectrl.NewCachedResolver(cfg, ttl)
 }
 
-const searchAPIEndpoint = "https://search.devbox.sh"
-
-func Search(ctx context.Context, query string) (*SearchResults, error) {
+func Search(ctx context.Context, r packagectrl.Resolver, query string) ([]packagectrl.SearchResult, error) {
 	if query == "" {
 		return nil, fn.Errorf("query should not be empty")
 	}
-	defer spinner.Client.UpdateMessage(fmt.Sprintf("searching for package %s", query))()
+	defer spinner.Client.UpdateMessage(fmt.Sprintf("searching for package %s with %s", query, r.Name()))()
 
-	endpoint, err := url.JoinPath(searchAPIEndpoint, "v1/search")
+	sr, err := r.Search(ctx, query)
 	if err != nil {
-		if errors.Is(err, ErrNotFound) {
+		if errors.Is(err, packagectrl.ErrNotFound) {
 			return nil, fn.Errorf("package %s not found", query)
 		}
 
 		return nil, fn.NewE(err)
 	}
-	url := endpoint + "?q=" + url.QueryEscape(query)
 
-	return caller[SearchResults](ctx, url)
+	return sr, nil
 }
 
-func Resolve(ctx context.Context, pname string) (string, string, error) {
-	var name string
-	var v string
-	if !strings.Contains(pname, "@") {
-		sr, err := Search(ctx, pname)
-		if err != nil {
-			return "", "", fn.NewE(err)
-		}
-
-		pkg, err := fzf.FindOne(sr.Packages, func(item Package) string {
-			return item.Name
-		}, fzf.WithPrompt("select a package"))
+// Selection chooses a package of search results without prompting, Yes
+// selects the best match with its newest version and Version selects the
+// version of the package named as it is searched
+type Selection struct {
+	Yes     bool
+	Version string
+}
 
-		if err != nil {
-			return "", "", fn.NewE(err)
-		}
+// ParseSelection returns the selection set by flags added with
+// withSelectionFlags
+func ParseSelection(cmd *cobra.Command) Selection {
+	return Selection{Yes: fn.ParseBoolFlag(cmd, "yes"), Version: fn.ParseStringFlag(cmd, "version")}
+}
 
-		version, err := fzf.FindOne(pkg.Versions, func(item PackageVersion) string {
-			return fmt.Sprintf("%s %s", item.Version, item.Summary)
-		}, fzf.WithPrompt("select a version"))
+func withSelectionFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolP("yes", "y", false, "select the best matching package and its newest version without prompting")
+	cmd.Flags().String("version", "", "version of the package to select without prompting, latest selects the newest version")
+}
 
-		if err != nil {
-			return "", "", fn.NewE(err)
+// Resolve returns name@version of pname and its flake installable on the
+// current platform, the package and version are selected interactively when
+// pname has no version unless sel chooses them. it fails when pname is not
+// available for one of platforms
+func Resolve(ctx context.Context, r packagectrl.Resolver, pname string, platforms []string, sel Selection) (string, string, error) {
+	name, v, ok := strings.Cut(pname, "@")
+	switch {
+	case ok:
+		if strings.TrimSpace(name) == "" || strings.TrimSpace(v) == "" {
+			return "", "", fn.Errorf("package %s is invalid", pname)
 		}
-		name = version.Name
-		v = version.Version
-	} else {
-		splits := strings.Split(name, "@")
-
-		if strings.TrimSpace(splits[0]) == "" || strings.TrimSpace(splits[1]) == "" {
-			return "", "", fn.Errorf("package %s is invalid", name)
+	case sel.Version != "":
+		v = sel.Version
+	default:
+		var err error
+		if name, v, err = selectPackage(ctx, r, pname, sel); err != nil {
+			return "", "", fn.NewE(err)
 		}
-		name = splits[0]
-		v = splits[1]
 	}
 
-	type System struct {
-		AttrPaths []string `json:"attr_paths"`
+	defer spinner.Client.UpdateMessage(fmt.Sprintf("resolving package %s@%s with %s", name, v, r.Name()))()
+
+	lp, err := packagectrl.ResolveVersion(ctx, r, name, v, platforms)
+	if err != nil {
+		return "", "", fn.NewE(err)
 	}
 
-	type Res struct {
-		CommitHash string            `json:"commit_hash"`
-		Version    string            `json:"version"`
-		Systems    map[string]System `json:"systems"`
+	installable, err := lp.Installable(packagectrl.CurrentPlatform())
+	if err != nil {
+		return "", "", fn.NewE(err, fmt.Sprintf("failed to resolve package %s", name))
 	}
 
-	platform := os.Getenv("PLATFORM_ARCH") + "-linux"
-	sr, err := caller[Res](ctx, fmt.Sprintf("%s/v1/resolve?name=%s&version=%s&platform=%s", searchAPIEndpoint, name, v, platform))
+	return fmt.Sprintf("%s@%s", name, lp.Version), installable, nil
+}
 
+// selectPackage searches query and returns the name and version of the
+// package selected in fzf, or by sel. without a terminal to prompt on it
+// fails with the candidates
+func selectPackage(ctx context.Context, r packagectrl.Resolver, query string, sel Selection) (string, string, error) {
+	sr, err := Search(ctx, r, query)
 	if err != nil {
-		if errors.Is(err, ErrNotFound) {
-			return "", "", fn.Errorf("package %s not found", name)
-		}
 		return "", "", fn.NewE(err)
 	}
 
-	return fmt.Sprintf("%s@%s", name, sr.Version), fmt.Sprintf("%s#%s", sr.CommitHash, sr.Systems[platform].AttrPaths[0]), nil
-}
+	if len(sr) == 0 {
+		return "", "", fn.Errorf("package %s not found", query)
+	}
 
-var ErrNotFound = fn.Error("not found")
+	if sel.Yes {
+		pkg := sr[0]
+		for _, p := range sr {
+			if p.Name == query {
+				pkg = p
+				break
+			}
+		}
 
-func caller[T any](ctx context.Context, url string) (*T, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return nil, fn.Errorf("GET %s: %w", url, err)
+		if len(pkg.Versions) == 0 {
+			return pkg.Name, "latest", nil
+		}
+		return pkg.Name, pkg.Versions[0].Version, nil
 	}
-	response, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fn.Errorf("GET %s: %w", url, err)
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", "", fn.Errorf("package %s needs to be selected, pass name@version, --version or --yes to select it without a terminal. candidates are:\n  %s", query, strings.Join(candidates(sr, 10), "\n  "))
 	}
-	defer response.Body.Close()
-	data, err := io.ReadAll(response.Body)
 
+	pkg, err := fzf.FindOne(sr, func(item packagectrl.SearchResult) string {
+		return item.Name
+	}, fzf.WithPrompt("select a package"))
 	if err != nil {
-		return nil, fn.Errorf("GET %s: read respoonse body: %w", url, err)
+		return "", "", fn.NewE(err)
 	}
 
-	if response.StatusCode == 404 {
-		return nil, ErrNotFound
+	version, err := fzf.FindOne(pkg.Versions, func(item packagectrl.SearchVersion) string {
+		return fmt.Sprintf("%s %s", item.Version, item.Summary)
+	}, fzf.WithPrompt("select a version"))
+	if err != nil {
+		return "", "", fn.NewE(err)
 	}
 
-	if response.StatusCode >= 400 {
-		return nil, fn.Errorf("GET %s: unexpected status code %s: %s",
-			url,
-			response.Status,
-			data,
-		)
-	}
-	var result T
-	if err := json.Unmarshal(data, &result); err != nil {
-		return nil, fn.Errorf("GET %s: unmarshal response JSON: %w", url, err)
+	return pkg.Name, version.Version, nil
+}
+
+// candidates lists at most n search results with their newest versions
+func candidates(sr []packagectrl.SearchResult, n int) []string {
+	resp := make([]string, 0, n)
+	for i, p := range sr {
+		if i == n {
+			resp = append(resp, fmt.Sprintf("... and %d more, see kl pkg search", len(sr)-n))
+			break
+		}
+
+		versions := make([]string, 0, 3)
+		for j, v := range p.Versions {
+			if j == 3 {
+				break
+			}
+			versions = append(versions, v.Version)
+		}
+
+		resp = append(resp, fmt.Sprintf("%s (%s)", p.Name, strings.Join(versions, ", ")))
 	}
-	return &result, nil
+
+	return resp
 }
@@ -0,0 +1,153 @@
+package packages
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/kloudlite/kl/cmd/box/boxpkg"
+	"github.com/kloudlite/kl/cmd/box/boxpkg/hashctrl"
+	"github.com/kloudlite/kl/cmd/box/boxpkg/packagectrl"
+	"github.com/kloudlite/kl/domain/apiclient"
+	"github.com/kloudlite/kl/domain/envclient"
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/text"
+	"github.com/spf13/cobra"
+)
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade [name...]",
+	Short: "upgrade packages of kl.yml and kl.lock to newer versions",
+	Long: `upgrade packages of kl.yml and kl.lock to newer versions
+
+packages are upgraded to the newest version of their locked major version, or to
+the newest version with --major. versions in kl.yml are rewritten with the same
+precision they are pinned with, go@1.22 is upgraded to go@1.23.`,
+	Example: `  kl pkg upgrade             # upgrade every package within its major version
+  kl pkg upgrade go nodejs   # upgrade go and nodejs
+  kl pkg upgrade --major     # upgrade every package to its newest version`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := upgradePackages(cmd, args); err != nil {
+			fn.PrintError(err)
+			return
+		}
+	},
+}
+
+func upgradePackages(cmd *cobra.Command, args []string) error {
+	fc, err := fileclient.New()
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	apic, err := apiclient.New()
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	kf, err := fc.GetKlFile("")
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	wpath, err := envclient.GetWorkspacePath()
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	r, err := packagectrl.NewResolver(kf.PackageResolver)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	targets := make([]string, 0, len(kf.Packages))
+	for _, name := range args {
+		i := slices.IndexFunc(kf.Packages, func(p string) bool {
+			n, _ := packagectrl.SplitPackage(p)
+			return p == name || n == name
+		})
+		if i == -1 {
+			return fn.Errorf("package %s is not in kl.yml", name)
+		}
+		// the same package can be named more than once, e.g. go and go@1.22
+		if !slices.Contains(targets, kf.Packages[i]) {
+			targets = append(targets, kf.Packages[i])
+		}
+	}
+	if len(args) == 0 {
+		targets = kf.Packages
+	}
+
+	c, err := boxpkg.NewClient(cmd, args)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	// kl.lock is synced first, so that every target is locked
+	lf, err := packagectrl.Lock(cmd.Context(), r, packagectrl.LockedPackages(*kf), kf.LockPlatforms(), wpath, packagectrl.LockModeAuto)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	major := fn.ParseBoolFlag(cmd, "major")
+	installables := make(map[string]string, len(targets))
+	for _, o := range packagectrl.CheckOutdated(cmd.Context(), r, lf, targets, kf.LockPlatforms()) {
+		pkg, lp := o.Upgrade(major)
+		if pkg == o.Package && lp.Version == o.Current {
+			continue
+		}
+
+		i := slices.Index(kf.Packages, o.Package)
+		if i == -1 {
+			continue
+		}
+
+		installable, err := lp.Installable(packagectrl.CurrentPlatform())
+		if err != nil {
+			return fn.NewE(err, fmt.Sprintf("failed to upgrade package %s", o.Package))
+		}
+		installables[pkg] = installable
+
+		kf.Packages[i] = pkg
+		delete(lf.Packages, o.Package)
+		lf.Packages[pkg] = lp
+
+		fn.Log(text.Blue("[upgrade]"), fmt.Sprintf("%s (%s) -> %s (%s)", o.Package, o.Current, text.Bold(pkg), text.Green(lp.Version)))
+	}
+
+	if len(installables) == 0 {
+		fn.Log(text.Green("all packages are up to date"))
+		return nil
+	}
+
+	if err := c.PrefetchPackages(installables, packagectrl.DefaultPrefetchJobs); err != nil {
+		return fn.NewE(err)
+	}
+
+	if err := lf.Write(wpath); err != nil {
+		return fn.NewE(err)
+	}
+
+	if err := fc.WriteKLFileLayer(fileclient.ParseKLFileLayer(cmd), *kf); err != nil {
+		return fn.NewE(err)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	if err := hashctrl.SyncBoxHash(apic, fc, cwd); err != nil {
+		return fn.NewE(err)
+	}
+
+	fn.Log(text.Green(fmt.Sprintf("upgraded %d package(s)", len(installables))))
+
+	return c.ConfirmBoxRestart()
+}
+
+func init() {
+	upgradeCmd.Flags().Bool("major", false, "upgrade to the newest version even if its major version differs")
+	fn.WithKlFileLayer(upgradeCmd)
+}
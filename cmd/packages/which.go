@@ -0,0 +1,78 @@
+package packages
+
+import (
+	"fmt"
+
+	"github.com/kloudlite/kl/cmd/box/boxpkg"
+	"github.com/kloudlite/kl/cmd/box/boxpkg/packagectrl"
+	"github.com/kloudlite/kl/domain/envclient"
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/text"
+	"github.com/spf13/cobra"
+)
+
+var whichCmd = &cobra.Command{
+	Use:   "which <binary>",
+	Short: "show which package of kl.lock provides a binary",
+	Long: `show which package of kl.lock provides a binary
+
+packages of kl.yml and of all its profiles are looked up in the nix store of boxes,
+packages which are not fetched yet are not found, run kl pkg install to fetch them.`,
+	Example: `  kl pkg which gofmt`,
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := whichPackage(cmd, args); err != nil {
+			fn.PrintError(err)
+			return
+		}
+	},
+}
+
+func whichPackage(cmd *cobra.Command, args []string) error {
+	fc, err := fileclient.New()
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	kf, err := fc.GetKlFile("")
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	wpath, err := envclient.GetWorkspacePath()
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	lf, err := packagectrl.ReadLockfile(wpath)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	c, err := boxpkg.NewClient(cmd, nil)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	run, release, err := c.StoreRunner()
+	if err != nil {
+		return fn.NewE(err)
+	}
+	defer release()
+
+	pkgs, err := packagectrl.Which(cmd.Context(), run, lf, packagectrl.LockedPackages(*kf), packagectrl.CurrentPlatform(), packagectrl.BoxWorkspacePath, args[0])
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	if len(pkgs) == 0 {
+		return fn.Errorf("%s is not provided by any fetched package of kl.yml", args[0])
+	}
+
+	for _, p := range pkgs {
+		fn.Println(fmt.Sprintf("%s %s", text.Bold(args[0]), text.Blue(p)))
+	}
+
+	return nil
+}
@@ -233,7 +233,7 @@ func selectAndAddConfig(cmd *cobra.Command, args []string) error {
 
 	klFile.EnvVars.AddResTypes(currConfigs, fileclient.Res_config)
 
-	err = fc.WriteKLFile(*klFile)
+	err = fc.WriteKLFileLayer(fileclient.ParseKLFileLayer(cmd), *klFile)
 	if err != nil {
 		return fn.NewE(err)
 	}
@@ -280,4 +280,5 @@ func init() {
 	confCmd.Flags().StringP("name", "n", "", "config name")
 	confCmd.Aliases = append(confCmd.Aliases, "conf")
 	fn.WithKlFile(confCmd)
+	fn.WithKlFileLayer(confCmd)
 }
@@ -111,7 +111,7 @@ func AddMres(apic apiclient.ApiClient, fc fileclient.FileClient, cmd *cobra.Comm
 	}
 
 	kt.EnvVars.AddResTypes(currMreses, fileclient.Res_mres)
-	if err := fc.WriteKLFile(*kt); err != nil {
+	if err := fc.WriteKLFileLayer(fileclient.ParseKLFileLayer(cmd), *kt); err != nil {
 		return fn.NewE(err)
 	}
 
@@ -165,6 +165,7 @@ func selectMres(apic apiclient.ApiClient, fc fileclient.FileClient) (*apiclient.
 func init() {
 	mresCmd.Aliases = append(mresCmd.Aliases, "res", "managed-resources", "mreses")
 	fn.WithKlFile(mresCmd)
+	fn.WithKlFileLayer(mresCmd)
 }
 
 func selectMresKey(apic apiclient.ApiClient, fc fileclient.FileClient, secretName string) (*string, error) {
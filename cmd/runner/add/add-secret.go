@@ -209,7 +209,7 @@ func selectAndAddSecret(cmd *cobra.Command, args []string) error {
 	}
 
 	klFile.EnvVars.AddResTypes(currSecs, fileclient.Res_secret)
-	err = fc.WriteKLFile(*klFile)
+	err = fc.WriteKLFileLayer(fileclient.ParseKLFileLayer(cmd), *klFile)
 	if err != nil {
 		return functions.NewE(err)
 	}
@@ -249,4 +249,5 @@ func init() {
 
 	secCmd.Aliases = append(secCmd.Aliases, "sec")
 	fn.WithKlFile(secCmd)
+	fn.WithKlFileLayer(secCmd)
 }
@@ -72,7 +72,7 @@ func addEnvvar(cmd *cobra.Command, args []string) error {
 		kt.EnvVars = append(kt.EnvVars, newEnv)
 	}
 
-	if err = fc.WriteKLFile(*kt); err != nil {
+	if err = fc.WriteKLFileLayer(fileclient.ParseKLFileLayer(cmd), *kt); err != nil {
 		return fn.NewE(err)
 	}
 
@@ -101,4 +101,5 @@ func addEnvvar(cmd *cobra.Command, args []string) error {
 
 func init() {
 	envvarCommand.Aliases = append(envvarCommand.Aliases, "envvars", "envar")
+	fn.WithKlFileLayer(envvarCommand)
 }
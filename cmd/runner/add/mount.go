@@ -227,7 +227,7 @@ func selectConfigMount(apic apiclient.ApiClient, fc fileclient.FileClient, klFil
 	}
 
 	klFile.Mounts.AddMounts(fe)
-	if err := fc.WriteKLFile(klFile); err != nil {
+	if err := fc.WriteKLFileLayer(fileclient.ParseKLFileLayer(cmd), klFile); err != nil {
 		return fn.NewE(err)
 	}
 
@@ -258,4 +258,5 @@ func init() {
 	mountCommand.Flags().StringP("config", "", "", "config name")
 	mountCommand.Flags().StringP("secret", "", "", "secret name")
 	fn.WithKlFile(mountCommand)
+	fn.WithKlFileLayer(mountCommand)
 }
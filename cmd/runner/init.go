@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"slices"
 
 	"github.com/kloudlite/kl/cmd/box/boxpkg"
 	"github.com/kloudlite/kl/cmd/box/boxpkg/hashctrl"
@@ -41,7 +42,22 @@ var InitCommand = &cobra.Command{
 			return
 		}
 
-		if _, err = fc.GetKlFile(""); err == nil {
+		var dc *fileclient.DevContainer
+		if cmd.Flags().Changed("from-devcontainer") {
+			p, err := fileclient.FindDevContainerFile(fn.ParseStringFlag(cmd, "from-devcontainer"))
+			if err != nil {
+				fn.PrintError(err)
+				return
+			}
+
+			if dc, err = fileclient.ReadDevContainer(p); err != nil {
+				fn.PrintError(err)
+				return
+			}
+		}
+
+		var verrs fileclient.ValidationErrors
+		if _, err = fc.GetKlFile(""); err == nil || errors.As(err, &verrs) {
 			fn.Printf(text.Yellow("workspace is already initilized. Do you want to override? (y/N): "))
 			if !fn.Confirm("Y", "N") {
 				return
@@ -62,10 +78,13 @@ var InitCommand = &cobra.Command{
 				newKlFile := fileclient.KLFileType{
 					TeamName:   *selectedTeam,
 					DefaultEnv: *selectedEnv,
-					Version:    "v1",
+					Version:    fileclient.KLFileLatestVersion,
 					Packages:   []string{"neovim", "git"},
 				}
-				if err := fc.WriteKLFile(newKlFile); err != nil {
+				if dc != nil {
+					newKlFile = fromDevContainer(newKlFile, dc)
+				}
+				if err := fc.CreateKLFile(newKlFile); err != nil {
 					fn.PrintError(err)
 				} else {
 					fn.Printf(text.Green("workspace initialized successfully.\n"))
@@ -98,6 +117,25 @@ var InitCommand = &cobra.Command{
 	},
 }
 
+// fromDevContainer adds env vars, ports and packages of dc to kf, parts of
+// dc which can't be translated are reported as warnings
+func fromDevContainer(kf fileclient.KLFileType, dc *fileclient.DevContainer) fileclient.KLFileType {
+	dkf, warns := dc.KLFile()
+	for _, w := range warns {
+		fn.Warn(w)
+	}
+
+	for _, p := range dkf.Packages {
+		if !slices.Contains(kf.Packages, p) {
+			kf.Packages = append(kf.Packages, p)
+		}
+	}
+	kf.EnvVars = dkf.EnvVars
+	kf.Ports = dkf.Ports
+
+	return kf
+}
+
 func selectTeam(apic apiclient.ApiClient) (*string, error) {
 	if teams, err := apic.ListTeams(); err == nil {
 		if selectedTeam, err := fzf.FindOne(
@@ -151,4 +189,6 @@ func selectEnv(apic apiclient.ApiClient, fc fileclient.FileClient, teamName stri
 func init() {
 	InitCommand.Flags().StringP("team", "a", "", "team name")
 	InitCommand.Flags().StringP("file", "f", "", "file name")
+	InitCommand.Flags().String("from-devcontainer", "", "translate env, ports and features of devcontainer.json into kl.yml")
+	InitCommand.Flags().Lookup("from-devcontainer").NoOptDefVal = fileclient.DevContainerFile
 }
@@ -0,0 +1,88 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/text"
+
+	"github.com/spf13/cobra"
+)
+
+var ValidateCommand = &cobra.Command{
+	Use:   "validate",
+	Short: "validate kl-config file",
+	Long:  `use this command to validate your kl-config file against its schema and list every problem found with its line and column`,
+	Example: `
+  kl validate			# validate kl.yml of current workspace
+  kl validate -k path/to/kl.yml	# validate provided kl-config file
+
+  kl.local.yml and files listed in KLCONFIG_OVERLAYS are validated as well
+	`,
+	Run: func(cmd *cobra.Command, _ []string) {
+		if err := validateKlFile(cmd); err != nil {
+			fn.PrintError(err)
+			return
+		}
+	},
+}
+
+func validateKlFile(cmd *cobra.Command) error {
+	fc, err := fileclient.New()
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	filePath := fn.ParseKlFile(cmd)
+
+	verrs, err := fc.ValidateKlFile(filePath)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	name := filePath
+	if name == "" {
+		name = "kl.yml"
+	}
+
+	problems := printValidationErrors(name, verrs)
+
+	for _, p := range fileclient.KLFileOverlayPaths(filePath) {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return fn.NewE(err, fmt.Sprintf("failed to read kl file overlay %s", p))
+		}
+
+		verrs, err := fileclient.ValidateKLFileOverlayContent(b)
+		if err != nil {
+			return fn.NewE(err)
+		}
+
+		problems += printValidationErrors(p, verrs)
+	}
+
+	if problems > 0 {
+		return fn.Errorf("found %d problem(s)", problems)
+	}
+
+	return nil
+}
+
+func printValidationErrors(name string, verrs fileclient.ValidationErrors) int {
+	if len(verrs) == 0 {
+		fn.Log(text.Green(fmt.Sprintf("%s is valid", name)))
+		return 0
+	}
+
+	for _, ve := range verrs {
+		fn.Logf("%s %s %s\n", text.Yellow(fmt.Sprintf("%s:%d:%d", name, ve.Line, ve.Column)), text.Bold(ve.Field), ve.Message)
+	}
+
+	return len(verrs)
+}
+
+func init() {
+	fn.WithKlFile(ValidateCommand)
+}
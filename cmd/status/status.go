@@ -58,7 +58,13 @@ var Cmd = &cobra.Command{
 		e, err := apic.EnsureEnv()
 		if err == nil {
 			fn.Log(fmt.Sprint(text.Bold(text.Blue("Environment: ")), e.Name))
-		} else if errors.Is(err, fileclient.NoEnvSelected) {
+		}
+
+		if profile := fileclient.ResolveProfile(e); profile != "" {
+			fn.Log(fmt.Sprint(text.Bold(text.Blue("Profile: ")), profile))
+		}
+
+		if err != nil && errors.Is(err, fileclient.NoEnvSelected) {
 			filePath := fn.ParseKlFile(cmd)
 			klFile, err := fc.GetKlFile(filePath)
 			if err != nil {
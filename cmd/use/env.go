@@ -54,7 +54,7 @@ func switchEnv(cmd *cobra.Command, args []string) error {
 
 	if klFile.DefaultEnv == "" {
 		klFile.DefaultEnv = env.Metadata.Name
-		if err := fc.WriteKLFile(*klFile); err != nil {
+		if err := fc.WriteKLFileLayer(fileclient.ParseKLFileLayer(cmd), *klFile); err != nil {
 			return err
 		}
 	}
@@ -87,6 +87,7 @@ func init() {
 
 	switchCmd.Flags().StringP("envname", "e", "", "environment name")
 	switchCmd.Flags().StringP("team", "a", "", "team name")
+	fn.WithKlFileLayer(switchCmd)
 }
 
 func selectEnv(apic apiclient.ApiClient, fc fileclient.FileClient) (*apiclient.Env, error) {
@@ -6,9 +6,10 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/network"
-	dockerclient "github.com/docker/docker/client"
+	"github.com/kloudlite/kl/constants"
 	"github.com/kloudlite/kl/domain/fileclient"
 	"github.com/kloudlite/kl/k3s"
+	containerruntime "github.com/kloudlite/kl/pkg/container-runtime"
 	fn "github.com/kloudlite/kl/pkg/functions"
 	"github.com/kloudlite/kl/pkg/ui/text"
 	"github.com/spf13/cobra"
@@ -16,8 +17,7 @@ import (
 )
 
 const (
-	wireguardImageName = "ghcr.io/kloudlite/hub/wireguard:latest"
-	CONT_MARK_KEY      = "kl.container"
+	CONT_MARK_KEY = "kl.container"
 )
 
 var startCmd = &cobra.Command{
@@ -25,14 +25,14 @@ var startCmd = &cobra.Command{
 	Short: "start vpn",
 	Long:  `start vpn`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := startVPN(); err != nil {
+		if err := startVPN(cmd); err != nil {
 			fn.PrintError(err)
 			return
 		}
 	},
 }
 
-func startVPN() error {
+func startVPN(cmd *cobra.Command) error {
 	fc, err := fileclient.New()
 	if err != nil {
 		return fn.NewE(err)
@@ -70,7 +70,7 @@ func startVPN() error {
 	//	return fn.Errorf(errBuf.String())
 	//}
 
-	if err := startWireguard(wgConfig, false); err != nil {
+	if err := startWireguard(cmd, wgConfig, false); err != nil {
 		return err
 	}
 
@@ -79,17 +79,25 @@ func startVPN() error {
 	return nil
 }
 
-func startWireguard(wgConfig string, stopWg bool) error {
-	k3sClient, err := k3s.NewClient()
+func startWireguard(cmd *cobra.Command, wgConfig string, stopWg bool) error {
+	rt, err := containerruntime.Get()
+	if err != nil {
+		return err
+	}
+	if err := containerruntime.RequirePrivileged(rt, "the vpn"); err != nil {
+		return err
+	}
+
+	k3sClient, err := k3s.NewClient(cmd)
 	if err != nil {
 		return err
 	}
 
-	if err := k3sClient.EnsureImage(wireguardImageName); err != nil {
+	if err := k3sClient.EnsureImage(constants.VpnImage); err != nil {
 		return err
 	}
 
-	dockerClient, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation())
+	dockerClient, err := containerruntime.NewClient()
 	if err != nil {
 		return err
 	}
@@ -138,7 +146,7 @@ func startWireguard(wgConfig string, stopWg bool) error {
 			CONT_MARK_KEY: "true",
 			"kl-wg":       "true",
 		},
-		Image: wireguardImageName,
+		Image: constants.VpnImage,
 		Cmd: []string{
 			"sh",
 			"-c",
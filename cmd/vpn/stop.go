@@ -12,14 +12,14 @@ var stopCmd = &cobra.Command{
 	Short: "stop vpn",
 	Long:  `stop vpn`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := stopVPN(); err != nil {
+		if err := stopVPN(cmd); err != nil {
 			fn.PrintError(err)
 			return
 		}
 	},
 }
 
-func stopVPN() error {
+func stopVPN(cmd *cobra.Command) error {
 
 	if runtime.GOOS != "linux" {
 		fn.Log(text.Green("stop vpn from your wireguard client"))
@@ -44,7 +44,7 @@ func stopVPN() error {
 	//	return fn.Errorf(errBuf.String())
 	//}
 
-	if err := startWireguard("", true); err != nil {
+	if err := startWireguard(cmd, "", true); err != nil {
 		return err
 	}
 
@@ -14,6 +14,7 @@ const (
 	RuntimeDarwin  = "darwin"
 	RuntimeWindows = "windows"
 	SocatImage     = "ghcr.io/kloudlite/hub/socat:latest"
+	VpnImage       = "ghcr.io/kloudlite/hub/wireguard:latest"
 
 	KLDNS                       = "100.64.0.1"
 	InterceptWorkspaceServiceIp = "172.18.0.3"
@@ -48,6 +49,29 @@ func GetBoxImageName() string {
 	return fmt.Sprintf("%s/box:%s", flags.ImageBase, flags.Version)
 }
 
+// GetImageNames returns every image the current version of kl runs
+// containers with. the k3s tracker is not one of them, it runs in k3s which
+// pulls it itself
+func GetImageNames() []string {
+	return []string{
+		GetBoxImageName(),
+		GetK3SImageName(),
+		SocatImage,
+		VpnImage,
+	}
+}
+
+// GetImageRepos returns repos of images kl tags with its version, images of
+// these repos tagged with other versions are left from previous versions
+func GetImageRepos() []string {
+	return []string{
+		fmt.Sprintf("%s/box", flags.ImageBase),
+		fmt.Sprintf("%s/k3s", flags.ImageBase),
+		fmt.Sprintf("%s/k3s-tracker", flags.ImageBase),
+		fmt.Sprintf("%s/box/wireguard", flags.ImageBase),
+	}
+}
+
 var (
 	BaseURL = func() string {
 		baseUrl := flags.DefaultBaseURL
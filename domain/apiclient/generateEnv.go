@@ -78,6 +78,9 @@ type Kv struct {
 type CSResp map[string]map[string]*Kv
 type MountMap map[string]string
 
+// GetLoadMaps returns values of env vars and mounts of kl.yml which come from
+// the environment, values of ${config:...}, ${secret:...} and ${mres:...}
+// references are returned along with them, keyed by fileclient.EnvRef.RefKey
 func (apic *apiClient) GetLoadMaps() (map[string]string, MountMap, error) {
 	fc := apic.fc
 
@@ -91,6 +94,11 @@ func (apic *apiClient) GetLoadMaps() (map[string]string, MountMap, error) {
 		return nil, nil, functions.NewE(err)
 	}
 
+	kt, err = kt.WithProfile(fileclient.ResolveProfile(env))
+	if err != nil {
+		return nil, nil, functions.NewE(err)
+	}
+
 	cookie, err := getCookie([]functions.Option{
 		functions.MakeOption("teamName", kt.TeamName),
 	}...)
@@ -104,6 +112,7 @@ func (apic *apiClient) GetLoadMaps() (map[string]string, MountMap, error) {
 	currConfs := kt.EnvVars.GetConfigs()
 
 	currMounts := kt.Mounts.GetMounts()
+	currRefs := kt.EnvVars.GetRefs()
 
 	respData, err := klFetch("cli_getConfigSecretMap", map[string]any{
 		"envName": env.Name,
@@ -127,6 +136,15 @@ func (apic *apiClient) GetLoadMaps() (map[string]string, MountMap, error) {
 				}
 			}
 
+			for _, r := range currRefs {
+				if r.Type == fileclient.Res_config {
+					queries = append(queries, map[string]any{
+						"configName": r.Name,
+						"key":        r.Key,
+					})
+				}
+			}
+
 			return queries
 		}(),
 
@@ -141,6 +159,15 @@ func (apic *apiClient) GetLoadMaps() (map[string]string, MountMap, error) {
 				}
 			}
 
+			for _, r := range currRefs {
+				if r.Type == fileclient.Res_mres {
+					queries = append(queries, map[string]any{
+						"secretName": r.Name,
+						"key":        r.Key,
+					})
+				}
+			}
+
 			return queries
 		}(),
 
@@ -163,6 +190,15 @@ func (apic *apiClient) GetLoadMaps() (map[string]string, MountMap, error) {
 					})
 				}
 			}
+
+			for _, r := range currRefs {
+				if r.Type == fileclient.Res_secret {
+					queries = append(queries, map[string]any{
+						"secretName": r.Name,
+						"key":        r.Key,
+					})
+				}
+			}
 			return queries
 		}(),
 	}, &cookie)
@@ -276,5 +312,29 @@ func (apic *apiClient) GetLoadMaps() (map[string]string, MountMap, error) {
 		}
 	}
 
+	// ************************[ handling references ]************************
+	for _, r := range currRefs {
+		switch r.Type {
+		case fileclient.Res_config:
+			for _, ce := range fromResp.Configs {
+				if ce.ConfigName == r.Name && ce.Key == r.Key {
+					result[r.RefKey()] = ce.Value
+				}
+			}
+		case fileclient.Res_secret:
+			for _, se := range fromResp.Secrets {
+				if se.SecretName == r.Name && se.Key == r.Key {
+					result[r.RefKey()] = se.Value
+				}
+			}
+		case fileclient.Res_mres:
+			for _, me := range fromResp.Mreses {
+				if me.SecretName == r.Name && me.Key == r.Key {
+					result[r.RefKey()] = me.Value
+				}
+			}
+		}
+	}
+
 	return result, mountMap, nil
 }
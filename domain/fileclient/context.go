@@ -53,6 +53,10 @@ type WGConfig struct {
 type Env struct {
 	Name    string `json:"name"`
 	SSHPort int    `json:"sshPort"`
+	Profile string `json:"profile,omitempty"`
+	// Snapshot is the image of the box snapshot the box was restored from,
+	// the box runs from it until the snapshot is removed
+	Snapshot string `json:"snapshot,omitempty"`
 }
 
 type Session struct {
@@ -86,6 +90,9 @@ type ExtraData struct {
 	DnsHostSuffix   string          `json:"dnsHostSuffix"`
 	SelectedEnvs    map[string]*Env `json:"selectedEnvs"`
 	LastUpdateCheck time.Time       `json:"lastUpdateCheck"`
+	// ContainerRuntime overrides the detected container runtime, empty
+	// means auto detection
+	ContainerRuntime string `json:"containerRuntime,omitempty"`
 }
 
 type Port struct {
@@ -198,6 +205,25 @@ func GetBaseURL() (string, error) {
 	return extraData.BaseUrl, nil
 }
 
+func SaveContainerRuntime(name string) error {
+	extraData, err := GetExtraData()
+	if err != nil {
+		return functions.NewE(err)
+	}
+
+	extraData.ContainerRuntime = name
+	return SaveExtraData(extraData)
+}
+
+func GetContainerRuntime() (string, error) {
+	extraData, err := GetExtraData()
+	if err != nil {
+		return "", functions.NewE(err)
+	}
+
+	return extraData.ContainerRuntime, nil
+}
+
 func SaveExtraData(extraData *ExtraData) error {
 	file, err := yaml.Marshal(extraData)
 	if err != nil {
@@ -0,0 +1,324 @@
+package fileclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	fn "github.com/kloudlite/kl/pkg/functions"
+)
+
+const (
+	DevContainerFile    = ".devcontainer/devcontainer.json"
+	devContainerAltFile = ".devcontainer.json"
+)
+
+// DevContainer is the subset of devcontainer.json (https://containers.dev)
+// which kl reads and writes
+type DevContainer struct {
+	Name            string            `json:"name,omitempty"`
+	Image           string            `json:"image,omitempty"`
+	RunArgs         []string          `json:"runArgs,omitempty"`
+	ContainerEnv    map[string]string `json:"containerEnv,omitempty"`
+	ForwardPorts    []any             `json:"forwardPorts,omitempty"`
+	Mounts          []any             `json:"mounts,omitempty"`
+	Features        map[string]any    `json:"features,omitempty"`
+	WorkspaceMount  string            `json:"workspaceMount,omitempty"`
+	WorkspaceFolder string            `json:"workspaceFolder,omitempty"`
+	ContainerUser   string            `json:"containerUser,omitempty"`
+	RemoteUser      string            `json:"remoteUser,omitempty"`
+	OverrideCommand *bool             `json:"overrideCommand,omitempty"`
+}
+
+// FindDevContainerFile returns p, .devcontainer.json is returned instead
+// when p is the default .devcontainer/devcontainer.json which doesn't exist
+func FindDevContainerFile(p string) (string, error) {
+	if p != DevContainerFile {
+		return p, nil
+	}
+
+	for _, f := range []string{DevContainerFile, devContainerAltFile} {
+		if _, err := os.Stat(f); err == nil {
+			return f, nil
+		}
+	}
+
+	return "", fn.Errorf("no devcontainer.json found at %s or %s", DevContainerFile, devContainerAltFile)
+}
+
+func ReadDevContainer(p string) (*DevContainer, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fn.Errorf("devcontainer file %s not found", p)
+		}
+		return nil, fn.NewE(err, "failed to read devcontainer file")
+	}
+
+	var dc DevContainer
+	if err := json.Unmarshal(stripJSONC(b), &dc); err != nil {
+		return nil, fn.NewE(err, fmt.Sprintf("failed to parse %s", p))
+	}
+
+	return &dc, nil
+}
+
+// MarshalDevContainer returns dc as devcontainer.json
+func MarshalDevContainer(dc *DevContainer) ([]byte, error) {
+	b, err := json.MarshalIndent(dc, "", "  ")
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	return append(b, '\n'), nil
+}
+
+func WriteDevContainer(p string, dc *DevContainer) error {
+	b, err := MarshalDevContainer(dc)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	if err := os.MkdirAll(path.Dir(p), 0o755); err != nil {
+		return fn.NewE(err)
+	}
+
+	if err := os.WriteFile(p, b, 0o644); err != nil {
+		return fn.NewE(err, "failed to write devcontainer file")
+	}
+
+	return nil
+}
+
+// stripJSONC removes comments and trailing commas, which devcontainer.json
+// allows, from b
+func stripJSONC(b []byte) []byte {
+	resp := make([]byte, 0, len(b))
+
+	// index in resp of the last comma outside strings, which is dropped if
+	// it is followed by a closing bracket
+	comma := -1
+	inString := false
+	for i := 0; i < len(b); i++ {
+		ch := b[i]
+
+		if inString {
+			resp = append(resp, ch)
+			switch ch {
+			case '\\':
+				if i+1 < len(b) {
+					i++
+					resp = append(resp, b[i])
+				}
+			case '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case ch == '/' && i+1 < len(b) && b[i+1] == '/':
+			for i+1 < len(b) && b[i+1] != '\n' {
+				i++
+			}
+		case ch == '/' && i+1 < len(b) && b[i+1] == '*':
+			i += 2
+			for i+1 < len(b) && !(b[i] == '*' && b[i+1] == '/') {
+				i++
+			}
+			i++
+		case ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n':
+			resp = append(resp, ch)
+		case (ch == '}' || ch == ']') && comma != -1:
+			resp = append(resp[:comma], resp[comma+1:]...)
+			resp = append(resp, ch)
+			comma = -1
+		case ch == ',':
+			comma = len(resp)
+			resp = append(resp, ch)
+		default:
+			comma = -1
+			inString = ch == '"'
+			resp = append(resp, ch)
+		}
+	}
+
+	return resp
+}
+
+// nix packages of devcontainer features, keyed by id of the feature without
+// its registry and version
+var devContainerFeaturePackages = map[string][]string{
+	"node":                     {"nodejs"},
+	"python":                   {"python3"},
+	"go":                       {"go"},
+	"rust":                     {"rustc", "cargo"},
+	"java":                     {"jdk"},
+	"ruby":                     {"ruby"},
+	"php":                      {"php"},
+	"dotnet":                   {"dotnet-sdk"},
+	"git":                      {"git"},
+	"git-lfs":                  {"git-lfs"},
+	"github-cli":               {"gh"},
+	"kubectl-helm-minikube":    {"kubectl", "kubernetes-helm"},
+	"terraform":                {"terraform"},
+	"aws-cli":                  {"awscli2"},
+	"azure-cli":                {"azure-cli"},
+	"powershell":               {"powershell"},
+	"deno":                     {"deno"},
+	"nix":                      {},
+	"common-utils":             {},
+	"docker-in-docker":         {},
+	"docker-outside-of-docker": {},
+}
+
+// features whose version option is passed on as version of their package
+var devContainerVersionedFeatures = map[string]bool{
+	"node":   true,
+	"python": true,
+	"go":     true,
+	"java":   true,
+	"ruby":   true,
+	"php":    true,
+}
+
+func devContainerFeatureID(ref string) string {
+	id := ref[strings.LastIndex(ref, "/")+1:]
+	if i := strings.IndexAny(id, ":@"); i != -1 {
+		id = id[:i]
+	}
+
+	return id
+}
+
+func devContainerFeatureVersion(opts any) string {
+	switch o := opts.(type) {
+	case string:
+		return o
+	case map[string]any:
+		if v, ok := o["version"].(string); ok {
+			return v
+		}
+	}
+
+	return ""
+}
+
+var devContainerVarRe = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// devContainerEnvValue rewrites variables of a containerEnv value into
+// references of kl.yml, ok is false when it uses variables kl can't resolve
+func devContainerEnvValue(v string) (string, bool) {
+	ok := true
+	resp := devContainerVarRe.ReplaceAllStringFunc(v, func(s string) string {
+		name := s[2 : len(s)-1]
+		switch {
+		case strings.HasPrefix(name, "localEnv:") && strings.Count(name, ":") == 1:
+			return fmt.Sprintf("${env:%s}", strings.TrimPrefix(name, "localEnv:"))
+		case strings.HasPrefix(name, "containerEnv:") && strings.Count(name, ":") == 1:
+			return fmt.Sprintf("${%s}", strings.TrimPrefix(name, "containerEnv:"))
+		default:
+			ok = false
+			return s
+		}
+	})
+
+	return resp, ok
+}
+
+func devContainerMountTarget(m any) string {
+	switch v := m.(type) {
+	case string:
+		for _, kv := range strings.Split(v, ",") {
+			k, val, _ := strings.Cut(kv, "=")
+			if k == "target" || k == "destination" || k == "dst" {
+				return val
+			}
+		}
+	case map[string]any:
+		if t, ok := v["target"].(string); ok {
+			return t
+		}
+	}
+
+	return fmt.Sprint(m)
+}
+
+// KLFile translates containerEnv, forwardPorts and features of d into a kl
+// file, parts of d which kl can't express are returned as warnings
+func (d *DevContainer) KLFile() (*KLFileType, []string) {
+	kf := &KLFileType{
+		Version:  KLFileLatestVersion,
+		Packages: []string{},
+		EnvVars:  EnvVars{},
+		Mounts:   Mounts{},
+		Ports:    Ports{},
+	}
+	warns := make([]string, 0)
+
+	refs := make([]string, 0, len(d.Features))
+	for ref := range d.Features {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	for _, ref := range refs {
+		id := devContainerFeatureID(ref)
+		pkgs, ok := devContainerFeaturePackages[id]
+		if !ok {
+			warns = append(warns, fmt.Sprintf("feature %s has no matching nix package, add it with kl pkg add", ref))
+			continue
+		}
+
+		version := devContainerFeatureVersion(d.Features[ref])
+		for i, p := range pkgs {
+			if i == 0 && devContainerVersionedFeatures[id] && version != "" && version != "latest" && version != "lts" && version != "none" {
+				p = fmt.Sprintf("%s@%s", p, version)
+			}
+			if !slices.Contains(kf.Packages, p) {
+				kf.Packages = append(kf.Packages, p)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(d.ContainerEnv))
+	for k := range d.ContainerEnv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v, ok := devContainerEnvValue(d.ContainerEnv[k])
+		if !ok {
+			warns = append(warns, fmt.Sprintf("env var %s uses devcontainer variables kl can't resolve, skipped", k))
+			continue
+		}
+		kf.EnvVars = append(kf.EnvVars, EnvType{Key: k, Value: &v})
+	}
+
+	for _, p := range d.ForwardPorts {
+		switch v := p.(type) {
+		case float64:
+			kf.Ports = append(kf.Ports, NewPortMapping(int(v)))
+		case string:
+			if i, err := strconv.Atoi(v); err == nil {
+				kf.Ports = append(kf.Ports, NewPortMapping(i))
+				continue
+			}
+			warns = append(warns, fmt.Sprintf("forwarded port %s of another container is not supported, skipped", v))
+		}
+	}
+
+	for _, m := range d.Mounts {
+		warns = append(warns, fmt.Sprintf("mount at %s skipped, mounts of kl.yml can only hold configs and secrets", devContainerMountTarget(m)))
+	}
+
+	return kf, warns
+}
@@ -0,0 +1,247 @@
+package fileclient
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	fn "github.com/kloudlite/kl/pkg/functions"
+)
+
+// values of envVars can reference other values with ${...}, the supported
+// references are:
+//
+//   - ${KEY}: value of another env var of kl.yml
+//   - ${config:name/key}, ${secret:name/key}, ${mres:name/key}: value of a
+//     key of a config, secret or managed resource of the environment
+//   - ${env:NAME}: env var of the host generating the box environment
+//
+// "$${" is written as a literal "${"
+
+type EnvRef struct {
+	Type resType
+	Name string
+	Key  string
+}
+
+// RefKey is the key under which the value of r is returned by
+// apiclient.GetLoadMaps, it never collides with env var keys as they can't
+// contain ':'
+func (r EnvRef) RefKey() string {
+	return fmt.Sprintf("%s:%s/%s", r.Type, r.Name, r.Key)
+}
+
+func IsRefKey(key string) bool {
+	return strings.Contains(key, ":")
+}
+
+// expandVars replaces every ${...} of s by the value returned by lookup
+func expandVars(s string, lookup func(ref string) (string, error)) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	resp := new(strings.Builder)
+	for {
+		i := strings.Index(s, "${")
+		if i == -1 {
+			resp.WriteString(s)
+			return resp.String(), nil
+		}
+
+		if i > 0 && s[i-1] == '$' {
+			resp.WriteString(s[:i-1])
+			resp.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+
+		resp.WriteString(s[:i])
+
+		j := strings.Index(s[i:], "}")
+		if j == -1 {
+			return "", fn.Errorf("unterminated reference %q", s[i:])
+		}
+
+		v, err := lookup(s[i+2 : i+j])
+		if err != nil {
+			return "", err
+		}
+
+		resp.WriteString(v)
+		s = s[i+j+1:]
+	}
+}
+
+// parseRef splits a reference into its type and value, type is empty for
+// references to other env vars
+func parseRef(ref string) (string, string, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return "", "", fn.Error("empty reference ${}")
+	}
+
+	typ, val, ok := strings.Cut(ref, ":")
+	if !ok {
+		return "", ref, nil
+	}
+
+	switch typ {
+	case "env":
+		if val == "" {
+			return "", "", fn.Errorf("reference ${%s} must be in format of ${env:NAME}", ref)
+		}
+	case string(Res_config), string(Res_secret), string(Res_mres):
+		s := strings.Split(val, "/")
+		if len(s) != 2 || s[0] == "" || s[1] == "" {
+			return "", "", fn.Errorf("reference ${%s} must be in format of ${%s:name/key}", ref, typ)
+		}
+	default:
+		return "", "", fn.Errorf("unknown reference type %q in ${%s}, must be one of env, config, secret or mres", typ, ref)
+	}
+
+	return typ, val, nil
+}
+
+// GetRefs returns every config, secret and mres referenced by values of e
+func (e *EnvVars) GetRefs() []EnvRef {
+	resp := make([]EnvRef, 0)
+	if e == nil {
+		return resp
+	}
+
+	hist := map[EnvRef]bool{}
+	for _, ne := range e.GetEnvs() {
+		// errors are reported while interpolating
+		expandVars(ne.Value, func(ref string) (string, error) {
+			typ, val, err := parseRef(ref)
+			if err != nil || typ == "" || typ == "env" {
+				return "", nil
+			}
+
+			name, key, _ := strings.Cut(val, "/")
+			r := EnvRef{Type: resType(typ), Name: name, Key: key}
+			if !hist[r] {
+				hist[r] = true
+				resp = append(resp, r)
+			}
+			return "", nil
+		})
+	}
+
+	return resp
+}
+
+// HostEnvRefs returns names of every env var of the host referenced by
+// values of e with ${env:NAME}, sorted
+func (e *EnvVars) HostEnvRefs() []string {
+	resp := make([]string, 0)
+	if e == nil {
+		return resp
+	}
+
+	for _, ne := range e.GetEnvs() {
+		// errors are reported while interpolating
+		expandVars(ne.Value, func(ref string) (string, error) {
+			if typ, val, err := parseRef(ref); err == nil && typ == "env" && !slices.Contains(resp, val) {
+				resp = append(resp, val)
+			}
+			return "", nil
+		})
+	}
+	slices.Sort(resp)
+
+	return resp
+}
+
+type interpolator struct {
+	raw      map[string]string
+	vars     map[string]string
+	resolved map[string]string
+	stack    []string
+}
+
+func (ip *interpolator) resolve(key string) (string, error) {
+	if v, ok := ip.resolved[key]; ok {
+		return v, nil
+	}
+
+	raw, ok := ip.raw[key]
+	if !ok {
+		v, ok := ip.vars[key]
+		if !ok {
+			return "", fn.Errorf("env var %s referenced by %s is not defined", key, ip.stack[len(ip.stack)-1])
+		}
+		return v, nil
+	}
+
+	for i, k := range ip.stack {
+		if k == key {
+			return "", fn.Errorf("cyclic reference %s", strings.Join(append(ip.stack[i:], key), " -> "))
+		}
+	}
+
+	ip.stack = append(ip.stack, key)
+	defer func() {
+		ip.stack = ip.stack[:len(ip.stack)-1]
+	}()
+
+	v, err := expandVars(raw, func(ref string) (string, error) {
+		typ, val, err := parseRef(ref)
+		if err != nil {
+			return "", fn.Errorf("%s in value of %s", err.Error(), key)
+		}
+
+		switch typ {
+		case "":
+			return ip.resolve(val)
+		case "env":
+			v, ok := os.LookupEnv(val)
+			if !ok {
+				return "", fn.Errorf("host env var %s referenced by %s is not set", val, key)
+			}
+			return v, nil
+		default:
+			name, k, _ := strings.Cut(val, "/")
+			r := EnvRef{Type: resType(typ), Name: name, Key: k}
+			v, ok := ip.vars[r.RefKey()]
+			if !ok {
+				return "", fn.Errorf("%s %s referenced by %s has no key %s", typ, name, key, k)
+			}
+			return v, nil
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+
+	ip.resolved[key] = v
+	return v, nil
+}
+
+// InterpolateEnvs expands references in the values of envs, vars holds the
+// values of env vars which are not literal (configs, secrets and mreses) and
+// values of references keyed by EnvRef.RefKey
+func InterpolateEnvs(envs []NormalEnv, vars map[string]string) (map[string]string, error) {
+	ip := &interpolator{
+		raw:      make(map[string]string, len(envs)),
+		vars:     vars,
+		resolved: make(map[string]string, len(envs)),
+	}
+
+	for _, ne := range envs {
+		ip.raw[ne.Key] = ne.Value
+	}
+
+	resp := make(map[string]string, len(envs))
+	for _, ne := range envs {
+		v, err := ip.resolve(ne.Key)
+		if err != nil {
+			return nil, fn.NewE(err, fmt.Sprintf("failed to interpolate value of env var %s", ne.Key))
+		}
+		resp[ne.Key] = v
+	}
+
+	return resp, nil
+}
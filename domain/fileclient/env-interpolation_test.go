@@ -0,0 +1,208 @@
+package fileclient
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		ref     string
+		typ     string
+		val     string
+		wantErr string
+	}{
+		{ref: "KEY", typ: "", val: "KEY"},
+		{ref: " KEY ", typ: "", val: "KEY"},
+		{ref: "env:HOME", typ: "env", val: "HOME"},
+		{ref: "config:app/url", typ: "config", val: "app/url"},
+		{ref: "secret:db/password", typ: "secret", val: "db/password"},
+		{ref: "mres:db/host", typ: "mres", val: "db/host"},
+		{ref: "", wantErr: "empty reference"},
+		{ref: "env:", wantErr: "must be in format of ${env:NAME}"},
+		{ref: "config:app", wantErr: "must be in format of ${config:name/key}"},
+		{ref: "secret:/key", wantErr: "must be in format of ${secret:name/key}"},
+		{ref: "mres:a/b/c", wantErr: "must be in format of ${mres:name/key}"},
+		{ref: "file:a", wantErr: `unknown reference type "file"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			typ, val, err := parseRef(tt.ref)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if typ != tt.typ || val != tt.val {
+				t.Errorf("got %q %q, want %q %q", typ, val, tt.typ, tt.val)
+			}
+		})
+	}
+}
+
+func TestInterpolateEnvs(t *testing.T) {
+	t.Setenv("KL_TEST_HOST_VAR", "host")
+
+	vars := map[string]string{
+		"FROM_SECRET":          "s3cret",
+		"secret:db/password":   "pass",
+		"config:app/base-url":  "https://example.com",
+		"mres:db/host":         "db.svc",
+		"config:app/empty-key": "",
+	}
+
+	tests := []struct {
+		name    string
+		envs    []NormalEnv
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name: "literal values",
+			envs: []NormalEnv{{Key: "A", Value: "a"}, {Key: "B", Value: "$ {not a ref}"}},
+			want: map[string]string{"A": "a", "B": "$ {not a ref}"},
+		},
+		{
+			name: "references in any order",
+			envs: []NormalEnv{
+				{Key: "URL", Value: "${BASE}/api?p=${secret:db/password}"},
+				{Key: "BASE", Value: "${config:app/base-url}"},
+			},
+			want: map[string]string{"URL": "https://example.com/api?p=pass", "BASE": "https://example.com"},
+		},
+		{
+			name: "env vars which are not literal",
+			envs: []NormalEnv{{Key: "DSN", Value: "${mres:db/host}:${FROM_SECRET}"}},
+			want: map[string]string{"DSN": "db.svc:s3cret"},
+		},
+		{
+			name: "host env vars",
+			envs: []NormalEnv{{Key: "A", Value: "${env:KL_TEST_HOST_VAR}-x"}},
+			want: map[string]string{"A": "host-x"},
+		},
+		{
+			name: "escaped references",
+			envs: []NormalEnv{{Key: "A", Value: "$${A} and $${config:x/y}"}},
+			want: map[string]string{"A": "${A} and ${config:x/y}"},
+		},
+		{
+			name: "empty values are kept",
+			envs: []NormalEnv{{Key: "A", Value: "[${config:app/empty-key}]"}},
+			want: map[string]string{"A": "[]"},
+		},
+		{
+			name:    "self reference",
+			envs:    []NormalEnv{{Key: "A", Value: "${A}"}},
+			wantErr: "cyclic reference A -> A",
+		},
+		{
+			name: "cycle through several env vars",
+			envs: []NormalEnv{
+				{Key: "A", Value: "${B}"},
+				{Key: "B", Value: "x${C}"},
+				{Key: "C", Value: "${A}"},
+			},
+			wantErr: "cyclic reference A -> B -> C -> A",
+		},
+		{
+			name:    "undefined env var",
+			envs:    []NormalEnv{{Key: "A", Value: "${MISSING}"}},
+			wantErr: "env var MISSING referenced by A is not defined",
+		},
+		{
+			name:    "unset host env var",
+			envs:    []NormalEnv{{Key: "A", Value: "${env:KL_TEST_UNSET_VAR}"}},
+			wantErr: "host env var KL_TEST_UNSET_VAR referenced by A is not set",
+		},
+		{
+			name:    "missing key of a config",
+			envs:    []NormalEnv{{Key: "A", Value: "${config:app/missing}"}},
+			wantErr: "config app referenced by A has no key missing",
+		},
+		{
+			name:    "unterminated reference",
+			envs:    []NormalEnv{{Key: "A", Value: "x${B"}},
+			wantErr: `unterminated reference "${B"`,
+		},
+		{
+			name:    "invalid reference",
+			envs:    []NormalEnv{{Key: "A", Value: "${config:app}"}},
+			wantErr: "in value of A",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := InterpolateEnvs(tt.envs, vars)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("%s = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestGetRefs(t *testing.T) {
+	value := func(s string) *string { return &s }
+
+	ev := EnvVars{
+		{Key: "A", Value: value("${config:app/url}/${secret:db/password}")},
+		{Key: "B", Value: value("${config:app/url} ${env:HOME} ${A} $${secret:not/ref}")},
+		{Key: "C", Value: value("${bad:ref}")},
+	}
+
+	got := ev.GetRefs()
+	want := []EnvRef{
+		{Type: Res_config, Name: "app", Key: "url"},
+		{Type: Res_secret, Name: "db", Key: "password"},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("ref %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestHostEnvRefs(t *testing.T) {
+	value := func(s string) *string { return &s }
+
+	ev := EnvVars{
+		{Key: "A", Value: value("${env:TOKEN}/${env:HOME}")},
+		{Key: "B", Value: value("${env:HOME} ${A} $${env:NOT_REF} ${config:app/url}")},
+		{Key: "C", Value: value("${env:}")},
+	}
+
+	got := ev.HostEnvRefs()
+	want := []string{"HOME", "TOKEN"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
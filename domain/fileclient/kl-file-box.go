@@ -0,0 +1,36 @@
+package fileclient
+
+import "path"
+
+// KLBox customises the image the box runs. Image replaces the kl box image,
+// Dockerfile is built with the kl box image passed as build arg
+// BoxImageBuildArg, so that system libraries nix can't provide are installed
+// over it. images of both must be built FROM the kl box image, the box is
+// always started with its entrypoint
+type KLBox struct {
+	Image string `json:"image,omitempty" yaml:"image,omitempty"`
+	// Dockerfile is the path of the Dockerfile relative to the workspace
+	Dockerfile string `json:"dockerfile,omitempty" yaml:"dockerfile,omitempty"`
+	// Context is the build context of Dockerfile relative to the workspace,
+	// defaults to the directory of Dockerfile
+	Context string `json:"context,omitempty" yaml:"context,omitempty"`
+}
+
+// BoxImageBuildArg is the build arg box.dockerfile is built with, it holds
+// the kl box image of the current version
+const BoxImageBuildArg = "KL_BOX_IMAGE"
+
+// IsCustom reports whether b replaces the kl box image
+func (b *KLBox) IsCustom() bool {
+	return b != nil && (b.Image != "" || b.Dockerfile != "")
+}
+
+// BuildContext returns the build context of Dockerfile relative to the
+// workspace
+func (b *KLBox) BuildContext() string {
+	if b.Context != "" {
+		return b.Context
+	}
+
+	return path.Dir(b.Dockerfile)
+}
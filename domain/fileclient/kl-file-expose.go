@@ -0,0 +1,64 @@
+package fileclient
+
+import (
+	"strings"
+
+	fn "github.com/kloudlite/kl/pkg/functions"
+)
+
+// KLExpose configures which ports kl expose watch exposes when a process of
+// the box starts listening on them. entries are ports or ranges of ports such
+// as 3000-3999, deny wins over allow, and every port is allowed when allow is
+// empty
+type KLExpose struct {
+	Allow []string `json:"allow,omitempty" yaml:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty" yaml:"deny,omitempty"`
+}
+
+// ParsePortRange parses a port, or a range of ports written as from-to
+func ParsePortRange(s string) (int, int, error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		to = from
+	}
+
+	f, err := parsePortNumber(from)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	t, err := parsePortNumber(to)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if f > t {
+		return 0, 0, fn.Errorf("port range %q must start with the lower port", s)
+	}
+
+	return f, t, nil
+}
+
+func portInRanges(port int, ranges []string) bool {
+	for _, r := range ranges {
+		from, to, err := ParsePortRange(r)
+		if err == nil && port >= from && port <= to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Allows reports whether port can be exposed by kl expose watch
+func (e *KLExpose) Allows(port int) bool {
+	if e == nil {
+		return true
+	}
+
+	if portInRanges(port, e.Deny) {
+		return false
+	}
+
+	return len(e.Allow) == 0 || portInRanges(port, e.Allow)
+}
@@ -0,0 +1,120 @@
+package fileclient
+
+import (
+	"strings"
+
+	fn "github.com/kloudlite/kl/pkg/functions"
+)
+
+type HookName string
+
+const (
+	// HookOnCreate runs when the box container is created, which happens on
+	// every start after the box was stopped or its config changed
+	HookOnCreate HookName = "onCreate"
+	// HookPostStart runs after the box is started, after HookOnCreate
+	HookPostStart HookName = "postStart"
+	// HookOnReload runs in the running box after `kl box reload` changed its
+	// hash, before the restart applying the change is offered
+	HookOnReload HookName = "onReload"
+	// HookPreStop runs before the box is stopped
+	HookPreStop HookName = "preStop"
+)
+
+var HookNames = []HookName{HookOnCreate, HookPostStart, HookOnReload, HookPreStop}
+
+// KLHooks are commands run inside the box at steps of its lifecycle, in the
+// workspace directory and with the env of the box. commands of a hook run
+// one after another, and the first failing one fails the step
+type KLHooks struct {
+	OnCreate  []string `json:"onCreate,omitempty" yaml:"onCreate,omitempty"`
+	PostStart []string `json:"postStart,omitempty" yaml:"postStart,omitempty"`
+	OnReload  []string `json:"onReload,omitempty" yaml:"onReload,omitempty"`
+	PreStop   []string `json:"preStop,omitempty" yaml:"preStop,omitempty"`
+}
+
+func ParseHookName(s string) (HookName, error) {
+	for _, h := range HookNames {
+		if strings.EqualFold(string(h), s) {
+			return h, nil
+		}
+	}
+
+	names := make([]string, 0, len(HookNames))
+	for _, h := range HookNames {
+		names = append(names, string(h))
+	}
+
+	return "", fn.Errorf("unknown hook %q, must be one of %s", s, strings.Join(names, ", "))
+}
+
+func (h *KLHooks) Get(name HookName) []string {
+	if h == nil {
+		return nil
+	}
+
+	switch name {
+	case HookOnCreate:
+		return h.OnCreate
+	case HookPostStart:
+		return h.PostStart
+	case HookOnReload:
+		return h.OnReload
+	case HookPreStop:
+		return h.PreStop
+	}
+
+	return nil
+}
+
+// With returns a copy of h with the commands of hook name replaced by cmds
+func (h *KLHooks) With(name HookName, cmds []string) *KLHooks {
+	resp := KLHooks{}
+	if h != nil {
+		resp = *h
+	}
+
+	switch name {
+	case HookOnCreate:
+		resp.OnCreate = cmds
+	case HookPostStart:
+		resp.PostStart = cmds
+	case HookOnReload:
+		resp.OnReload = cmds
+	case HookPreStop:
+		resp.PreStop = cmds
+	}
+
+	if len(resp.OnCreate)+len(resp.PostStart)+len(resp.OnReload)+len(resp.PreStop) == 0 {
+		return nil
+	}
+
+	return &resp
+}
+
+// mergeHooks returns base with every hook set in overlay replaced
+func mergeHooks(base, overlay *KLHooks) *KLHooks {
+	if overlay == nil {
+		return base
+	}
+
+	if base == nil {
+		base = &KLHooks{}
+	}
+
+	resp := *base
+	if len(overlay.OnCreate) > 0 {
+		resp.OnCreate = overlay.OnCreate
+	}
+	if len(overlay.PostStart) > 0 {
+		resp.PostStart = overlay.PostStart
+	}
+	if len(overlay.OnReload) > 0 {
+		resp.OnReload = overlay.OnReload
+	}
+	if len(overlay.PreStop) > 0 {
+		resp.PreStop = overlay.PreStop
+	}
+
+	return &resp
+}
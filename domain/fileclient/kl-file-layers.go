@@ -0,0 +1,528 @@
+package fileclient
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	confighandler "github.com/kloudlite/kl/pkg/config-handler"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/text"
+	"github.com/spf13/cobra"
+)
+
+// kl.yml is shared by everyone working on a workspace, personal changes go
+// into overlays which are merged over it in the following order:
+//
+//  1. kl.local.yml next to kl.yml, it is meant to be git ignored
+//  2. files listed in KLCONFIG_OVERLAYS, separated by the os path list
+//     separator (":" on unix), later files win over earlier ones
+//
+// every overlay only needs the fields it overrides, and is merged as:
+//
+//   - teamName, defaultEnv: replaced when set in the overlay
+//   - packages: merged by package name, "go@1.22" in the overlay replaces
+//     "go@1.21" of kl.yml, other packages are appended
+//   - envVars: merged by key, an overlay entry replaces the whole entry
+//   - mounts: merged by path, an overlay entry replaces the whole entry
+//   - ports: merged by host port, an overlay port replaces the port of
+//     kl.yml listening on the same host port and protocol
+//   - profiles: merged by name, an overlay profile replaces the whole profile
+//   - hooks: merged by hook, an overlay hook replaces all commands of it
+//   - packageResolver: replaced when set in the overlay
+//   - platforms: replaced when set in the overlay
+//   - box: replaced when set in the overlay
+//   - reload: replaced when set in the overlay
+//   - expose: replaced when set in the overlay
+type KLFileLayer string
+
+const (
+	KLFileLayerBase  KLFileLayer = "base"
+	KLFileLayerLocal KLFileLayer = "local"
+
+	localKLFile = "kl.local.yml"
+)
+
+// klFileOverlay is how overlays are written, so that fields which are not
+// overridden are left out of the file
+type klFileOverlay struct {
+	Version    string   `json:"version,omitempty" yaml:"version,omitempty"`
+	DefaultEnv string   `json:"defaultEnv,omitempty" yaml:"defaultEnv,omitempty"`
+	Packages   []string `json:"packages,omitempty" yaml:"packages,omitempty"`
+
+	EnvVars EnvVars `json:"envVars,omitempty" yaml:"envVars,omitempty"`
+	Mounts  Mounts  `json:"mounts,omitempty" yaml:"mounts,omitempty"`
+	Ports   Ports   `json:"ports,omitempty" yaml:"ports,omitempty"`
+
+	Profiles map[string]KLProfile `json:"profiles,omitempty" yaml:"profiles,omitempty"`
+	Hooks    *KLHooks             `json:"hooks,omitempty" yaml:"hooks,omitempty"`
+
+	PackageResolver *KLPackageResolver `json:"packageResolver,omitempty" yaml:"packageResolver,omitempty"`
+	Platforms       []string           `json:"platforms,omitempty" yaml:"platforms,omitempty"`
+
+	Box    *KLBox    `json:"box,omitempty" yaml:"box,omitempty"`
+	Reload *KLReload `json:"reload,omitempty" yaml:"reload,omitempty"`
+	Expose *KLExpose `json:"expose,omitempty" yaml:"expose,omitempty"`
+
+	TeamName string `json:"teamName,omitempty" yaml:"teamName,omitempty"`
+}
+
+type klFileLayer struct {
+	path   string
+	klfile *KLFileType
+}
+
+func localKLFilePath(basePath string) string {
+	if fi, err := os.Stat(basePath); err == nil && fi.IsDir() {
+		return filepath.Join(basePath, localKLFile)
+	}
+
+	return filepath.Join(filepath.Dir(basePath), localKLFile)
+}
+
+func overlayPaths(basePath string) []string {
+	resp := []string{localKLFilePath(basePath)}
+
+	for _, p := range filepath.SplitList(os.Getenv("KLCONFIG_OVERLAYS")) {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		resp = append(resp, p)
+	}
+
+	return resp
+}
+
+// KLFileOverlayPaths returns paths of the overlays of kl file at basePath in
+// the order they are merged, kl.local.yml is left out when it doesn't exist
+func KLFileOverlayPaths(basePath string) []string {
+	if basePath == "" {
+		basePath = getConfigPath()
+	}
+
+	resp := make([]string, 0)
+	for i, p := range overlayPaths(basePath) {
+		if _, err := os.Stat(p); i == 0 && err != nil {
+			continue
+		}
+		resp = append(resp, p)
+	}
+
+	return resp
+}
+
+// readKLFileOverlay returns nil when the overlay at path doesn't exist and
+// optional is set
+func readKLFileOverlay(path string, optional bool) (*KLFileType, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if optional && errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, fn.NewE(err, fmt.Sprintf("failed to read kl file overlay %s", path))
+	}
+
+	verrs, err := ValidateKLFileOverlayContent(b)
+	if err != nil {
+		return nil, fn.NewE(err, fmt.Sprintf("invalid kl file overlay %s", path))
+	}
+
+	if len(verrs) > 0 {
+		return nil, fn.NewE(verrs, fmt.Sprintf("invalid kl file overlay %s", path))
+	}
+
+	ov, err := confighandler.ParseConfig[KLFileType](b)
+	if err != nil {
+		return nil, fn.NewE(err, fmt.Sprintf("failed to parse kl file overlay %s", path))
+	}
+
+	// overlays are migrated in memory only, they are owned by the user
+	if ov.Version != "" && ov.Version != KLFileLatestVersion {
+		b, _, err = MigrateKLFileContent(b)
+		if err != nil {
+			return nil, fn.NewE(err)
+		}
+
+		if ov, err = confighandler.ParseConfig[KLFileType](b); err != nil {
+			return nil, fn.NewE(err, fmt.Sprintf("failed to parse kl file overlay %s", path))
+		}
+	}
+
+	return ov, nil
+}
+
+// readKLFileOverlays returns the overlays of kl file at basePath which exist,
+// in the order they are merged
+func readKLFileOverlays(basePath string) ([]klFileLayer, error) {
+	resp := make([]klFileLayer, 0)
+	for i, p := range overlayPaths(basePath) {
+		ov, err := readKLFileOverlay(p, i == 0)
+		if err != nil {
+			return nil, fn.NewE(err)
+		}
+
+		if ov == nil {
+			continue
+		}
+
+		resp = append(resp, klFileLayer{path: p, klfile: ov})
+	}
+
+	return resp, nil
+}
+
+// mergeKLFile returns base with overlay merged over it, see KLFileLayer for
+// the merge rules
+func mergeKLFile(base, overlay *KLFileType) *KLFileType {
+	resp := *base
+
+	if overlay.TeamName != "" {
+		resp.TeamName = overlay.TeamName
+	}
+
+	if overlay.DefaultEnv != "" {
+		resp.DefaultEnv = overlay.DefaultEnv
+	}
+
+	resp.Packages = slices.Clone(base.Packages)
+	for _, p := range overlay.Packages {
+		i := slices.IndexFunc(resp.Packages, func(bp string) bool { return packageName(bp) == packageName(p) })
+		if i == -1 {
+			resp.Packages = append(resp.Packages, p)
+			continue
+		}
+		resp.Packages[i] = p
+	}
+
+	resp.EnvVars = slices.Clone(base.EnvVars)
+	for _, ev := range overlay.EnvVars {
+		i := slices.IndexFunc(resp.EnvVars, func(bev EnvType) bool { return bev.Key == ev.Key })
+		if i == -1 {
+			resp.EnvVars = append(resp.EnvVars, ev)
+			continue
+		}
+		resp.EnvVars[i] = ev
+	}
+
+	resp.Mounts = slices.Clone(base.Mounts)
+	for _, m := range overlay.Mounts {
+		i := slices.IndexFunc(resp.Mounts, func(bm Mount) bool { return bm.Path == m.Path })
+		if i == -1 {
+			resp.Mounts = append(resp.Mounts, m)
+			continue
+		}
+		resp.Mounts[i] = m
+	}
+
+	// a port of overlay replaces the port of base listening on the same
+	// port of the host
+	resp.Ports = slices.Clone(base.Ports)
+	for _, p := range overlay.Ports {
+		if i := resp.Ports.Index(p); i != -1 {
+			resp.Ports[i] = p
+			continue
+		}
+		resp.Ports = append(resp.Ports, p)
+	}
+
+	if len(overlay.Profiles) > 0 {
+		resp.Profiles = make(map[string]KLProfile, len(base.Profiles)+len(overlay.Profiles))
+		for k, v := range base.Profiles {
+			resp.Profiles[k] = v
+		}
+		for k, v := range overlay.Profiles {
+			resp.Profiles[k] = v
+		}
+	}
+
+	resp.Hooks = mergeHooks(base.Hooks, overlay.Hooks)
+
+	if overlay.PackageResolver != nil {
+		resp.PackageResolver = overlay.PackageResolver
+	}
+
+	if len(overlay.Platforms) > 0 {
+		resp.Platforms = slices.Clone(overlay.Platforms)
+	}
+
+	if overlay.Box.IsCustom() {
+		resp.Box = overlay.Box
+	}
+
+	if overlay.Reload != nil {
+		resp.Reload = overlay.Reload
+	}
+
+	if overlay.Expose != nil {
+		resp.Expose = overlay.Expose
+	}
+
+	return &resp
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
+
+func envTypeEqual(a, b EnvType) bool {
+	return a.Key == b.Key && derefString(a.Value) == derefString(b.Value) &&
+		derefString(a.ConfigRef) == derefString(b.ConfigRef) &&
+		derefString(a.SecretRef) == derefString(b.SecretRef) &&
+		derefString(a.MresRef) == derefString(b.MresRef)
+}
+
+func mountEqual(a, b Mount) bool {
+	return a.Path == b.Path && derefString(a.ConfigRef) == derefString(b.ConfigRef) &&
+		derefString(a.SecretRef) == derefString(b.SecretRef)
+}
+
+// applyKLFileChanges records the difference between prev and next (both
+// merged views of every layer) into layer, entries removed in next are only
+// removed from layer, entries defined by other layers are left as is
+func applyKLFileChanges(layer, prev, next *KLFileType) {
+	if next.TeamName != prev.TeamName {
+		layer.TeamName = next.TeamName
+	}
+
+	if next.DefaultEnv != prev.DefaultEnv {
+		layer.DefaultEnv = next.DefaultEnv
+	}
+
+	for _, p := range prev.Packages {
+		if !slices.ContainsFunc(next.Packages, func(np string) bool { return packageName(np) == packageName(p) }) {
+			layer.Packages = slices.DeleteFunc(layer.Packages, func(lp string) bool { return packageName(lp) == packageName(p) })
+		}
+	}
+	for _, p := range next.Packages {
+		if slices.Contains(prev.Packages, p) {
+			continue
+		}
+
+		i := slices.IndexFunc(layer.Packages, func(lp string) bool { return packageName(lp) == packageName(p) })
+		if i == -1 {
+			layer.Packages = append(layer.Packages, p)
+			continue
+		}
+		layer.Packages[i] = p
+	}
+
+	for _, ev := range prev.EnvVars {
+		if !slices.ContainsFunc(next.EnvVars, func(nev EnvType) bool { return nev.Key == ev.Key }) {
+			layer.EnvVars = slices.DeleteFunc(layer.EnvVars, func(lev EnvType) bool { return lev.Key == ev.Key })
+		}
+	}
+	for _, ev := range next.EnvVars {
+		if slices.ContainsFunc(prev.EnvVars, func(pev EnvType) bool { return envTypeEqual(pev, ev) }) {
+			continue
+		}
+
+		i := slices.IndexFunc(layer.EnvVars, func(lev EnvType) bool { return lev.Key == ev.Key })
+		if i == -1 {
+			layer.EnvVars = append(layer.EnvVars, ev)
+			continue
+		}
+		layer.EnvVars[i] = ev
+	}
+
+	for _, m := range prev.Mounts {
+		if !slices.ContainsFunc(next.Mounts, func(nm Mount) bool { return nm.Path == m.Path }) {
+			layer.Mounts = slices.DeleteFunc(layer.Mounts, func(lm Mount) bool { return lm.Path == m.Path })
+		}
+	}
+	for _, m := range next.Mounts {
+		if slices.ContainsFunc(prev.Mounts, func(pm Mount) bool { return mountEqual(pm, m) }) {
+			continue
+		}
+
+		i := slices.IndexFunc(layer.Mounts, func(lm Mount) bool { return lm.Path == m.Path })
+		if i == -1 {
+			layer.Mounts = append(layer.Mounts, m)
+			continue
+		}
+		layer.Mounts[i] = m
+	}
+
+	for _, p := range prev.Ports {
+		if !slices.Contains(next.Ports, p) {
+			layer.Ports = slices.DeleteFunc(layer.Ports, func(lp PortMapping) bool { return lp == p })
+		}
+	}
+	for _, p := range next.Ports {
+		if !slices.Contains(prev.Ports, p) && !slices.Contains(layer.Ports, p) {
+			layer.Ports = append(layer.Ports, p)
+		}
+	}
+
+	for name := range prev.Profiles {
+		if _, ok := next.Profiles[name]; !ok {
+			delete(layer.Profiles, name)
+		}
+	}
+	for name, np := range next.Profiles {
+		if pp, ok := prev.Profiles[name]; ok && reflect.DeepEqual(pp, np) {
+			continue
+		}
+
+		if layer.Profiles == nil {
+			layer.Profiles = map[string]KLProfile{}
+		}
+		layer.Profiles[name] = np
+	}
+
+	for _, h := range HookNames {
+		if !slices.Equal(prev.Hooks.Get(h), next.Hooks.Get(h)) {
+			layer.Hooks = layer.Hooks.With(h, next.Hooks.Get(h))
+		}
+	}
+
+	if !reflect.DeepEqual(prev.PackageResolver, next.PackageResolver) {
+		layer.PackageResolver = next.PackageResolver
+	}
+
+	if !slices.Equal(prev.Platforms, next.Platforms) {
+		layer.Platforms = next.Platforms
+	}
+
+	if !reflect.DeepEqual(prev.Box, next.Box) {
+		layer.Box = next.Box
+	}
+
+	if !reflect.DeepEqual(prev.Reload, next.Reload) {
+		layer.Reload = next.Reload
+	}
+
+	if !reflect.DeepEqual(prev.Expose, next.Expose) {
+		layer.Expose = next.Expose
+	}
+}
+
+// warnShadowedPackages warns about packages removed from the layer written,
+// which are still set by another layer of kl file at basePath
+func (c *fclient) warnShadowedPackages(basePath string, prev, next *KLFileType) {
+	base, err := c.getBaseKlFile(basePath)
+	if err != nil {
+		return
+	}
+
+	overlays, err := readKLFileOverlays(basePath)
+	if err != nil {
+		return
+	}
+	overlays = append([]klFileLayer{{path: basePath, klfile: base}}, overlays...)
+
+	for _, p := range prev.Packages {
+		if slices.ContainsFunc(next.Packages, func(np string) bool { return packageName(np) == packageName(p) }) {
+			continue
+		}
+
+		for _, ov := range overlays {
+			if slices.ContainsFunc(ov.klfile.Packages, func(op string) bool { return packageName(op) == packageName(p) }) {
+				fn.Warnf("package %s is still set by %s", packageName(p), ov.path)
+			}
+		}
+	}
+}
+
+// CreateKLFile writes fileObj as the whole kl.yml, replacing it when it
+// already exists even if it is not valid. use WriteKLFile to change a kl.yml
+// which exists
+func (c *fclient) CreateKLFile(fileObj KLFileType) error {
+	b, err := confighandler.MarshalYAML(fileObj)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	if err := os.WriteFile(getConfigPath(), b, 0644); err != nil {
+		return fn.NewE(err, "failed to write kl file")
+	}
+
+	return nil
+}
+
+func (c *fclient) WriteKLFileLayer(layer KLFileLayer, fileObj KLFileType) error {
+	basePath := getConfigPath()
+
+	base, err := c.getBaseKlFile(basePath)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	overlays, err := readKLFileOverlays(basePath)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	prev := mergeKLFile(base, &KLFileType{})
+	for _, ov := range overlays {
+		prev = mergeKLFile(prev, ov.klfile)
+	}
+
+	switch layer {
+	case KLFileLayerBase:
+		applyKLFileChanges(base, prev, &fileObj)
+		if err := confighandler.WriteConfig(basePath, base, 0644); err != nil {
+			return fn.NewE(err)
+		}
+
+		c.warnShadowedPackages(basePath, prev, &fileObj)
+		return nil
+
+	case KLFileLayerLocal:
+		localPath := localKLFilePath(basePath)
+		local := &KLFileType{}
+		if len(overlays) > 0 && overlays[0].path == localPath {
+			local = overlays[0].klfile
+		}
+
+		applyKLFileChanges(local, prev, &fileObj)
+
+		if _, err := os.Stat(localPath); errors.Is(err, os.ErrNotExist) {
+			fn.Log(text.Yellow(fmt.Sprintf("[#] creating %s, make sure to add it to your .gitignore", localPath)))
+		}
+
+		if err := confighandler.WriteConfig(localPath, klFileOverlay{
+			Version:    KLFileLatestVersion,
+			DefaultEnv: local.DefaultEnv,
+			Packages:   local.Packages,
+			EnvVars:    local.EnvVars,
+			Mounts:     local.Mounts,
+			Ports:      local.Ports,
+			Profiles:   local.Profiles,
+			Hooks:      local.Hooks,
+			TeamName:   local.TeamName,
+
+			PackageResolver: local.PackageResolver,
+			Platforms:       local.Platforms,
+
+			Box:    local.Box,
+			Reload: local.Reload,
+			Expose: local.Expose,
+		}, 0644); err != nil {
+			return fn.NewE(err)
+		}
+
+		c.warnShadowedPackages(basePath, prev, &fileObj)
+		return nil
+	}
+
+	return fn.Errorf("unknown kl file layer %q", layer)
+}
+
+// ParseKLFileLayer returns the layer selected by the flag added with
+// fn.WithKlFileLayer
+func ParseKLFileLayer(cmd *cobra.Command) KLFileLayer {
+	if fn.ParseBoolFlag(cmd, "local") {
+		return KLFileLayerLocal
+	}
+
+	return KLFileLayerBase
+}
@@ -0,0 +1,120 @@
+package fileclient
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestApplyKLFileChanges(t *testing.T) {
+	tests := []struct {
+		name  string
+		layer KLFileType
+		prev  KLFileType
+		next  KLFileType
+		check func(t *testing.T, layer *KLFileType)
+	}{
+		{
+			name:  "package is removed by name",
+			layer: KLFileType{Packages: []string{"go@1.21", "git"}},
+			prev:  KLFileType{Packages: []string{"go@1.22", "git"}},
+			next:  KLFileType{Packages: []string{"git"}},
+			check: func(t *testing.T, layer *KLFileType) {
+				if !slices.Equal(layer.Packages, []string{"git"}) {
+					t.Errorf("packages = %v, want [git]", layer.Packages)
+				}
+			},
+		},
+		{
+			name:  "package version is replaced in place",
+			layer: KLFileType{Packages: []string{"go@1.21", "git"}},
+			prev:  KLFileType{Packages: []string{"go@1.21", "git"}},
+			next:  KLFileType{Packages: []string{"go@1.22", "git"}},
+			check: func(t *testing.T, layer *KLFileType) {
+				if !slices.Equal(layer.Packages, []string{"go@1.22", "git"}) {
+					t.Errorf("packages = %v, want [go@1.22 git]", layer.Packages)
+				}
+			},
+		},
+		{
+			name:  "profiles are added, changed and removed",
+			layer: KLFileType{Profiles: map[string]KLProfile{"a": {Packages: []string{"x"}}, "b": {}}},
+			prev:  KLFileType{Profiles: map[string]KLProfile{"a": {Packages: []string{"x"}}, "b": {}}},
+			next:  KLFileType{Profiles: map[string]KLProfile{"a": {Packages: []string{"y"}}, "c": {}}},
+			check: func(t *testing.T, layer *KLFileType) {
+				if len(layer.Profiles) != 2 || layer.Profiles["a"].Packages[0] != "y" {
+					t.Errorf("profiles = %v, want a with y and c", layer.Profiles)
+				}
+				if _, ok := layer.Profiles["c"]; !ok {
+					t.Errorf("profile c is missing")
+				}
+			},
+		},
+		{
+			name:  "hooks are changed by hook",
+			layer: KLFileType{Hooks: &KLHooks{OnCreate: []string{"a"}}},
+			prev:  KLFileType{Hooks: &KLHooks{OnCreate: []string{"a"}, PreStop: []string{"b"}}},
+			next:  KLFileType{Hooks: &KLHooks{OnCreate: []string{"a"}, PreStop: []string{"c"}}},
+			check: func(t *testing.T, layer *KLFileType) {
+				if !slices.Equal(layer.Hooks.OnCreate, []string{"a"}) || !slices.Equal(layer.Hooks.PreStop, []string{"c"}) {
+					t.Errorf("hooks = %+v, want onCreate [a] and preStop [c]", layer.Hooks)
+				}
+			},
+		},
+		{
+			name: "settings are replaced",
+			prev: KLFileType{},
+			next: KLFileType{
+				PackageResolver: &KLPackageResolver{Type: PackageResolverNix},
+				Platforms:       []string{"x86_64-linux"},
+				Box:             &KLBox{Image: "img"},
+				Reload:          &KLReload{Signal: "SIGHUP"},
+				Expose:          &KLExpose{Allow: []string{"3000-3999"}},
+			},
+			check: func(t *testing.T, layer *KLFileType) {
+				if layer.PackageResolver == nil || layer.Box == nil || layer.Reload == nil || layer.Expose == nil || len(layer.Platforms) != 1 {
+					t.Errorf("settings are not applied: %+v", layer)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applyKLFileChanges(&tt.layer, &tt.prev, &tt.next)
+			tt.check(t, &tt.layer)
+		})
+	}
+}
+
+func TestCreateKLFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "kl.yml")
+	t.Setenv("KLCONFIG_PATH", path)
+	t.Setenv("KLCONFIG_OVERLAYS", "")
+
+	c := &fclient{}
+
+	// kl init writes kl.yml which doesn't exist yet, or isn't valid
+	for _, content := range []string{"", "teamName: [\n"} {
+		if content != "" {
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := c.CreateKLFile(KLFileType{Version: KLFileLatestVersion, TeamName: "team", DefaultEnv: "dev"}); err != nil {
+			t.Fatalf("failed to create kl file: %v", err)
+		}
+
+		kf, err := c.GetKlFile("")
+		if err != nil {
+			t.Fatalf("created kl file is not readable: %v", err)
+		}
+
+		if kf.TeamName != "team" || kf.DefaultEnv != "dev" {
+			t.Errorf("got %+v", kf)
+		}
+	}
+}
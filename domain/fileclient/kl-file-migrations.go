@@ -0,0 +1,158 @@
+package fileclient
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	confighandler "github.com/kloudlite/kl/pkg/config-handler"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// klFileMigrations upgrades kl.yml by exactly one version, keyed on the
+// version it upgrades from. migrations operate on yaml nodes, so comments
+// and key order of the untouched parts of the file are kept as is
+var klFileMigrations = map[int]func(root *yamlv3.Node) error{
+	// files created before versioning was introduced, only the version
+	// field is missing
+	0: func(root *yamlv3.Node) error {
+		return nil
+	},
+}
+
+func parseKLFileVersion(v string) (int, error) {
+	if v == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(strings.TrimPrefix(v, "v"))
+	if err != nil || !strings.HasPrefix(v, "v") || n < 1 {
+		return 0, fn.Errorf("invalid kl file version %q, version must be in format of v<number>", v)
+	}
+
+	return n, nil
+}
+
+func klFileVersionOf(root *yamlv3.Node) string {
+	if vn := mappingValue(root, "version"); vn != nil {
+		return vn.Value
+	}
+
+	return ""
+}
+
+// setMappingScalar sets the scalar value of key in a mapping node, a new
+// key is inserted at the top of the mapping when it doesn't exist
+func setMappingScalar(n *yamlv3.Node, key, value string) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content[i+1].Kind = yamlv3.ScalarNode
+			n.Content[i+1].Tag = "!!str"
+			n.Content[i+1].Value = value
+			n.Content[i+1].Content = nil
+			return
+		}
+	}
+
+	n.Content = append([]*yamlv3.Node{
+		{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: key},
+		{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: value},
+	}, n.Content...)
+}
+
+// validateKLFileVersion reports the version of root when it can't be
+// migrated from, with the line and column of the version field
+func validateKLFileVersion(root *yamlv3.Node) ValidationErrors {
+	vn := mappingValue(root, "version")
+	if vn == nil {
+		return nil
+	}
+
+	v := &validator{}
+	if vn.Kind != yamlv3.ScalarNode {
+		v.report(vn, "version", "expected %s, got %s", kindString, nodeKind(vn))
+		return v.errs
+	}
+
+	current, err := parseKLFileVersion(vn.Value)
+	if err != nil {
+		v.report(vn, "version", "%s", err.Error())
+		return v.errs
+	}
+
+	if latest, _ := parseKLFileVersion(KLFileLatestVersion); current > latest {
+		v.report(vn, "version", "kl file version %s is newer than the versions supported by this kl (up to %s), please update kl by running \"kl update\"", vn.Value, KLFileLatestVersion)
+	}
+
+	return v.errs
+}
+
+// migrateKLFileNode upgrades root to KLFileLatestVersion in place and
+// returns the version it was migrated from, an error is returned when the
+// file was written by a newer kl
+func migrateKLFileNode(root *yamlv3.Node) (string, error) {
+	from := klFileVersionOf(root)
+
+	current, err := parseKLFileVersion(from)
+	if err != nil {
+		return "", fn.NewE(err)
+	}
+
+	latest, err := parseKLFileVersion(KLFileLatestVersion)
+	if err != nil {
+		return "", fn.NewE(err)
+	}
+
+	if current > latest {
+		return "", fn.Errorf("kl file version %s is newer than the versions supported by this kl (up to %s), please update kl by running \"kl update\"", from, KLFileLatestVersion)
+	}
+
+	for ; current < latest; current++ {
+		migrate, ok := klFileMigrations[current]
+		if !ok {
+			return "", fn.Errorf("no migration available for kl file version v%d", current)
+		}
+
+		if err := migrate(root); err != nil {
+			return "", fn.NewE(err, fmt.Sprintf("failed to migrate kl file from v%d", current))
+		}
+
+		setMappingScalar(root, "version", fmt.Sprintf("v%d", current+1))
+	}
+
+	return from, nil
+}
+
+// MigrateKLFileContent upgrades raw kl.yml content to KLFileLatestVersion,
+// migrated is false when the content is already at the latest version
+func MigrateKLFileContent(b []byte) (out []byte, migrated bool, err error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(b, &doc); err != nil {
+		return nil, false, fn.NewE(err, "failed to parse kl file")
+	}
+
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode {
+		return b, false, nil
+	}
+
+	root := doc.Content[0]
+	if verrs := validateKLFileVersion(root); len(verrs) > 0 {
+		return nil, false, verrs
+	}
+
+	if klFileVersionOf(root) == KLFileLatestVersion {
+		return b, false, nil
+	}
+
+	if _, err := migrateKLFileNode(root); err != nil {
+		return nil, false, fn.NewE(err)
+	}
+
+	out, err = confighandler.PatchYAML(b, root)
+	if err != nil {
+		return nil, false, fn.NewE(err)
+	}
+
+	return out, true, nil
+}
@@ -0,0 +1,61 @@
+package fileclient
+
+import (
+	"slices"
+	"strings"
+)
+
+// BoxPlatforms are the nix systems boxes run on
+var BoxPlatforms = []string{"x86_64-linux", "aarch64-linux"}
+
+// LockPlatforms returns the platforms packages of kf are locked for in
+// kl.lock, every platform boxes run on when kl.yml lists none
+func (kf *KLFileType) LockPlatforms() []string {
+	if len(kf.Platforms) == 0 {
+		return slices.Clone(BoxPlatforms)
+	}
+
+	return slices.Clone(kf.Platforms)
+}
+
+// flake reference schemes packages of kl.yml can be installed from, see
+// https://nixos.org/manual/nix/stable/command-ref/new-cli/nix3-flake#url-like-syntax
+var packageSourceSchemes = []string{"github:", "gitlab:", "sourcehut:", "git+", "hg+", "path:", "tarball+", "file+", "http://", "https://", "flake:"}
+
+// IsPackageSource reports whether pkg of kl.yml is a flake reference or a
+// .nix file rather than a name@version resolved from nixpkgs
+func IsPackageSource(pkg string) bool {
+	if strings.HasSuffix(pkg, ".nix") || IsLocalPackageSource(pkg) {
+		return true
+	}
+
+	for _, s := range packageSourceSchemes {
+		if strings.HasPrefix(pkg, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsLocalPackageSource reports whether pkg is a flake or .nix file on the
+// local filesystem, such as path:./nix#tool, ./nix#tool or ./tool.nix
+func IsLocalPackageSource(pkg string) bool {
+	for _, p := range []string{"path:", "./", "../", "/"} {
+		if strings.HasPrefix(pkg, p) {
+			return true
+		}
+	}
+
+	return strings.HasSuffix(pkg, ".nix") && !strings.Contains(pkg, ":")
+}
+
+// packageName is what packages of kl.yml are merged by, a package source is
+// its own name
+func packageName(pkg string) string {
+	if IsPackageSource(pkg) {
+		return pkg
+	}
+
+	return strings.Split(pkg, "@")[0]
+}
@@ -0,0 +1,248 @@
+package fileclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	fn "github.com/kloudlite/kl/pkg/functions"
+)
+
+const (
+	PortProtocolTCP = "tcp"
+	PortProtocolUDP = "udp"
+)
+
+// PortMapping is an entry of ports of kl.yml, written as
+// [bind:][host:]container[/protocol]. a bare port such as 8080 exposes port
+// 8080 of the box on port 8080 of every address of the host over tcp and
+// udp, 127.0.0.1:3000:80/udp exposes udp port 80 of the box on
+// 127.0.0.1:3000
+type PortMapping struct {
+	// Bind is the host address listened on, every address when empty
+	Bind      string
+	Host      int
+	Container int
+	// Protocol is tcp or udp, both when empty
+	Protocol string
+}
+
+type Ports []PortMapping
+
+// NewPortMapping exposes port of the box on the same port of the host, over
+// tcp and udp
+func NewPortMapping(port int) PortMapping {
+	return PortMapping{Host: port, Container: port}
+}
+
+func parsePortNumber(s string) (int, error) {
+	p, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, fn.Errorf("port %q is not a valid number", s)
+	}
+
+	if p < 1 || p > 65535 {
+		return 0, fn.Errorf("port %d is out of range, must be between 1 and 65535", p)
+	}
+
+	return p, nil
+}
+
+// ParsePortMapping parses [bind:][host:]container[/protocol]
+func ParsePortMapping(s string) (PortMapping, error) {
+	spec, proto, ok := strings.Cut(strings.TrimSpace(s), "/")
+
+	pm := PortMapping{Protocol: strings.ToLower(proto)}
+	if ok && pm.Protocol != PortProtocolTCP && pm.Protocol != PortProtocolUDP {
+		return PortMapping{}, fn.Errorf("port %q has unknown protocol %q, must be tcp or udp", s, proto)
+	}
+
+	// the bind address can be an ipv6 address in brackets, [::1]:8080:80
+	if strings.HasPrefix(spec, "[") {
+		i := strings.Index(spec, "]:")
+		if i == -1 {
+			return PortMapping{}, fn.Errorf("port %q must be in format of [bind:][host:]container[/protocol]", s)
+		}
+		pm.Bind, spec = spec[1:i], spec[i+2:]
+	}
+
+	parts := strings.Split(spec, ":")
+	if len(parts) > 3 || (pm.Bind != "" && len(parts) != 2) {
+		return PortMapping{}, fn.Errorf("port %q must be in format of [bind:][host:]container[/protocol]", s)
+	}
+
+	if len(parts) == 3 {
+		pm.Bind, parts = parts[0], parts[1:]
+	}
+
+	if pm.Bind != "" && net.ParseIP(pm.Bind) == nil {
+		return PortMapping{}, fn.Errorf("port %q has invalid bind address %q", s, pm.Bind)
+	}
+
+	var err error
+	if pm.Container, err = parsePortNumber(parts[len(parts)-1]); err != nil {
+		return PortMapping{}, err
+	}
+
+	pm.Host = pm.Container
+	if len(parts) == 2 {
+		if pm.Host, err = parsePortNumber(parts[0]); err != nil {
+			return PortMapping{}, err
+		}
+	}
+
+	return pm, nil
+}
+
+// String formats p the way it is written in kl.yml, parts which have their
+// default value are left out
+func (p PortMapping) String() string {
+	s := strconv.Itoa(p.Container)
+	if p.Host != p.Container || p.Bind != "" {
+		s = fmt.Sprintf("%d:%s", p.Host, s)
+	}
+
+	if p.Bind != "" {
+		bind := p.Bind
+		if strings.Contains(bind, ":") {
+			bind = "[" + bind + "]"
+		}
+		s = fmt.Sprintf("%s:%s", bind, s)
+	}
+
+	if p.Protocol != "" {
+		s = fmt.Sprintf("%s/%s", s, p.Protocol)
+	}
+
+	return s
+}
+
+// HostAddress is where p listens on the host
+func (p PortMapping) HostAddress() string {
+	bind := p.Bind
+	if bind == "" {
+		bind = "0.0.0.0"
+	}
+
+	return fmt.Sprintf("%s/%s", net.JoinHostPort(bind, strconv.Itoa(p.Host)), strings.Join(p.Protocols(), "+"))
+}
+
+// Protocols returns the protocols p is exposed over
+func (p PortMapping) Protocols() []string {
+	if p.Protocol == "" {
+		return []string{PortProtocolTCP, PortProtocolUDP}
+	}
+
+	return []string{p.Protocol}
+}
+
+// Split returns a mapping of p for each of its protocols
+func (p PortMapping) Split() Ports {
+	resp := make(Ports, 0, 2)
+	for _, proto := range p.Protocols() {
+		pm := p
+		pm.Protocol = proto
+		resp = append(resp, pm)
+	}
+
+	return resp
+}
+
+// Conflicts reports whether p and o listen on the same port of the host
+func (p PortMapping) Conflicts(o PortMapping) bool {
+	if p.Host != o.Host || (p.Bind != "" && o.Bind != "" && p.Bind != o.Bind) {
+		return false
+	}
+
+	return p.Protocol == "" || o.Protocol == "" || p.Protocol == o.Protocol
+}
+
+// isBare reports whether p is written as a plain number
+func (p PortMapping) isBare() bool {
+	return p.Bind == "" && p.Host == p.Container && p.Protocol == ""
+}
+
+func (p PortMapping) MarshalYAML() (interface{}, error) {
+	if p.isBare() {
+		return p.Container, nil
+	}
+
+	return p.String(), nil
+}
+
+func (p *PortMapping) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	pm, err := ParsePortMapping(s)
+	if err != nil {
+		return err
+	}
+
+	*p = pm
+	return nil
+}
+
+func (p PortMapping) MarshalJSON() ([]byte, error) {
+	if p.isBare() {
+		return json.Marshal(p.Container)
+	}
+
+	return json.Marshal(p.String())
+}
+
+func (p *PortMapping) UnmarshalJSON(b []byte) error {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	s := fmt.Sprint(v)
+	if f, ok := v.(float64); ok {
+		s = strconv.Itoa(int(f))
+	}
+
+	pm, err := ParsePortMapping(s)
+	if err != nil {
+		return err
+	}
+
+	*p = pm
+	return nil
+}
+
+// Index returns the index of the mapping in ps which conflicts with p, -1
+// when there is none
+func (ps Ports) Index(p PortMapping) int {
+	for i, o := range ps {
+		if o.Conflicts(p) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Split returns a mapping for each protocol of every mapping of ps
+func (ps Ports) Split() Ports {
+	resp := make(Ports, 0, len(ps))
+	for _, p := range ps {
+		resp = append(resp, p.Split()...)
+	}
+
+	return resp
+}
+
+// Strings returns every mapping of ps formatted as in kl.yml
+func (ps Ports) Strings() []string {
+	resp := make([]string, 0, len(ps))
+	for _, p := range ps {
+		resp = append(resp, p.String())
+	}
+
+	return resp
+}
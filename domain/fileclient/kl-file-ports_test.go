@@ -0,0 +1,199 @@
+package fileclient
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParsePortMapping(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    PortMapping
+		str     string
+		wantErr string
+	}{
+		{spec: "8080", want: PortMapping{Host: 8080, Container: 8080}, str: "8080"},
+		{spec: " 8080 ", want: PortMapping{Host: 8080, Container: 8080}, str: "8080"},
+		{spec: "3000:80", want: PortMapping{Host: 3000, Container: 80}, str: "3000:80"},
+		{spec: "80/udp", want: PortMapping{Host: 80, Container: 80, Protocol: "udp"}, str: "80/udp"},
+		{spec: "80/TCP", want: PortMapping{Host: 80, Container: 80, Protocol: "tcp"}, str: "80/tcp"},
+		{spec: "127.0.0.1:3000:80/udp", want: PortMapping{Bind: "127.0.0.1", Host: 3000, Container: 80, Protocol: "udp"}, str: "127.0.0.1:3000:80/udp"},
+		{spec: "127.0.0.1:80:80", want: PortMapping{Bind: "127.0.0.1", Host: 80, Container: 80}, str: "127.0.0.1:80:80"},
+		{spec: "[::1]:8080:80", want: PortMapping{Bind: "::1", Host: 8080, Container: 80}, str: "[::1]:8080:80"},
+		{spec: "[fe80::1]:53:53/udp", want: PortMapping{Bind: "fe80::1", Host: 53, Container: 53, Protocol: "udp"}, str: "[fe80::1]:53:53/udp"},
+		{spec: "[::]:80:80/tcp", want: PortMapping{Bind: "::", Host: 80, Container: 80, Protocol: "tcp"}, str: "[::]:80:80/tcp"},
+		{spec: "80/", wantErr: `unknown protocol ""`},
+		{spec: "80/sctp", wantErr: `unknown protocol "sctp"`},
+		{spec: "http", wantErr: `port "http" is not a valid number`},
+		{spec: "0", wantErr: "port 0 is out of range"},
+		{spec: "65536", wantErr: "port 65536 is out of range"},
+		{spec: "3000:70000", wantErr: "port 70000 is out of range"},
+		{spec: "1:2:3:4", wantErr: "must be in format of [bind:][host:]container[/protocol]"},
+		{spec: "::1:8080:80", wantErr: "must be in format of [bind:][host:]container[/protocol]"},
+		{spec: "[::1]:80", wantErr: "must be in format of [bind:][host:]container[/protocol]"},
+		{spec: "[::1]:1:2:3", wantErr: "must be in format of [bind:][host:]container[/protocol]"},
+		{spec: "[::1:8080:80", wantErr: "must be in format of [bind:][host:]container[/protocol]"},
+		{spec: "localhost:3000:80", wantErr: `invalid bind address "localhost"`},
+		{spec: "[not-ip]:3000:80", wantErr: `invalid bind address "not-ip"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParsePortMapping(tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+
+			if s := got.String(); s != tt.str {
+				t.Errorf("String() = %q, want %q", s, tt.str)
+			}
+
+			// the formatted mapping parses back to the same mapping
+			if again, err := ParsePortMapping(got.String()); err != nil || again != got {
+				t.Errorf("%q parsed back to %+v, %v", got.String(), again, err)
+			}
+		})
+	}
+}
+
+func TestPortMappingHostAddress(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{spec: "8080", want: "0.0.0.0:8080/tcp+udp"},
+		{spec: "8080/tcp", want: "0.0.0.0:8080/tcp"},
+		{spec: "127.0.0.1:3000:80/udp", want: "127.0.0.1:3000/udp"},
+		{spec: "[::1]:8080:80", want: "[::1]:8080/tcp+udp"},
+	}
+
+	for _, tt := range tests {
+		pm, err := ParsePortMapping(tt.spec)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.spec, err)
+		}
+
+		if got := pm.HostAddress(); got != tt.want {
+			t.Errorf("%s: HostAddress() = %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestPortMappingConflicts(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "8080", b: "8080:80", want: true},
+		{a: "8080", b: "8080/udp", want: true},
+		{a: "8080/tcp", b: "8080/udp", want: false},
+		{a: "8080/tcp", b: "8080/tcp", want: true},
+		{a: "8080", b: "[::1]:8080:80", want: true},
+		{a: "127.0.0.1:8080:80", b: "[::1]:8080:80", want: false},
+		{a: "[::1]:8080:80", b: "[::1]:8080:90", want: true},
+		{a: "3000:80", b: "3001:80", want: false},
+	}
+
+	for _, tt := range tests {
+		a, err := ParsePortMapping(tt.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ParsePortMapping(tt.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := a.Conflicts(b); got != tt.want {
+			t.Errorf("%s conflicts with %s = %t, want %t", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestPortsSplit(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		// bare ports are exposed over tcp and udp, as before protocols could
+		// be given
+		{spec: "8080", want: []string{"8080/tcp", "8080/udp"}},
+		{spec: "127.0.0.1:3000:80", want: []string{"127.0.0.1:3000:80/tcp", "127.0.0.1:3000:80/udp"}},
+		{spec: "8080/tcp", want: []string{"8080/tcp"}},
+		{spec: "53/udp", want: []string{"53/udp"}},
+	}
+
+	for _, tt := range tests {
+		pm, err := ParsePortMapping(tt.spec)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.spec, err)
+		}
+
+		if got := pm.Split().Strings(); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s: Split() = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestPortsEncoding(t *testing.T) {
+	in := "- 8080\n- 3000:80\n- '[::1]:53:53/udp'\n"
+
+	var ps Ports
+	if err := yaml.Unmarshal([]byte(in), &ps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := Ports{
+		{Host: 8080, Container: 8080},
+		{Host: 3000, Container: 80},
+		{Bind: "::1", Host: 53, Container: 53, Protocol: "udp"},
+	}
+	if len(ps) != len(want) {
+		t.Fatalf("got %+v, want %+v", ps, want)
+	}
+	for i := range want {
+		if ps[i] != want[i] {
+			t.Errorf("port %d = %+v, want %+v", i, ps[i], want[i])
+		}
+	}
+
+	b, err := yaml.Marshal(ps)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(b) != "- 8080\n- 3000:80\n- '[::1]:53:53/udp'\n" {
+		t.Errorf("got yaml %q", b)
+	}
+
+	jb, err := json.Marshal(ps)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(jb) != `[8080,"3000:80","[::1]:53:53/udp"]` {
+		t.Errorf("got json %s", jb)
+	}
+
+	var fromJSON Ports
+	if err := json.Unmarshal(jb, &fromJSON); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := range want {
+		if fromJSON[i] != want[i] {
+			t.Errorf("port %d from json = %+v, want %+v", i, fromJSON[i], want[i])
+		}
+	}
+}
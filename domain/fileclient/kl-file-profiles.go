@@ -0,0 +1,83 @@
+package fileclient
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	fn "github.com/kloudlite/kl/pkg/functions"
+)
+
+// KLProfile is a named set of packages, env vars, mounts and ports, which is
+// merged over kl.yml (with the same rules as overlays) when it is active
+type KLProfile struct {
+	Packages []string `json:"packages,omitempty" yaml:"packages,omitempty"`
+	EnvVars  EnvVars  `json:"envVars,omitempty" yaml:"envVars,omitempty"`
+	Mounts   Mounts   `json:"mounts,omitempty" yaml:"mounts,omitempty"`
+	Ports    Ports    `json:"ports,omitempty" yaml:"ports,omitempty"`
+}
+
+const klProfileEnv = "KL_PROFILE"
+
+// ResolveProfile returns name of the active profile, --profile flag (which
+// is exported as KL_PROFILE) wins over the KL_PROFILE env, which wins over
+// the profile remembered for the workspace of env. empty name means that no
+// profile is active
+func ResolveProfile(env *Env) string {
+	if s, ok := os.LookupEnv(klProfileEnv); ok {
+		return strings.TrimSpace(s)
+	}
+
+	if env != nil {
+		return env.Profile
+	}
+
+	return ""
+}
+
+func (k *KLFileType) ProfileNames() []string {
+	resp := make([]string, 0, len(k.Profiles))
+	for name := range k.Profiles {
+		resp = append(resp, name)
+	}
+	slices.Sort(resp)
+
+	return resp
+}
+
+// WithProfile returns kl file with profile merged over it, k is returned as
+// is when profile is empty
+func (k *KLFileType) WithProfile(profile string) (*KLFileType, error) {
+	if profile == "" {
+		return k, nil
+	}
+
+	p, ok := k.Profiles[profile]
+	if !ok {
+		if len(k.Profiles) == 0 {
+			return nil, fn.Errorf("profile %q is not defined, kl.yml has no profiles", profile)
+		}
+
+		return nil, fn.Errorf("profile %q is not defined, available profiles are: %s", profile, strings.Join(k.ProfileNames(), ", "))
+	}
+
+	resp := mergeKLFile(k, &KLFileType{
+		Packages: p.Packages,
+		EnvVars:  p.EnvVars,
+		Mounts:   p.Mounts,
+		Ports:    p.Ports,
+	})
+	resp.ActiveProfile = profile
+
+	return resp, nil
+}
+
+// PromptName is how the environment is shown in the prompt of the box
+func PromptName(envName, profile string) string {
+	if profile == "" {
+		return envName
+	}
+
+	return fmt.Sprintf("%s:%s", envName, profile)
+}
@@ -0,0 +1,45 @@
+package fileclient
+
+import (
+	"strings"
+
+	fn "github.com/kloudlite/kl/pkg/functions"
+)
+
+// ReloadSignals are the signals processes of the box can be sent when env
+// vars or mounts are reloaded without restarting the box
+var ReloadSignals = []string{"HUP", "INT", "QUIT", "TERM", "USR1", "USR2", "WINCH"}
+
+// KLReload configures how processes of the box learn about env vars and
+// mounts reloaded into the running box. Signal is sent to every process
+// whose command name is listed in Processes
+type KLReload struct {
+	Signal    string   `json:"signal,omitempty" yaml:"signal,omitempty"`
+	Processes []string `json:"processes,omitempty" yaml:"processes,omitempty"`
+}
+
+// ParseReloadSignal returns s without the SIG prefix, HUP for SIGHUP
+func ParseReloadSignal(s string) (string, error) {
+	sig := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "SIG")
+	for _, rs := range ReloadSignals {
+		if rs == sig {
+			return sig, nil
+		}
+	}
+
+	return "", fn.Errorf("unknown signal %q, must be one of SIG%s", s, strings.Join(ReloadSignals, ", SIG"))
+}
+
+// GetSignal returns the signal of r, SIGHUP when it is not set
+func (r *KLReload) GetSignal() string {
+	if r == nil || r.Signal == "" {
+		return "HUP"
+	}
+
+	sig, err := ParseReloadSignal(r.Signal)
+	if err != nil {
+		return "HUP"
+	}
+
+	return sig
+}
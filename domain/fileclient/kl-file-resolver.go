@@ -0,0 +1,50 @@
+package fileclient
+
+import (
+	"strings"
+
+	fn "github.com/kloudlite/kl/pkg/functions"
+)
+
+type PackageResolverType string
+
+const (
+	// PackageResolverDevbox resolves packages with the search api of devbox,
+	// it is used when kl.yml selects no resolver
+	PackageResolverDevbox PackageResolverType = "devbox"
+	// PackageResolverNix resolves packages from a nixpkgs flake with
+	// `nix search`, the flake can be a local checkout of nixpkgs
+	PackageResolverNix PackageResolverType = "nix"
+	// PackageResolverMirror resolves packages with a mirror serving the search
+	// api of devbox
+	PackageResolverMirror PackageResolverType = "mirror"
+)
+
+var PackageResolverTypes = []PackageResolverType{PackageResolverDevbox, PackageResolverNix, PackageResolverMirror}
+
+// KLPackageResolver selects where packages of kl.yml are searched and
+// resolved, so that teams without access to the internet can use their own
+// nixpkgs or mirror
+type KLPackageResolver struct {
+	Type PackageResolverType `json:"type" yaml:"type"`
+	// Flake is the flake searched by the nix resolver, a flake reference or a
+	// path to a nixpkgs checkout. defaults to nixpkgs of the flake registry
+	Flake string `json:"flake,omitempty" yaml:"flake,omitempty"`
+	// URL is the base url of the mirror
+	URL string `json:"url,omitempty" yaml:"url,omitempty"`
+}
+
+func ParsePackageResolverType(s string) (PackageResolverType, error) {
+	for _, t := range PackageResolverTypes {
+		if string(t) == strings.ToLower(strings.TrimSpace(s)) {
+			return t, nil
+		}
+	}
+
+	names := make([]string, 0, len(PackageResolverTypes))
+	for _, t := range PackageResolverTypes {
+		names = append(names, string(t))
+	}
+
+	return "", fn.Errorf("unknown package resolver %q, must be one of %s", s, strings.Join(names, ", "))
+}
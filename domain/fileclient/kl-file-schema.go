@@ -0,0 +1,661 @@
+package fileclient
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	fn "github.com/kloudlite/kl/pkg/functions"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+const (
+	KLFileVersionV1 = "v1"
+
+	// KLFileLatestVersion is the version written by "kl init"
+	KLFileLatestVersion = KLFileVersionV1
+)
+
+type ValidationError struct {
+	Line    int
+	Column  int
+	Field   string
+	Message string
+}
+
+func (v ValidationError) Error() string {
+	if v.Field == "" {
+		return fmt.Sprintf("%d:%d %s", v.Line, v.Column, v.Message)
+	}
+
+	return fmt.Sprintf("%d:%d %s: %s", v.Line, v.Column, v.Field, v.Message)
+}
+
+type ValidationErrors []ValidationError
+
+func (v ValidationErrors) Error() string {
+	resp := make([]string, 0, len(v))
+	for _, ve := range v {
+		resp = append(resp, ve.Error())
+	}
+
+	return fmt.Sprintf("kl file is not valid, found %d problem(s):\n  %s\nrun \"kl validate\" for more details.", len(v), strings.Join(resp, "\n  "))
+}
+
+type schemaKind string
+
+const (
+	kindString schemaKind = "string"
+	kindInt    schemaKind = "integer"
+	kindList   schemaKind = "list"
+	kindObject schemaKind = "object"
+)
+
+// schemaNode describes the expected shape of a node in kl.yml, Check is
+// used for the rules which can't be expressed by the shape alone. objects
+// with Values instead of Fields accept any key
+type schemaNode struct {
+	Kind     schemaKind
+	Required bool
+	Fields   map[string]*schemaNode
+	Values   *schemaNode
+	Items    *schemaNode
+	Check    func(v *validator, n *yamlv3.Node, field string)
+}
+
+var envVarsSchema = &schemaNode{
+	Kind: kindList,
+	Items: &schemaNode{
+		Kind: kindObject,
+		Fields: map[string]*schemaNode{
+			"key":       {Kind: kindString, Required: true},
+			"value":     {Kind: kindString, Check: checkInterpolation},
+			"configRef": {Kind: kindString, Check: checkRef},
+			"secretRef": {Kind: kindString, Check: checkRef},
+			"mresRef":   {Kind: kindString, Check: checkRef},
+		},
+		Check: checkEnvVar,
+	},
+	Check: checkUniqueKeys("key", "duplicate env var key"),
+}
+
+var mountsSchema = &schemaNode{
+	Kind: kindList,
+	Items: &schemaNode{
+		Kind: kindObject,
+		Fields: map[string]*schemaNode{
+			"path":      {Kind: kindString, Required: true},
+			"configRef": {Kind: kindString, Check: checkRef},
+			"secretRef": {Kind: kindString, Check: checkRef},
+		},
+		Check: checkOneOf("configRef", "secretRef"),
+	},
+	Check: checkUniqueKeys("path", "duplicate mount path"),
+}
+
+var portsSchema = &schemaNode{
+	Kind:  kindList,
+	Items: &schemaNode{Kind: kindString, Check: checkPortMapping},
+	Check: checkUniquePorts,
+}
+
+var packagesSchema = &schemaNode{
+	Kind:  kindList,
+	Items: &schemaNode{Kind: kindString, Check: checkPackage},
+	Check: checkUniqueScalars("duplicate package"),
+}
+
+var profilesSchema = &schemaNode{
+	Kind: kindObject,
+	Values: &schemaNode{
+		Kind: kindObject,
+		Fields: map[string]*schemaNode{
+			"packages": packagesSchema,
+			"envVars":  envVarsSchema,
+			"mounts":   mountsSchema,
+			"ports":    portsSchema,
+		},
+	},
+	Check: checkProfileNames,
+}
+
+var hookSchema = &schemaNode{
+	Kind:  kindList,
+	Items: &schemaNode{Kind: kindString, Check: checkHookCommand},
+}
+
+var hooksSchema = &schemaNode{
+	Kind: kindObject,
+	Fields: map[string]*schemaNode{
+		string(HookOnCreate):  hookSchema,
+		string(HookPostStart): hookSchema,
+		string(HookOnReload):  hookSchema,
+		string(HookPreStop):   hookSchema,
+	},
+}
+
+var packageResolverSchema = &schemaNode{
+	Kind: kindObject,
+	Fields: map[string]*schemaNode{
+		"type":  {Kind: kindString, Required: true, Check: checkPackageResolverType},
+		"flake": {Kind: kindString},
+		"url":   {Kind: kindString, Check: checkURL},
+	},
+	Check: checkPackageResolver,
+}
+
+var platformsSchema = &schemaNode{
+	Kind:  kindList,
+	Items: &schemaNode{Kind: kindString, Check: checkPlatform},
+	Check: checkUniqueScalars("duplicate platform"),
+}
+
+var boxSchema = &schemaNode{
+	Kind: kindObject,
+	Fields: map[string]*schemaNode{
+		"image":      {Kind: kindString},
+		"dockerfile": {Kind: kindString, Check: checkWorkspacePath},
+		"context":    {Kind: kindString, Check: checkWorkspacePath},
+	},
+	Check: checkBox,
+}
+
+var reloadSchema = &schemaNode{
+	Kind: kindObject,
+	Fields: map[string]*schemaNode{
+		"signal": {Kind: kindString, Check: checkReloadSignal},
+		"processes": {
+			Kind:  kindList,
+			Items: &schemaNode{Kind: kindString, Check: checkProcessName},
+			Check: checkUniqueScalars("duplicate process"),
+		},
+	},
+}
+
+var portRangesSchema = &schemaNode{
+	Kind:  kindList,
+	Items: &schemaNode{Kind: kindString, Check: checkPortRange},
+	Check: checkUniqueScalars("duplicate port range"),
+}
+
+var exposeSchema = &schemaNode{
+	Kind: kindObject,
+	Fields: map[string]*schemaNode{
+		"allow": portRangesSchema,
+		"deny":  portRangesSchema,
+	},
+}
+
+var klFileSchemas = map[string]*schemaNode{
+	KLFileVersionV1: {
+		Kind: kindObject,
+		Fields: map[string]*schemaNode{
+			"version":    {Kind: kindString},
+			"teamName":   {Kind: kindString, Required: true},
+			"defaultEnv": {Kind: kindString, Required: true},
+			"packages":   packagesSchema,
+			"envVars":    envVarsSchema,
+			"mounts":     mountsSchema,
+			"ports":      portsSchema,
+			"profiles":   profilesSchema,
+			"hooks":      hooksSchema,
+
+			"packageResolver": packageResolverSchema,
+			"platforms":       platformsSchema,
+
+			"box":    boxSchema,
+			"reload": reloadSchema,
+			"expose": exposeSchema,
+		},
+	},
+}
+
+type validator struct {
+	errs ValidationErrors
+}
+
+func (v *validator) report(n *yamlv3.Node, field string, format string, args ...any) {
+	v.errs = append(v.errs, ValidationError{
+		Line:    n.Line,
+		Column:  n.Column,
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func joinField(parent, child string) string {
+	if parent == "" {
+		return child
+	}
+
+	return fmt.Sprintf("%s.%s", parent, child)
+}
+
+func nodeKind(n *yamlv3.Node) schemaKind {
+	switch n.Kind {
+	case yamlv3.MappingNode:
+		return kindObject
+	case yamlv3.SequenceNode:
+		return kindList
+	case yamlv3.ScalarNode:
+		if n.Tag == "!!int" {
+			return kindInt
+		}
+		return kindString
+	}
+
+	return ""
+}
+
+func (v *validator) validate(n *yamlv3.Node, s *schemaNode, field string) {
+	if n.Kind == yamlv3.AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+
+	// null values are same as the field not being set
+	if n.Kind == yamlv3.ScalarNode && n.Tag == "!!null" {
+		return
+	}
+
+	kind := nodeKind(n)
+	if kind != s.Kind {
+		// every scalar is accepted where string is expected
+		if !(s.Kind == kindString && n.Kind == yamlv3.ScalarNode) {
+			v.report(n, field, "expected %s, got %s", s.Kind, kind)
+			return
+		}
+	}
+
+	switch s.Kind {
+	case kindObject:
+		seen := map[string]bool{}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, val := n.Content[i], n.Content[i+1]
+			if seen[k.Value] {
+				v.report(k, joinField(field, k.Value), "key is defined more than once")
+				continue
+			}
+			seen[k.Value] = true
+
+			fs, ok := s.Fields[k.Value]
+			if s.Values != nil {
+				fs, ok = s.Values, true
+			}
+			if !ok {
+				v.report(k, joinField(field, k.Value), "unknown field%s", suggestField(k.Value, s.Fields))
+				continue
+			}
+
+			v.validate(val, fs, joinField(field, k.Value))
+		}
+
+		required := make([]string, 0)
+		for k, fs := range s.Fields {
+			if fs.Required && !seen[k] {
+				required = append(required, k)
+			}
+		}
+		sort.Strings(required)
+		for _, k := range required {
+			v.report(n, joinField(field, k), "is required")
+		}
+
+	case kindList:
+		for i, item := range n.Content {
+			v.validate(item, s.Items, fmt.Sprintf("%s[%d]", field, i))
+		}
+	}
+
+	if s.Check != nil {
+		s.Check(v, n, field)
+	}
+}
+
+func suggestField(key string, fields map[string]*schemaNode) string {
+	for k := range fields {
+		if strings.EqualFold(k, key) {
+			return fmt.Sprintf(", did you mean %q?", k)
+		}
+	}
+
+	return ""
+}
+
+func mappingValue(n *yamlv3.Node, key string) *yamlv3.Node {
+	if n.Kind != yamlv3.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			if n.Content[i+1].Tag == "!!null" {
+				return nil
+			}
+			return n.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+func checkRef(v *validator, n *yamlv3.Node, field string) {
+	s := strings.Split(n.Value, "/")
+	if len(s) != 2 || strings.TrimSpace(s[0]) == "" || strings.TrimSpace(s[1]) == "" {
+		v.report(n, field, "reference %q must be in format of name/key", n.Value)
+	}
+}
+
+func checkEnvVar(v *validator, n *yamlv3.Node, field string) {
+	set := make([]string, 0)
+	for _, k := range []string{"value", "configRef", "secretRef", "mresRef"} {
+		if mappingValue(n, k) != nil {
+			set = append(set, k)
+		}
+	}
+
+	switch len(set) {
+	case 0:
+		v.report(n, field, "one of value, configRef, secretRef or mresRef must be set")
+	case 1:
+	default:
+		v.report(n, field, "only one of value, configRef, secretRef or mresRef can be set, found %s", strings.Join(set, " and "))
+	}
+}
+
+func checkOneOf(keys ...string) func(v *validator, n *yamlv3.Node, field string) {
+	return func(v *validator, n *yamlv3.Node, field string) {
+		set := make([]string, 0)
+		for _, k := range keys {
+			if mappingValue(n, k) != nil {
+				set = append(set, k)
+			}
+		}
+
+		switch len(set) {
+		case 0:
+			v.report(n, field, "one of %s must be set", strings.Join(keys, " or "))
+		case 1:
+		default:
+			v.report(n, field, "only one of %s can be set, found %s", strings.Join(keys, " or "), strings.Join(set, " and "))
+		}
+	}
+}
+
+func checkUniqueKeys(key string, msg string) func(v *validator, n *yamlv3.Node, field string) {
+	return func(v *validator, n *yamlv3.Node, field string) {
+		hist := map[string]int{}
+		for i, item := range n.Content {
+			kn := mappingValue(item, key)
+			if kn == nil {
+				continue
+			}
+
+			if j, ok := hist[kn.Value]; ok {
+				v.report(kn, fmt.Sprintf("%s[%d].%s", field, i, key), "%s %q, already defined at %s[%d]", msg, kn.Value, field, j)
+				continue
+			}
+			hist[kn.Value] = i
+		}
+	}
+}
+
+func checkUniqueScalars(msg string) func(v *validator, n *yamlv3.Node, field string) {
+	return func(v *validator, n *yamlv3.Node, field string) {
+		hist := map[string]int{}
+		for i, item := range n.Content {
+			if item.Kind != yamlv3.ScalarNode {
+				continue
+			}
+
+			if j, ok := hist[item.Value]; ok {
+				v.report(item, fmt.Sprintf("%s[%d]", field, i), "%s %q, already defined at %s[%d]", msg, item.Value, field, j)
+				continue
+			}
+			hist[item.Value] = i
+		}
+	}
+}
+
+func checkInterpolation(v *validator, n *yamlv3.Node, field string) {
+	if _, err := expandVars(n.Value, func(ref string) (string, error) {
+		_, _, err := parseRef(ref)
+		return "", err
+	}); err != nil {
+		v.report(n, field, "%s", err.Error())
+	}
+}
+
+func checkProfileNames(v *validator, n *yamlv3.Node, field string) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k := n.Content[i]
+		if strings.TrimSpace(k.Value) == "" || strings.ContainsAny(k.Value, " \t/:") {
+			v.report(k, joinField(field, k.Value), "profile name %q must not be empty or contain spaces, '/' or ':'", k.Value)
+		}
+	}
+}
+
+func checkHookCommand(v *validator, n *yamlv3.Node, field string) {
+	if strings.TrimSpace(n.Value) == "" {
+		v.report(n, field, "hook command can't be empty")
+	}
+}
+
+func checkPackageResolverType(v *validator, n *yamlv3.Node, field string) {
+	if _, err := ParsePackageResolverType(n.Value); err != nil {
+		v.report(n, field, "%s", err.Error())
+	}
+}
+
+// checkPackageResolver checks that url is set only for, and always for, the
+// mirror resolver, and flake only for the nix resolver
+func checkPackageResolver(v *validator, n *yamlv3.Node, field string) {
+	tn := mappingValue(n, "type")
+	if tn == nil {
+		return
+	}
+
+	t, err := ParsePackageResolverType(tn.Value)
+	if err != nil {
+		return
+	}
+
+	if u := mappingValue(n, "url"); u != nil && t != PackageResolverMirror {
+		v.report(u, joinField(field, "url"), "url can only be set for the %s resolver", PackageResolverMirror)
+	}
+	if f := mappingValue(n, "flake"); f != nil && t != PackageResolverNix {
+		v.report(f, joinField(field, "flake"), "flake can only be set for the %s resolver", PackageResolverNix)
+	}
+	if t == PackageResolverMirror && mappingValue(n, "url") == nil {
+		v.report(n, joinField(field, "url"), "url is required for the %s resolver", PackageResolverMirror)
+	}
+}
+
+func checkPlatform(v *validator, n *yamlv3.Node, field string) {
+	if !slices.Contains(BoxPlatforms, n.Value) {
+		v.report(n, field, "unknown platform %q, must be one of %s", n.Value, strings.Join(BoxPlatforms, ", "))
+	}
+}
+
+// checkBox checks that only one of image or dockerfile is set, and context
+// only with dockerfile
+func checkBox(v *validator, n *yamlv3.Node, field string) {
+	checkOneOf("image", "dockerfile")(v, n, field)
+
+	if c := mappingValue(n, "context"); c != nil && mappingValue(n, "dockerfile") == nil {
+		v.report(c, joinField(field, "context"), "context can only be set with dockerfile")
+	}
+}
+
+func checkReloadSignal(v *validator, n *yamlv3.Node, field string) {
+	if _, err := ParseReloadSignal(n.Value); err != nil {
+		v.report(n, field, "%s", err.Error())
+	}
+}
+
+// checkProcessName checks names of processes, they are matched against the
+// command name of processes which is at most 15 characters long
+func checkProcessName(v *validator, n *yamlv3.Node, field string) {
+	switch {
+	case strings.TrimSpace(n.Value) == "" || strings.Contains(n.Value, "/"):
+		v.report(n, field, "process name %q must not be empty or contain '/'", n.Value)
+	case len(n.Value) > 15:
+		v.report(n, field, "process name %q is longer than 15 characters, use the first 15 characters of it", n.Value)
+	}
+}
+
+func checkWorkspacePath(v *validator, n *yamlv3.Node, field string) {
+	p := strings.TrimSpace(n.Value)
+	if p == "" {
+		v.report(n, field, "path can't be empty")
+		return
+	}
+
+	if strings.HasPrefix(p, "/") || p == ".." || strings.HasPrefix(p, "../") {
+		v.report(n, field, "path %q must be inside the workspace and relative to it", n.Value)
+	}
+}
+
+func checkURL(v *validator, n *yamlv3.Node, field string) {
+	u, err := url.Parse(n.Value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.report(n, field, "%q must be an http or https url", n.Value)
+	}
+}
+
+func checkPortRange(v *validator, n *yamlv3.Node, field string) {
+	if _, _, err := ParsePortRange(n.Value); err != nil {
+		v.report(n, field, "%s", err.Error())
+	}
+}
+
+func checkPortMapping(v *validator, n *yamlv3.Node, field string) {
+	if _, err := ParsePortMapping(n.Value); err != nil {
+		v.report(n, field, "%s", err.Error())
+	}
+}
+
+// checkUniquePorts reports ports which listen on the same port of the host
+// as an earlier one
+func checkUniquePorts(v *validator, n *yamlv3.Node, field string) {
+	ports := make(Ports, 0, len(n.Content))
+	for i, item := range n.Content {
+		pm, err := ParsePortMapping(item.Value)
+		if err != nil {
+			ports = append(ports, PortMapping{})
+			continue
+		}
+
+		if j := ports.Index(pm); j != -1 {
+			v.report(item, fmt.Sprintf("%s[%d]", field, i), "port %q listens on %s, already used by %s[%d]", item.Value, pm.HostAddress(), field, j)
+		}
+		ports = append(ports, pm)
+	}
+}
+
+func checkPackage(v *validator, n *yamlv3.Node, field string) {
+	if strings.TrimSpace(n.Value) == "" {
+		v.report(n, field, "package name can't be empty")
+		return
+	}
+
+	if IsPackageSource(n.Value) {
+		if strings.HasPrefix(strings.TrimPrefix(n.Value, "path:"), "/") {
+			v.report(n, field, "package %q must be relative to the workspace, only the workspace is mounted in the box", n.Value)
+		}
+		return
+	}
+
+	s := strings.Split(n.Value, "@")
+	if len(s) > 2 || strings.TrimSpace(s[0]) == "" || (len(s) == 2 && strings.TrimSpace(s[1]) == "") {
+		v.report(n, field, "package %q must be in format of name or name@version", n.Value)
+	}
+}
+
+// overlaySchema relaxes the top-level required fields of s, overlays only
+// carry the fields they override
+func overlaySchema(s *schemaNode) *schemaNode {
+	resp := *s
+	resp.Fields = make(map[string]*schemaNode, len(s.Fields))
+	for k, fs := range s.Fields {
+		f := *fs
+		f.Required = false
+		resp.Fields[k] = &f
+	}
+
+	return &resp
+}
+
+// ValidateKLFileContent validates the raw kl.yml content against the schema
+// of the version it declares, and returns every problem found
+func ValidateKLFileContent(b []byte) (ValidationErrors, error) {
+	return validateKLFileContent(b, false)
+}
+
+// ValidateKLFileOverlayContent validates the raw content of an overlay such
+// as kl.local.yml, overlays without a version are read as the latest version
+func ValidateKLFileOverlayContent(b []byte) (ValidationErrors, error) {
+	return validateKLFileContent(b, true)
+}
+
+func validateKLFileContent(b []byte, overlay bool) (ValidationErrors, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(b, &doc); err != nil {
+		return nil, fn.NewE(err, "failed to parse kl file")
+	}
+
+	v := &validator{}
+
+	if len(doc.Content) == 0 {
+		if overlay {
+			return nil, nil
+		}
+		v.report(&yamlv3.Node{Line: 1, Column: 1}, "", "kl file is empty")
+		return v.errs, nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yamlv3.MappingNode {
+		v.report(root, "", "kl file must be a yaml object")
+		return v.errs, nil
+	}
+
+	// the version is checked first, as the rest of the file is validated
+	// against the schema it will be migrated to
+	if verrs := validateKLFileVersion(root); len(verrs) > 0 {
+		return verrs, nil
+	}
+
+	if overlay && mappingValue(root, "version") == nil {
+		setMappingScalar(root, "version", KLFileLatestVersion)
+	}
+
+	if _, err := migrateKLFileNode(root); err != nil {
+		v.report(root, "version", "%s", err.Error())
+		return v.errs, nil
+	}
+
+	schema, ok := klFileSchemas[klFileVersionOf(root)]
+	if !ok {
+		return nil, fn.Errorf("no schema available for kl file version %s", klFileVersionOf(root))
+	}
+
+	if overlay {
+		schema = overlaySchema(schema)
+	}
+
+	v.validate(root, schema, "")
+	if len(v.errs) == 0 {
+		return nil, nil
+	}
+
+	sort.SliceStable(v.errs, func(i, j int) bool {
+		if v.errs[i].Line == v.errs[j].Line {
+			return v.errs[i].Column < v.errs[j].Column
+		}
+		return v.errs[i].Line < v.errs[j].Line
+	})
+
+	return v.errs, nil
+}
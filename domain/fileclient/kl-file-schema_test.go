@@ -0,0 +1,250 @@
+package fileclient
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateKLFileContent(t *testing.T) {
+	type want struct {
+		line    int
+		column  int
+		field   string
+		message string
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    []want
+	}{
+		{
+			name: "valid",
+			content: `version: v1
+teamName: team
+defaultEnv: dev
+packages:
+  - go@1.22
+  - neovim
+envVars:
+  - key: A
+    value: a
+  - key: B
+    secretRef: s/b
+mounts:
+  - path: /tmp/c
+    configRef: c/c
+ports:
+  - 8080
+  - 127.0.0.1:9000:80/udp
+`,
+		},
+		{
+			name:    "empty",
+			content: "",
+			want:    []want{{1, 1, "", "kl file is empty"}},
+		},
+		{
+			name:    "not an object",
+			content: "- a\n- b\n",
+			want:    []want{{1, 1, "", "kl file must be a yaml object"}},
+		},
+		{
+			name:    "required fields",
+			content: "version: v1\n",
+			want: []want{
+				{1, 1, "defaultEnv", "is required"},
+				{1, 1, "teamName", "is required"},
+			},
+		},
+		{
+			name:    "unknown field with suggestion",
+			content: "teamName: team\ndefaultEnv: dev\nPackages: []\n",
+			want:    []want{{3, 1, "Packages", `unknown field, did you mean "packages"?`}},
+		},
+		{
+			name:    "wrong kind",
+			content: "teamName: team\ndefaultEnv: dev\npackages: neovim\n",
+			want:    []want{{3, 11, "packages", "expected list, got string"}},
+		},
+		{
+			name: "env var without value",
+			content: `teamName: team
+defaultEnv: dev
+envVars:
+  - key: A
+`,
+			want: []want{{4, 5, "envVars[0]", "one of value, configRef, secretRef or mresRef must be set"}},
+		},
+		{
+			name: "env var with several values",
+			content: `teamName: team
+defaultEnv: dev
+envVars:
+  - key: A
+    value: a
+    configRef: c/a
+`,
+			want: []want{{4, 5, "envVars[0]", "only one of value, configRef, secretRef or mresRef can be set, found value and configRef"}},
+		},
+		{
+			name: "bad reference and duplicate key",
+			content: `teamName: team
+defaultEnv: dev
+envVars:
+  - key: A
+    secretRef: a
+  - key: A
+    value: b
+`,
+			want: []want{
+				{5, 16, "envVars[0].secretRef", `reference "a" must be in format of name/key`},
+				{6, 10, "envVars[1].key", `duplicate env var key "A", already defined at envVars[0]`},
+			},
+		},
+		{
+			name: "mount with both refs",
+			content: `teamName: team
+defaultEnv: dev
+mounts:
+  - path: /a
+    configRef: c/a
+    secretRef: s/a
+`,
+			want: []want{{4, 5, "mounts[0]", "only one of configRef or secretRef can be set, found configRef and secretRef"}},
+		},
+		{
+			name: "duplicate host port",
+			content: `teamName: team
+defaultEnv: dev
+ports:
+  - 8080
+  - 8080:80
+`,
+			want: []want{{5, 5, "ports[1]", `port "8080:80" listens on`}},
+		},
+		{
+			name: "invalid package",
+			content: `teamName: team
+defaultEnv: dev
+packages:
+  - go@1@2
+  - go@1@2
+`,
+			want: []want{
+				{4, 5, "packages[0]", `package "go@1@2" must be in format of name or name@version`},
+				{5, 5, "packages[1]", `package "go@1@2" must be in format of name or name@version`},
+				{5, 5, "packages[1]", `duplicate package "go@1@2", already defined at packages[0]`},
+			},
+		},
+		{
+			name:    "invalid version",
+			content: "version: 1.0\nteamName: team\ndefaultEnv: dev\n",
+			want:    []want{{1, 10, "version", `invalid kl file version "1.0"`}},
+		},
+		{
+			name:    "newer version",
+			content: "teamName: team\ndefaultEnv: dev\nversion: v99\n",
+			want:    []want{{3, 10, "version", "kl file version v99 is newer"}},
+		},
+		{
+			name:    "version is not a string",
+			content: "teamName: team\ndefaultEnv: dev\nversion:\n  - v1\n",
+			want:    []want{{4, 3, "version", "expected string, got list"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verrs, err := ValidateKLFileContent([]byte(tt.content))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(verrs) != len(tt.want) {
+				t.Fatalf("got %d problem(s), want %d: %v", len(verrs), len(tt.want), verrs)
+			}
+
+			for i, w := range tt.want {
+				got := verrs[i]
+				if got.Line != w.line || got.Column != w.column || got.Field != w.field || !strings.HasPrefix(got.Message, w.message) {
+					t.Errorf("problem %d = %d:%d %s: %s, want %d:%d %s: %s...", i, got.Line, got.Column, got.Field, got.Message, w.line, w.column, w.field, w.message)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateKLFileOverlayContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+	}{
+		{name: "empty overlay", content: "", want: 0},
+		{name: "required fields are optional", content: "packages:\n  - go@1.22\n", want: 0},
+		{name: "fields are still checked", content: "ports:\n  - 70000\n", want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verrs, err := ValidateKLFileOverlayContent([]byte(tt.content))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(verrs) != tt.want {
+				t.Fatalf("got %d problem(s), want %d: %v", len(verrs), tt.want, verrs)
+			}
+		})
+	}
+}
+
+func TestMigrateKLFileContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		want     string
+		migrated bool
+		errLine  int
+	}{
+		{
+			name:     "latest version is left as is",
+			content:  "version: v1\nteamName: team\n",
+			want:     "version: v1\nteamName: team\n",
+			migrated: false,
+		},
+		{
+			name:     "unversioned file gets a version",
+			content:  "# team\nteamName: team\ndefaultEnv: dev\n",
+			want:     "version: v1\n# team\nteamName: team\ndefaultEnv: dev\n",
+			migrated: true,
+		},
+		{
+			name:    "invalid version is reported with its position",
+			content: "teamName: team\nversion: latest\n",
+			errLine: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, migrated, err := MigrateKLFileContent([]byte(tt.content))
+			if tt.errLine != 0 {
+				verrs, ok := err.(ValidationErrors)
+				if !ok || len(verrs) != 1 || verrs[0].Line != tt.errLine || verrs[0].Field != "version" {
+					t.Fatalf("got error %v, want a version problem at line %d", err, tt.errLine)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if migrated != tt.migrated || string(out) != tt.want {
+				t.Errorf("got migrated=%v\n%s\nwant migrated=%v\n%s", migrated, out, tt.migrated, tt.want)
+			}
+		})
+	}
+}
@@ -1,12 +1,14 @@
 package fileclient
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/kloudlite/kl/domain/envclient"
 	confighandler "github.com/kloudlite/kl/pkg/config-handler"
 	"github.com/kloudlite/kl/pkg/functions"
 	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/text"
 )
 
 type KLFileType struct {
@@ -16,10 +18,27 @@ type KLFileType struct {
 
 	EnvVars EnvVars `json:"envVars" yaml:"envVars"`
 	Mounts  Mounts  `json:"mounts" yaml:"mounts"`
-	Ports   []int   `json:"ports" yaml:"ports"`
+	Ports   Ports   `json:"ports" yaml:"ports"`
+
+	Profiles map[string]KLProfile `json:"profiles,omitempty" yaml:"profiles,omitempty"`
+
+	Hooks *KLHooks `json:"hooks,omitempty" yaml:"hooks,omitempty"`
+
+	PackageResolver *KLPackageResolver `json:"packageResolver,omitempty" yaml:"packageResolver,omitempty"`
+	// Platforms are the nix systems packages are locked for in kl.lock
+	Platforms []string `json:"platforms,omitempty" yaml:"platforms,omitempty"`
+
+	Box *KLBox `json:"box,omitempty" yaml:"box,omitempty"`
+	// Reload configures how env vars and mounts are reloaded into the
+	// running box
+	Reload *KLReload `json:"reload,omitempty" yaml:"reload,omitempty"`
+	// Expose limits ports kl expose watch exposes
+	Expose *KLExpose `json:"expose,omitempty" yaml:"expose,omitempty"`
 
-	// InitScripts []string `json:"initScripts" yaml:"initScripts"`
 	TeamName string `json:"teamName" yaml:"teamName"`
+
+	// ActiveProfile is set by WithProfile, it is never written to kl.yml
+	ActiveProfile string `json:"-" yaml:"-"`
 }
 
 const (
@@ -43,8 +62,10 @@ func getConfigPath() string {
 	return defaultKLFile
 }
 
+// WriteKLFile writes changes made to fileObj (as returned by GetKlFile) into
+// kl.yml, see WriteKLFileLayer to write them into kl.local.yml instead
 func (c *fclient) WriteKLFile(fileObj KLFileType) error {
-	if err := confighandler.WriteConfig(getConfigPath(), fileObj, 0644); err != nil {
+	if err := c.WriteKLFileLayer(KLFileLayerBase, fileObj); err != nil {
 		fn.PrintError(err)
 		return functions.NewE(err)
 	}
@@ -57,25 +78,95 @@ func (c *fclient) GetKlFile(filePath string) (*KLFileType, error) {
 	if err != nil {
 		return nil, functions.NewE(err)
 	}
-	if klfile.TeamName == "" {
-		return nil, functions.Error("kl file is not valid, teamName is not set properly. You can re-initialize kl file by running \"kl init\" command.")
+	return klfile, nil
+}
+
+func (c *fclient) ValidateKlFile(filePath string) (ValidationErrors, error) {
+	if filePath == "" {
+		filePath = getConfigPath()
 	}
-	if klfile.DefaultEnv == "" {
-		return nil, functions.Error("kl file is not valid, defaultEnv is not set properly. You can re-intialize kl file by running \"kl init\" command.")
+
+	b, err := confighandler.ReadRawConfig(filePath)
+	if err != nil {
+		return nil, functions.NewE(err)
 	}
-	return klfile, nil
+
+	return ValidateKLFileContent(b)
 }
 
+// getKlFile returns kl file at filePath with its overlays merged over it
 func (c *fclient) getKlFile(filePath string) (*KLFileType, error) {
 	if filePath == "" {
 		s := getConfigPath()
 		filePath = s
 	}
 
-	klfile, err := confighandler.ReadConfig[KLFileType](filePath)
+	klfile, err := c.getBaseKlFile(filePath)
+	if err != nil {
+		return nil, functions.NewE(err)
+	}
+
+	overlays, err := readKLFileOverlays(filePath)
+	if err != nil {
+		return nil, functions.NewE(err)
+	}
+
+	for _, ov := range overlays {
+		klfile = mergeKLFile(klfile, ov.klfile)
+	}
+
+	return klfile, nil
+}
+
+func (c *fclient) getBaseKlFile(filePath string) (*KLFileType, error) {
+	b, err := confighandler.ReadRawConfig(filePath)
+	if err != nil {
+		return nil, functions.NewE(err)
+	}
+
+	b, err = c.migrateKlFile(filePath, b)
+	if err != nil {
+		return nil, functions.NewE(err)
+	}
+
+	verrs, err := ValidateKLFileContent(b)
+	if err != nil {
+		return nil, functions.NewE(err)
+	}
+
+	if len(verrs) > 0 {
+		return nil, functions.NewE(verrs)
+	}
+
+	klfile, err := confighandler.ParseConfig[KLFileType](b)
 	if err != nil {
 		return nil, functions.NewE(err, "failed to read klfile")
 	}
 
 	return klfile, nil
 }
+
+// migrateKlFile upgrades kl file at filePath to the latest version in place
+func (c *fclient) migrateKlFile(filePath string, b []byte) ([]byte, error) {
+	out, migrated, err := MigrateKLFileContent(b)
+	if err != nil {
+		return nil, functions.NewE(err)
+	}
+
+	if !migrated {
+		return b, nil
+	}
+
+	if verrs, err := ValidateKLFileContent(out); err != nil || len(verrs) > 0 {
+		// leaving the file untouched, so that problems are reported against the original content
+		return b, nil
+	}
+
+	if err := os.WriteFile(filePath, out, 0644); err != nil {
+		return nil, functions.NewE(err, "failed to write migrated kl file")
+	}
+
+	fn.Log(text.Yellow(fmt.Sprintf("[#] %s has been migrated to version %s", filePath, KLFileLatestVersion)))
+
+	return out, nil
+}
@@ -21,8 +21,11 @@ type FileClient interface {
 	GetDevice() (*DeviceContext, error)
 	SetDevice(device *DeviceContext) error
 
+	CreateKLFile(fileObj KLFileType) error
 	WriteKLFile(fileObj KLFileType) error
+	WriteKLFileLayer(layer KLFileLayer, fileObj KLFileType) error
 	GetKlFile(filePath string) (*KLFileType, error)
+	ValidateKlFile(filePath string) (ValidationErrors, error)
 	SelectEnv(ev Env) error
 	SelectEnvOnPath(pth string, ev Env) error
 	EnvOfPath(pth string) (*Env, error)
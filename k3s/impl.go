@@ -6,7 +6,6 @@ import (
 	_ "embed"
 	"encoding/json"
 	"fmt"
-	"os"
 	"text/template"
 	"time"
 
@@ -14,12 +13,12 @@ import (
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/network"
-	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/go-connections/nat"
 	"github.com/kloudlite/kl/constants"
 	"github.com/kloudlite/kl/domain/apiclient"
 	"github.com/kloudlite/kl/domain/fileclient"
 	"github.com/kloudlite/kl/flags"
+	containerruntime "github.com/kloudlite/kl/pkg/container-runtime"
 	fn "github.com/kloudlite/kl/pkg/functions"
 	"github.com/kloudlite/kl/pkg/ui/spinner"
 	"github.com/kloudlite/kl/pkg/ui/text"
@@ -34,6 +33,14 @@ var startupScript string
 
 func (c *client) CreateClustersTeams(teamName string) error {
 	defer spinner.Client.UpdateMessage("setting up cluster")()
+	rt, err := containerruntime.Get()
+	if err != nil {
+		return fn.NewE(err)
+	}
+	if err := containerruntime.RequirePrivileged(rt, "the local cluster"); err != nil {
+		return fn.NewE(err)
+	}
+
 	if err := c.EnsureImage(constants.GetK3SImageName()); err != nil {
 		return fn.NewE(err)
 	}
@@ -345,14 +352,7 @@ func (c *client) EnsureImage(i string) error {
 		return nil
 	}
 
-	out, err := c.c.ImagePull(c.cmd.Context(), i, image.PullOptions{})
-	if err != nil {
-		return fn.NewE(err, fmt.Sprintf("failed to pull image %s", i))
-	}
-	defer out.Close()
-
-	jsonmessage.DisplayJSONMessagesStream(out, os.Stdout, os.Stdout.Fd(), true, nil)
-	return nil
+	return containerruntime.PullImage(c.cmd.Context(), c.c, i)
 }
 
 func (c *client) EnsureKloudliteNetwork() error {
@@ -506,6 +506,16 @@ kubectl patch svc/kl-device-router -n kl-local --type=json --patch-file /tmp/ser
 	return c.runScriptInContainer(script)
 }
 
+// SetInterceptTarget routes traffic of intercepted apps to the box with ip,
+// only one box of the team can receive intercepted traffic at a time
+func (c *client) SetInterceptTarget(ip string) error {
+	defer spinner.Client.UpdateMessage("routing intercepts to the box")()
+	script := fmt.Sprintf(`
+kubectl annotate svc/kl-device-router -n kl-local --overwrite kloudlite.io/networking.proxy.to=%q
+`, ip)
+	return c.runScriptInContainer(script)
+}
+
 func (c *client) RestartWgProxyContainer() error {
 	defer spinner.Client.UpdateMessage("restarting kloudlite-gateway")()
 	script := `
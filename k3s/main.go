@@ -4,6 +4,7 @@ import (
 	dockerclient "github.com/docker/docker/client"
 	"github.com/kloudlite/kl/domain/apiclient"
 	"github.com/kloudlite/kl/domain/fileclient"
+	containerruntime "github.com/kloudlite/kl/pkg/container-runtime"
 	"github.com/spf13/cobra"
 )
 
@@ -14,6 +15,7 @@ type K3sClient interface {
 	EnsureImage(i string) error
 	RestartWgProxyContainer() error
 	RemoveAllIntercepts() error
+	SetInterceptTarget(ip string) error
 	DeletePods() error
 	CheckK3sRunningLocally() (bool, error)
 	RemoveClusterVolume(clusterName string) error
@@ -36,7 +38,7 @@ func NewClient(cmd *cobra.Command) (K3sClient, error) {
 		return nil, err
 	}
 
-	c, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation())
+	c, err := containerruntime.NewClient()
 	if err != nil {
 		return nil, err
 	}
@@ -23,20 +23,14 @@ export PLATFORM_ARCH=$(uname -m)
 export KL_HOST_USER="$KL_HOST_USER"
 EOL
 
-sudo mkdir -p /etc/wireguard
 echo $KL_TEAM_NAME
-set -x
-CLUSTER_IP_RANGE=$(echo $CLUSTER_IP_RANGE | sed 's/\//###/g')
-cat /.cache/kl/kl-workspace-wg.conf | sed "s/#CLUSTER_GATEWAY_IP/${CLUSTER_GATEWAY_IP:-null}/" | sed "s/#CLUSTER_IP_RANGE/${CLUSTER_IP_RANGE:-null}/" >/tmp/wg-cong
-sed -i "s/###/\//" /tmp/wg-cong
-set +x
-sudo cp /tmp/wg-cong /etc/wireguard/kl-workspace-wg.conf
-rm /tmp/wg-cong
-cat /.cache/kl/vpn/${KL_TEAM_NAME}.json | jq -r .wg | base64 -d >/tmp/kl-vpn.conf
-sudo cp /tmp/kl-vpn.conf /etc/wireguard/kl-vpn.conf
-rm /tmp/kl-vpn.conf
-sudo wg-quick up kl-vpn
-sudo wg-quick up kl-workspace-wg
+# only the box holding KL_TUNNEL_IP holds the tunnels to the cluster, every box
+# of this device shares its wireguard keys, see tunnel.sh
+if ip -4 -o addr show | grep -q " ${KL_TUNNEL_IP}/"; then
+  sudo -E /tunnel.sh up
+else
+  echo "another box holds the tunnel to the cluster, starting without it. move it to this box with kl box intercept"
+fi
 
 entrypoint_executed="/home/kl/.kloudlite_entrypoint_executed"
 if [ ! -f "$entrypoint_executed" ]; then
@@ -60,7 +54,14 @@ export PATH=$PATH:$HOME/.local/state/nix/profiles/profile/bin
 
 echo "kloudlite-entrypoint:INSTALLING_PACKAGES"
 cat $KL_HASH_FILE | jq '.hash' -r >/tmp/hash
-cat $KL_HASH_FILE | jq '.config.env | to_entries | map_values(. = "export \(.key)=\"\(.value)\"")|.[]' -r >>/tmp/env
+# env vars and mounts are reloaded into the running box by `kl box apply`,
+# which rewrites these files when only they changed
+cat $KL_HASH_FILE | jq '.config.klConfHash // ""' -r >/tmp/klconf-hash
+cat $KL_HASH_FILE | jq '.config.restartHash // ""' -r >/tmp/restart-hash
+cat $KL_HASH_FILE | jq '.config.env | to_entries | map_values(. = "export \(.key)=\(.value | @sh)")|.[]' -r >/tmp/kl-env
+cat $KL_HASH_FILE | jq '.config.env' -c >/tmp/kl-env.json
+cat $KL_HASH_FILE | jq '.config.mounts // {} | keys | .[]' -r >/tmp/kl-mounts
+echo "[ -f /tmp/kl-env ] && source /tmp/kl-env" >>/tmp/env
 cat >/tmp/mount.sh <<EOF
 set -o errexit
 set -o pipefail
@@ -77,8 +78,17 @@ set -o errexit
 set -o pipefail
 npkgs=$(cat $KL_HASH_FILE | jq '.config.packageHashes | length')
 if [ \$npkgs -gt 0 ]; then
-  nix shell --log-format bar-with-logs $(cat $KL_HASH_FILE | jq '.config.packageHashes | to_entries | map_values(. = .value) | .[]' -r | xargs -I{} printf "%s " {}) --command echo "successfully installed packages"
-  npath=$(nix shell $(cat $KL_HASH_FILE | jq '.config.packageHashes | to_entries | map_values(. = .value) | .[]' -r | xargs -I{} printf "%s " {}) --command printenv PATH)
+  npath=""
+  installables="$(cat $KL_HASH_FILE | jq '.config.packageHashes | to_entries | map(.value) | map(select(endswith(".nix") | not)) | .[]' -r | xargs -I{} printf "%s " {})"
+  if [ -n "\$installables" ]; then
+    nix shell --log-format bar-with-logs \$installables --command echo "successfully installed packages"
+    npath=\$(nix shell \$installables --command printenv PATH)
+  fi
+  # .nix files can't be mixed with flake installables, they are installed one by one
+  for f in $(cat $KL_HASH_FILE | jq '.config.packageHashes | to_entries | map(.value) | map(select(endswith(".nix"))) | .[]' -r | xargs -I{} printf "%s " {}); do
+    nix shell --log-format bar-with-logs --impure --file \$f --command echo "successfully installed \$f"
+    npath=\$npath:\$(nix shell --impure --file \$f --command printenv PATH)
+  done
   echo export PATH=$PATH:\$npath >> /tmp/env
 fi
 EOF
@@ -0,0 +1,35 @@
+#!/usr/bin/env bash
+# brings the tunnels of the box to the cluster of the team up or down, only
+# the box holding the workspace address of the cluster can bring them up,
+# the address is moved between boxes with kl box intercept
+set -o errexit
+set -o pipefail
+
+if [ "$(id -u)" != "0" ]; then
+  echo "tunnel.sh must be run as root" >&2
+  exit 1
+fi
+
+case "${1:-}" in
+up)
+  mkdir -p /etc/wireguard
+  CLUSTER_IP_RANGE=$(echo $CLUSTER_IP_RANGE | sed 's/\//###/g')
+  cat /.cache/kl/kl-workspace-wg.conf | sed "s/#CLUSTER_GATEWAY_IP/${CLUSTER_GATEWAY_IP:-null}/" | sed "s/#CLUSTER_IP_RANGE/${CLUSTER_IP_RANGE:-null}/" >/tmp/wg-cong
+  sed -i "s/###/\//" /tmp/wg-cong
+  cp /tmp/wg-cong /etc/wireguard/kl-workspace-wg.conf
+  rm /tmp/wg-cong
+  cat /.cache/kl/vpn/${KL_TEAM_NAME}.json | jq -r .wg | base64 -d >/etc/wireguard/kl-vpn.conf
+  wg-quick down kl-vpn >/dev/null 2>&1 || true
+  wg-quick down kl-workspace-wg >/dev/null 2>&1 || true
+  wg-quick up kl-vpn
+  wg-quick up kl-workspace-wg
+  ;;
+down)
+  wg-quick down kl-workspace-wg >/dev/null 2>&1 || true
+  wg-quick down kl-vpn >/dev/null 2>&1 || true
+  ;;
+*)
+  echo "usage: tunnel.sh up|down" >&2
+  exit 1
+  ;;
+esac
@@ -0,0 +1,606 @@
+package confighandler
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+
+	fn "github.com/kloudlite/kl/pkg/functions"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+func resolveAlias(n *yamlv3.Node) *yamlv3.Node {
+	for n != nil && n.Kind == yamlv3.AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+
+	return n
+}
+
+func isNullNode(n *yamlv3.Node) bool {
+	return n.Kind == yamlv3.ScalarNode && (n.Tag == "!!null" || (n.Style == 0 && (n.Value == "" || n.Value == "~" || n.Value == "null")))
+}
+
+func isEmptyNode(n *yamlv3.Node) bool {
+	n = resolveAlias(n)
+	if n == nil {
+		return true
+	}
+
+	switch n.Kind {
+	case yamlv3.MappingNode, yamlv3.SequenceNode:
+		return len(n.Content) == 0
+	case yamlv3.ScalarNode:
+		return isNullNode(n)
+	}
+
+	return false
+}
+
+func mappingIndex(n *yamlv3.Node, key string) int {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// nodesEqual compares the values represented by a and b, ignoring styles,
+// tags and comments
+func nodesEqual(a, b *yamlv3.Node) bool {
+	a, b = resolveAlias(a), resolveAlias(b)
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	if a.Kind == yamlv3.ScalarNode && b.Kind == yamlv3.ScalarNode {
+		if isNullNode(a) || isNullNode(b) {
+			return isNullNode(a) && isNullNode(b)
+		}
+		return a.Value == b.Value
+	}
+
+	if a.Kind != b.Kind || len(a.Content) != len(b.Content) {
+		return false
+	}
+
+	switch a.Kind {
+	case yamlv3.MappingNode:
+		for i := 0; i+1 < len(a.Content); i += 2 {
+			j := mappingIndex(b, a.Content[i].Value)
+			if j == -1 || !nodesEqual(a.Content[i+1], b.Content[j+1]) {
+				return false
+			}
+		}
+	default:
+		for i := range a.Content {
+			if !nodesEqual(a.Content[i], b.Content[i]) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// mergeNode updates orig with the values of n, keeping comments, styles,
+// anchors and key order of orig wherever the value is left unchanged
+func mergeNode(orig, n *yamlv3.Node) *yamlv3.Node {
+	if orig == nil {
+		return n
+	}
+
+	if nodesEqual(orig, n) {
+		return orig
+	}
+
+	if orig.Kind == yamlv3.AliasNode || orig.Kind != n.Kind {
+		n.HeadComment, n.LineComment, n.FootComment = orig.HeadComment, orig.LineComment, orig.FootComment
+		return n
+	}
+
+	switch n.Kind {
+	case yamlv3.ScalarNode:
+		quoted := orig.Style&(yamlv3.DoubleQuotedStyle|yamlv3.SingleQuotedStyle) != 0
+		if !quoted || n.Style != 0 {
+			orig.Style = n.Style
+		}
+		orig.Tag, orig.Value = n.Tag, n.Value
+
+	case yamlv3.MappingNode:
+		orig.Content = mergeMappingContent(orig, n)
+
+	case yamlv3.SequenceNode:
+		orig.Content = mergeSequenceContent(orig, n)
+	}
+
+	return orig
+}
+
+// mergeMappingContent keeps the key order of orig, keys only present in n are
+// placed right before the key which follows them in n
+func mergeMappingContent(orig, n *yamlv3.Node) []*yamlv3.Node {
+	before := map[string][]*yamlv3.Node{}
+	tail := make([]*yamlv3.Node, 0)
+
+	pending := make([]*yamlv3.Node, 0)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if mappingIndex(orig, k.Value) == -1 {
+			if !isEmptyNode(v) {
+				pending = append(pending, k, v)
+			}
+			continue
+		}
+
+		before[k.Value] = append(before[k.Value], pending...)
+		pending = make([]*yamlv3.Node, 0)
+	}
+	tail = append(tail, pending...)
+
+	content := make([]*yamlv3.Node, 0, len(n.Content))
+	for i := 0; i+1 < len(orig.Content); i += 2 {
+		k, v := orig.Content[i], orig.Content[i+1]
+		j := mappingIndex(n, k.Value)
+		if j == -1 {
+			continue
+		}
+
+		content = append(content, before[k.Value]...)
+		content = append(content, k, mergeNode(v, n.Content[j+1]))
+	}
+
+	return append(content, tail...)
+}
+
+// mergeSequenceContent follows the order of n, reusing items of orig which
+// are unchanged, and merging the remaining ones by their position
+func mergeSequenceContent(orig, n *yamlv3.Node) []*yamlv3.Node {
+	used := make([]bool, len(orig.Content))
+	content := make([]*yamlv3.Node, len(n.Content))
+
+	for i, item := range n.Content {
+		for j, oitem := range orig.Content {
+			if !used[j] && nodesEqual(oitem, item) {
+				used[j] = true
+				content[i] = oitem
+				break
+			}
+		}
+	}
+
+	for i, item := range n.Content {
+		if content[i] != nil {
+			continue
+		}
+
+		if i < len(orig.Content) && !used[i] {
+			used[i] = true
+			content[i] = mergeNode(orig.Content[i], item)
+			continue
+		}
+
+		content[i] = item
+	}
+
+	return content
+}
+
+func encodeNode(n *yamlv3.Node) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	enc := yamlv3.NewEncoder(buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(n); err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	if err := enc.Close(); err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// clearFootComments drops foot comments of n and its last descendants, they
+// are kept as raw text after the section instead
+func clearFootComments(n *yamlv3.Node) {
+	for n != nil {
+		n.FootComment = ""
+		if len(n.Content) == 0 {
+			return
+		}
+		n = n.Content[len(n.Content)-1]
+	}
+}
+
+func isCommentOrBlank(line string) bool {
+	s := strings.TrimSpace(line)
+	return s == "" || strings.HasPrefix(s, "#")
+}
+
+// entry is the line range (0 indexed, inclusive) of a key of a block mapping
+// or of an item of a block sequence, headStart is where the comment above it
+// starts
+type entry struct {
+	headStart int
+	start     int
+	end       int
+	// col is the column of the key, or of the "-" of the item
+	col int
+}
+
+// entries finds line ranges of every key or item of the block collection n,
+// the last one ends at line to. ok is false when a key or item of n doesn't
+// start a line of its own, n is then rendered again as a whole
+func entries(n *yamlv3.Node, lines []string, to int) ([]entry, bool) {
+	if n.Style&yamlv3.FlowStyle != 0 || len(n.Content) == 0 {
+		return nil, false
+	}
+
+	markers := n.Content
+	if n.Kind == yamlv3.MappingNode {
+		markers = make([]*yamlv3.Node, 0, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Kind != yamlv3.ScalarNode {
+				return nil, false
+			}
+			markers = append(markers, n.Content[i])
+		}
+	}
+
+	resp := make([]entry, 0, len(markers))
+	for i, m := range markers {
+		e := entry{start: m.Line - 1, col: m.Column - 1}
+		if e.start < 0 || e.start > to || e.col < 0 || e.col > len(lines[e.start]) {
+			return nil, false
+		}
+
+		prefix := lines[e.start][:e.col]
+		if n.Kind == yamlv3.SequenceNode {
+			// the item follows its "-" on the same line
+			p := strings.TrimRight(prefix, " ")
+			if !strings.HasSuffix(p, "-") {
+				return nil, false
+			}
+			e.col = len(p) - 1
+			prefix = p[:e.col]
+		}
+
+		// only the first entry shares its line with the "-" of a sequence
+		// item it is nested in
+		if strings.Trim(prefix, " ") != "" && (i > 0 || strings.Trim(prefix, " -") != "") {
+			return nil, false
+		}
+
+		if i > 0 && (resp[i-1].start >= e.start || resp[i-1].col != e.col) {
+			return nil, false
+		}
+
+		e.headStart = e.start
+		if m.HeadComment != "" {
+			hs := max(e.start-(strings.Count(m.HeadComment, "\n")+1), 0)
+			e.headStart = hs
+			for j := hs; j < e.start; j++ {
+				if !isCommentOrBlank(lines[j]) {
+					e.headStart = e.start
+					break
+				}
+			}
+		}
+
+		resp = append(resp, e)
+	}
+
+	for i := range resp {
+		resp[i].end = to
+		if i+1 < len(resp) {
+			resp[i].end = resp[i+1].start - 1
+		}
+
+		for resp[i].end > resp[i].start && isCommentOrBlank(lines[resp[i].end]) {
+			resp[i].end--
+		}
+
+		if i > 0 && resp[i].headStart <= resp[i-1].end {
+			resp[i].headStart = resp[i].start
+		}
+	}
+
+	return resp, true
+}
+
+// pair is a key or item written by PatchYAML, orig is its position in the
+// original collection and next its position in the new one, orig is -1 for
+// keys and items which are added
+type pair struct {
+	orig int
+	next int
+}
+
+// pairMapping keeps the key order of orig, keys only present in n are placed
+// right before the key which follows them in n, same as mergeMappingContent
+func pairMapping(orig, n *yamlv3.Node) []pair {
+	before := map[int][]pair{}
+
+	pending := make([]pair, 0)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		j := mappingIndex(orig, n.Content[i].Value)
+		if j == -1 {
+			if !isEmptyNode(n.Content[i+1]) {
+				pending = append(pending, pair{orig: -1, next: i / 2})
+			}
+			continue
+		}
+
+		before[j/2] = append(before[j/2], pending...)
+		pending = make([]pair, 0)
+	}
+
+	resp := make([]pair, 0, len(n.Content)/2)
+	for j := 0; j+1 < len(orig.Content); j += 2 {
+		if i := mappingIndex(n, orig.Content[j].Value); i != -1 {
+			resp = append(resp, before[j/2]...)
+			resp = append(resp, pair{orig: j / 2, next: i / 2})
+		}
+	}
+
+	return append(resp, pending...)
+}
+
+// pairSequence follows the order of n, pairing items of orig which are
+// unchanged, and the remaining ones by their position, same as
+// mergeSequenceContent
+func pairSequence(orig, n *yamlv3.Node) []pair {
+	used := make([]bool, len(orig.Content))
+	resp := make([]pair, len(n.Content))
+
+	for i, item := range n.Content {
+		resp[i] = pair{orig: -1, next: i}
+		for j, oitem := range orig.Content {
+			if !used[j] && nodesEqual(oitem, item) {
+				used[j] = true
+				resp[i].orig = j
+				break
+			}
+		}
+	}
+
+	for i := range resp {
+		if resp[i].orig == -1 && i < len(orig.Content) && !used[i] {
+			used[i] = true
+			resp[i].orig = i
+		}
+	}
+
+	return resp
+}
+
+type patcher struct {
+	lines []string
+	out   *strings.Builder
+}
+
+// write copies lines from to to, the start of the first line is replaced
+// with prefix
+func (p *patcher) write(from, to int, prefix string) {
+	for i := from; i <= to && i < len(p.lines); i++ {
+		l := p.lines[i]
+		if i == from && prefix != "" && len(prefix) <= len(l) {
+			l = prefix + l[len(prefix):]
+		}
+		p.out.WriteString(l)
+	}
+}
+
+// render writes n, the first line starts with prefix and the following ones
+// are indented to the length of it
+func (p *patcher) render(n *yamlv3.Node, prefix string) error {
+	b, err := encodeNode(n)
+	if err != nil {
+		return fn.NewE(err)
+	}
+
+	if o := p.out.String(); len(o) > 0 && !strings.HasSuffix(o, "\n") {
+		p.out.WriteString("\n")
+	}
+
+	indent := strings.Repeat(" ", len(prefix))
+	for i, l := range strings.SplitAfter(string(b), "\n") {
+		switch {
+		case l == "":
+			continue
+		case i == 0:
+			p.out.WriteString(prefix)
+		case strings.TrimSpace(l) != "":
+			p.out.WriteString(indent)
+		}
+		p.out.WriteString(l)
+	}
+
+	return nil
+}
+
+// renderEntry writes key and value as an entry of a collection of kind, the
+// head comment is left out as it is copied from the original lines
+func (p *patcher) renderEntry(kind yamlv3.Kind, key, value *yamlv3.Node, prefix string) error {
+	v := *value
+	clearFootComments(&v)
+
+	if kind == yamlv3.SequenceNode {
+		v.HeadComment = ""
+		return p.render(&yamlv3.Node{Kind: yamlv3.SequenceNode, Tag: "!!seq", Content: []*yamlv3.Node{&v}}, prefix)
+	}
+
+	k := *key
+	k.HeadComment = ""
+	clearFootComments(&k)
+
+	return p.render(&yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map", Content: []*yamlv3.Node{&k, &v}}, prefix)
+}
+
+// patch writes the keys or items of n over ents, the entries of orig. lead
+// replaces the indentation of the first entry written, which may be the "-"
+// of the sequence item orig is nested in
+func (p *patcher) patch(orig, n *yamlv3.Node, ents []entry, lead string) error {
+	indent := strings.Repeat(" ", ents[0].col)
+
+	pairs := pairSequence(orig, n)
+	if orig.Kind == yamlv3.MappingNode {
+		pairs = pairMapping(orig, n)
+	}
+
+	// gap after the entry preceding e in the original lines, unless e is
+	// written first, it is written before entries added in front of e
+	gapWritten := make([]bool, len(ents))
+	writeGap := func(i int, pr pair) {
+		if pr.orig > 0 && i > 0 && !gapWritten[pr.orig] {
+			p.write(ents[pr.orig-1].end+1, ents[pr.orig].headStart-1, "")
+		}
+		gapWritten[pr.orig] = true
+	}
+
+	for i, pr := range pairs {
+		prefix := indent
+		if i == 0 {
+			prefix = lead
+		}
+
+		var key, ov, nv *yamlv3.Node
+		if orig.Kind == yamlv3.MappingNode {
+			key, nv = n.Content[2*pr.next], n.Content[2*pr.next+1]
+			if pr.orig != -1 {
+				key, ov = orig.Content[2*pr.orig], orig.Content[2*pr.orig+1]
+			}
+		} else {
+			nv = n.Content[pr.next]
+			if pr.orig != -1 {
+				ov = orig.Content[pr.orig]
+			}
+		}
+
+		if pr.orig == -1 {
+			if j := slices.IndexFunc(pairs[i:], func(pr pair) bool { return pr.orig != -1 }); j != -1 {
+				writeGap(i, pairs[i+j])
+			}
+
+			if err := p.renderEntry(orig.Kind, key, nv, prefix); err != nil {
+				return fn.NewE(err)
+			}
+			continue
+		}
+
+		e := ents[pr.orig]
+		writeGap(i, pr)
+		p.write(e.headStart, e.start-1, "")
+
+		if nodesEqual(ov, nv) {
+			p.write(e.start, e.end, prefix)
+			continue
+		}
+
+		ok, err := p.patchValue(orig.Kind, e, ov, nv, prefix)
+		if err != nil {
+			return fn.NewE(err)
+		}
+		if ok {
+			continue
+		}
+
+		if err := p.renderEntry(orig.Kind, key, mergeNode(ov, nv), prefix); err != nil {
+			return fn.NewE(err)
+		}
+	}
+
+	return nil
+}
+
+// patchValue patches the keys or items of ov, the value of e, in place. ok is
+// false when ov is not a block collection which can be patched, it is then
+// rendered again as a whole
+func (p *patcher) patchValue(kind yamlv3.Kind, e entry, ov, nv *yamlv3.Node, prefix string) (bool, error) {
+	if ov.Anchor != "" || (ov.Kind != yamlv3.MappingNode && ov.Kind != yamlv3.SequenceNode) ||
+		ov.Kind != nv.Kind || len(nv.Content) == 0 {
+		return false, nil
+	}
+
+	ents, ok := entries(ov, p.lines, e.end)
+	if !ok {
+		return false, nil
+	}
+
+	var lead string
+	if kind == yamlv3.MappingNode {
+		// the value starts on a line below the key
+		if ents[0].start <= e.start {
+			return false, nil
+		}
+		p.write(e.start, ents[0].headStart-1, prefix)
+		lead = p.lines[ents[0].start][:ents[0].col]
+	} else {
+		// the value starts on the line of the "-" of the item
+		if ents[0].start != e.start || len(prefix) > ents[0].col {
+			return false, nil
+		}
+		ents[0].headStart = ents[0].start
+		lead = prefix + p.lines[e.start][len(prefix):ents[0].col]
+	}
+
+	if err := p.patch(ov, nv, ents, lead); err != nil {
+		return true, fn.NewE(err)
+	}
+
+	p.write(ents[len(ents)-1].end+1, e.end, "")
+
+	return true, nil
+}
+
+// PatchYAML writes the values of n over src, only keys and items whose
+// values have changed are rendered again, down to the innermost block
+// collection holding them. everything else (comments, blank lines, anchors
+// and ordering) is kept byte for byte
+func PatchYAML(src []byte, n *yamlv3.Node) ([]byte, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(src, &doc); err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	if n.Kind == yamlv3.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode || n.Kind != yamlv3.MappingNode {
+		return encodeNode(n)
+	}
+
+	root := doc.Content[0]
+	lines := strings.SplitAfter(string(src), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	ents, ok := entries(root, lines, len(lines)-1)
+	if !ok || ents[0].col != 0 {
+		return encodeNode(&yamlv3.Node{Kind: yamlv3.DocumentNode, Content: []*yamlv3.Node{mergeNode(root, n)}, HeadComment: doc.HeadComment, FootComment: doc.FootComment})
+	}
+
+	p := &patcher{lines: lines, out: new(strings.Builder)}
+	p.write(0, ents[0].headStart-1, "")
+	if err := p.patch(root, n, ents, ""); err != nil {
+		return nil, fn.NewE(err)
+	}
+	p.write(ents[len(ents)-1].end+1, len(lines)-1, "")
+
+	return []byte(p.out.String()), nil
+}
+
+// MarshalYAML encodes v the same way as entries rendered by PatchYAML
+func MarshalYAML(v any) ([]byte, error) {
+	var n yamlv3.Node
+	if err := n.Encode(v); err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	return encodeNode(&n)
+}
@@ -0,0 +1,206 @@
+package confighandler
+
+import (
+	"testing"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+func TestPatchYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		next string
+		want string
+	}{
+		{
+			name: "unchanged file is kept byte for byte",
+			src:  "# head\nversion: v1\n\npackages:   [a, b]   # inline\nteamName: t\n# trailing\n",
+			next: "version: v1\npackages: [a, b]\nteamName: t\n",
+			want: "# head\nversion: v1\n\npackages:   [a, b]   # inline\nteamName: t\n# trailing\n",
+		},
+		{
+			name: "adding an item keeps blank lines and comments of its siblings",
+			src: `packages:
+  # editor
+  - neovim   # the editor
+
+  - git
+teamName: t
+`,
+			next: "packages: [neovim, git, go]\nteamName: t\n",
+			want: `packages:
+  # editor
+  - neovim   # the editor
+
+  - git
+  - go
+teamName: t
+`,
+		},
+		{
+			name: "removing the first item drops the gap after it",
+			src: `packages:
+  - neovim
+
+  # vcs
+  - git
+teamName: t
+`,
+			next: "packages: [git]\nteamName: t\n",
+			want: `packages:
+  # vcs
+  - git
+teamName: t
+`,
+		},
+		{
+			name: "indentless sequences keep their indentation",
+			src:  "packages:\n- neovim\nteamName: t\n",
+			next: "packages: [neovim, git]\nteamName: t\n",
+			want: "packages:\n- neovim\n- git\nteamName: t\n",
+		},
+		{
+			name: "changing a nested value only renders that key",
+			src: `envVars:
+  - key: A   # a
+    value:    a
+
+  - key: B
+    value: b   # b
+`,
+			next: "envVars: [{key: A, value: a}, {key: B, value: bb}]\n",
+			want: `envVars:
+  - key: A   # a
+    value:    a
+
+  - key: B
+    value: bb # b
+`,
+		},
+		{
+			name: "removing the first key of an item keeps the dash",
+			src: `envVars:
+  - key: A
+    value: a
+    # secret
+    secretRef: s/a
+`,
+			next: "envVars: [{value: a, secretRef: s/a}]\n",
+			want: `envVars:
+  - value: a
+    # secret
+    secretRef: s/a
+`,
+		},
+		{
+			name: "new keys are placed before the key following them",
+			src:  "version: v1\n\nteamName: t # team\n",
+			next: "version: v1\ndefaultEnv: dev\nteamName: t\n",
+			want: "version: v1\n\ndefaultEnv: dev\nteamName: t # team\n",
+		},
+		{
+			name: "empty new keys are left out",
+			src:  "version: v1\n",
+			next: "version: v1\nports: []\nmounts: null\n",
+			want: "version: v1\n",
+		},
+		{
+			name: "removed keys are dropped with their comment",
+			src:  "version: v1\n# old\nold: true\nteamName: t\n",
+			next: "version: v1\nteamName: t\n",
+			want: "version: v1\nteamName: t\n",
+		},
+		{
+			name: "flow collections are rendered again in flow style",
+			src:  "packages: [a]  # list\nteamName: t\n",
+			next: "packages: [a, b]\nteamName: t\n",
+			want: "packages: [a, b] # list\nteamName: t\n",
+		},
+		{
+			name: "emptied collections are rendered again",
+			src:  "packages:\n  - a\nteamName: t\n",
+			next: "packages: []\nteamName: t\n",
+			want: "packages: []\nteamName: t\n",
+		},
+		{
+			name: "nested sequences",
+			src:  "matrix:\n  - - a\n    - b\n  - - c\n",
+			next: "matrix: [[a, b, x], [c]]\n",
+			want: "matrix:\n  - - a\n    - b\n    - x\n  - - c\n",
+		},
+		{
+			name: "anchored values are rendered again with their anchor",
+			src:  "base: &base\n  a: 1\nother: *base\n",
+			next: "base: {a: 2}\nother: {a: 2}\n",
+			want: "base: &base\n  a: 2\nother: *base\n",
+		},
+		{
+			name: "file without a trailing new line",
+			src:  "packages:\n  - a",
+			next: "packages: [a, b]\n",
+			want: "packages:\n  - a\n  - b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n yamlv3.Node
+			if err := yamlv3.Unmarshal([]byte(tt.next), &n); err != nil {
+				t.Fatalf("invalid next: %v", err)
+			}
+
+			// values are compared, styles of next don't matter
+			setBlockStyle(&n)
+
+			got, err := PatchYAML([]byte(tt.src), &n)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+
+			var doc yamlv3.Node
+			if err := yamlv3.Unmarshal(got, &doc); err != nil {
+				t.Fatalf("patched yaml is not valid: %v", err)
+			}
+
+			if !holdsValues(doc.Content[0], n.Content[0]) {
+				t.Errorf("patched yaml doesn't hold the values of next")
+			}
+		})
+	}
+}
+
+func setBlockStyle(n *yamlv3.Node) {
+	n.Style &^= yamlv3.FlowStyle
+	for _, c := range n.Content {
+		setBlockStyle(c)
+	}
+}
+
+// holdsValues is nodesEqual, where keys missing from got are expected to be
+// empty in want
+func holdsValues(got, want *yamlv3.Node) bool {
+	if got.Kind != yamlv3.MappingNode || want.Kind != yamlv3.MappingNode {
+		return nodesEqual(got, want)
+	}
+
+	for i := 0; i+1 < len(want.Content); i += 2 {
+		j := mappingIndex(got, want.Content[i].Value)
+		if j == -1 {
+			if !isEmptyNode(want.Content[i+1]) {
+				return false
+			}
+			continue
+		}
+
+		if !nodesEqual(got.Content[j+1], want.Content[i+1]) {
+			return false
+		}
+	}
+
+	return true
+}
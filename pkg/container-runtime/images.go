@@ -0,0 +1,222 @@
+package containerruntime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	dockerclient "github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/go-units"
+	fn "github.com/kloudlite/kl/pkg/functions"
+	"github.com/kloudlite/kl/pkg/ui/spinner"
+)
+
+const (
+	pullAttempts = 3
+	pullBackoff  = 3 * time.Second
+
+	// progressInterval throttles progress updates of pulls, layers are logged
+	// in verbose mode once pulled
+	progressInterval = 500 * time.Millisecond
+)
+
+// ImageExists reports whether ref is tagged in the runtime
+func ImageExists(ctx context.Context, cli *dockerclient.Client, ref string) (bool, error) {
+	images, err := cli.ImageList(ctx, image.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("reference", ref)),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	for _, i := range images {
+		for _, tag := range i.RepoTags {
+			if tag == ref {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// PullImage pulls ref with progress of its layers shown in the spinner.
+// failed pulls are retried, layers pulled before the failure are kept by the
+// runtime so retries resume where the pull stopped
+func PullImage(ctx context.Context, cli *dockerclient.Client, ref string) error {
+	var err error
+	for attempt := 1; attempt <= pullAttempts; attempt++ {
+		if err = pullImage(ctx, cli, ref); err == nil || ctx.Err() != nil {
+			break
+		}
+
+		if attempt == pullAttempts {
+			break
+		}
+
+		fn.Warn(fmt.Sprintf("failed to pull image %s, retrying [%d/%d]: %s", ref, attempt, pullAttempts-1, err.Error()))
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Duration(attempt) * pullBackoff):
+		}
+	}
+
+	if err != nil {
+		return fn.NewE(err, fmt.Sprintf("failed to pull image %s", ref))
+	}
+
+	return nil
+}
+
+func pullImage(ctx context.Context, cli *dockerclient.Client, ref string) error {
+	out, err := cli.ImagePull(ctx, ref, image.PullOptions{})
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	p := newPullProgress(ref)
+	defer p.done()
+
+	dec := json.NewDecoder(out)
+	for {
+		var m jsonmessage.JSONMessage
+		if err := dec.Decode(&m); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		if m.Error != nil {
+			return m.Error
+		}
+
+		p.update(m)
+	}
+}
+
+type layerProgress struct {
+	current int64
+	total   int64
+	done    bool
+}
+
+// pullProgress sums the progress of layers of a pull into one spinner
+// message
+type pullProgress struct {
+	ref     string
+	layers  map[string]*layerProgress
+	order   []string
+	last    time.Time
+	restore func()
+}
+
+func newPullProgress(ref string) *pullProgress {
+	return &pullProgress{
+		ref:     ref,
+		layers:  map[string]*layerProgress{},
+		restore: spinner.Client.UpdateMessage(fmt.Sprintf("pulling image %s", ref)),
+	}
+}
+
+func (p *pullProgress) update(m jsonmessage.JSONMessage) {
+	// messages without an id are about the image, such as its digest
+	if m.ID == "" || strings.HasPrefix(m.Status, "Pulling from") {
+		return
+	}
+
+	l, ok := p.layers[m.ID]
+	if !ok {
+		l = &layerProgress{}
+		p.layers[m.ID] = l
+		p.order = append(p.order, m.ID)
+	}
+
+	switch {
+	case m.Status == "Downloading" && m.Progress != nil:
+		l.current, l.total = m.Progress.Current, m.Progress.Total
+	case m.Status == "Download complete", m.Status == "Pull complete", m.Status == "Already exists":
+		l.current = l.total
+		l.done = true
+		fn.Debug(fmt.Sprintf("pulling image %s: layer %s %s", p.ref, m.ID, strings.ToLower(m.Status)))
+	default:
+		return
+	}
+
+	if !l.done && time.Since(p.last) < progressInterval {
+		return
+	}
+	p.last = time.Now()
+
+	var done int
+	var current, total int64
+	for _, id := range p.order {
+		layer := p.layers[id]
+		if layer.done {
+			done++
+		}
+		current += layer.current
+		total += layer.total
+	}
+
+	msg := fmt.Sprintf("pulling image %s [%d/%d layers", p.ref, done, len(p.order))
+	if total > 0 {
+		msg += fmt.Sprintf(", %s/%s", units.HumanSize(float64(current)), units.HumanSize(float64(total)))
+	}
+
+	p.restore()
+	p.restore = spinner.Client.UpdateMessage(msg + "]")
+}
+
+func (p *pullProgress) done() {
+	p.restore()
+}
+
+// LoadImages loads a tarball of images written by docker save, compressed
+// tarballs are detected by the runtime. it returns the loaded images
+func LoadImages(ctx context.Context, cli *dockerclient.Client, r io.Reader) ([]string, error) {
+	resp, err := cli.ImageLoad(ctx, r, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if !resp.JSON {
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fn.Errorf("unexpected response of runtime: %s", strings.TrimSpace(string(b)))
+	}
+
+	loaded := make([]string, 0)
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var m jsonmessage.JSONMessage
+		if err := dec.Decode(&m); err != nil {
+			if errors.Is(err, io.EOF) {
+				return loaded, nil
+			}
+			return nil, err
+		}
+
+		if m.Error != nil {
+			return nil, m.Error
+		}
+
+		// the stream reports "Loaded image: <ref>" for every image
+		if _, ref, ok := strings.Cut(m.Stream, "Loaded image: "); ok {
+			loaded = append(loaded, strings.TrimSpace(ref))
+		} else if _, id, ok := strings.Cut(m.Stream, "Loaded image ID: "); ok {
+			loaded = append(loaded, strings.TrimSpace(id))
+		}
+	}
+}
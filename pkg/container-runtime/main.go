@@ -0,0 +1,316 @@
+package containerruntime
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	dockerclient "github.com/docker/docker/client"
+	"github.com/kloudlite/kl/domain/envclient"
+	"github.com/kloudlite/kl/domain/fileclient"
+	fn "github.com/kloudlite/kl/pkg/functions"
+)
+
+type Name string
+
+const (
+	Auto   Name = "auto"
+	Docker Name = "docker"
+	Podman Name = "podman"
+
+	// runtimeEnv overrides the runtime set with `kl config set runtime`, it is
+	// also set in boxes so that kl running inside uses the runtime of the host
+	runtimeEnv = "KL_CONTAINER_RUNTIME"
+
+	// BoxSocketPath is where socket of the host runtime is mounted in boxes.
+	// it is owned by root, so klbox-docker/docker-socket.sh proxies it to
+	// boxProxySocketPath which is owned by the kl user
+	BoxSocketPath = "/var/run/host-docker.sock"
+
+	// boxProxySocketPath is the socket kl running inside boxes talks to
+	boxProxySocketPath = "/var/run/docker.sock"
+)
+
+var Names = []Name{Auto, Docker, Podman}
+
+func ParseName(s string) (Name, error) {
+	for _, n := range Names {
+		if string(n) == strings.ToLower(strings.TrimSpace(s)) {
+			return n, nil
+		}
+	}
+
+	return "", fn.Errorf("unknown container runtime %q, must be one of auto, docker or podman", s)
+}
+
+// Runtime is the container engine boxes, k3s and wireguard containers run
+// on. every supported runtime serves the docker engine api, so the docker
+// sdk is used to talk to all of them
+type Runtime interface {
+	Name() Name
+	// SocketPath is path of the api socket on the host, it is mounted in
+	// boxes at BoxSocketPath. inside boxes, it is path of the socket proxied
+	// to the kl user
+	SocketPath() string
+	Client() (*dockerclient.Client, error)
+	// ConfigureHost applies runtime specific settings to host config of
+	// boxes
+	ConfigureHost(hc *container.HostConfig)
+	// Rootless reports whether containers run in the user namespace of an
+	// unprivileged user, they get no privileges on the host then
+	Rootless() bool
+}
+
+// RequirePrivileged fails when containers of r can't get privileges on the
+// host, which what runs with
+func RequirePrivileged(r Runtime, what string) error {
+	if !r.Rootless() {
+		return nil
+	}
+
+	return fn.Errorf("%s needs a container privileged on the host, which rootless %s can't run. enable the rootful socket with sudo systemctl enable --now podman.socket and run kl with sudo, or use docker", what, r.Name())
+}
+
+type dockerRuntime struct{}
+
+func (d *dockerRuntime) Name() Name {
+	return Docker
+}
+
+func (d *dockerRuntime) SocketPath() string {
+	if envclient.InsideBox() {
+		return boxSocketPath()
+	}
+
+	// docker desktop serves /var/run/docker.sock to containers whichever
+	// socket the host uses
+	if runtime.GOOS != "linux" {
+		return "/var/run/docker.sock"
+	}
+
+	if s, ok := unixSocket(os.Getenv(dockerclient.EnvOverrideHost)); ok {
+		return s
+	}
+
+	// rootless docker
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" && !exists("/var/run/docker.sock") && exists(filepath.Join(dir, "docker.sock")) {
+		return filepath.Join(dir, "docker.sock")
+	}
+
+	return "/var/run/docker.sock"
+}
+
+func (d *dockerRuntime) Client() (*dockerclient.Client, error) {
+	opts := []dockerclient.Opt{dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation()}
+	if os.Getenv(dockerclient.EnvOverrideHost) == "" {
+		opts = append(opts, dockerclient.WithHost("unix://"+d.SocketPath()))
+	}
+
+	c, err := dockerclient.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, fn.NewE(err, "failed to create docker client")
+	}
+
+	return c, nil
+}
+
+func (d *dockerRuntime) ConfigureHost(hc *container.HostConfig) {}
+
+func (d *dockerRuntime) Rootless() bool {
+	return false
+}
+
+type podmanRuntime struct{}
+
+func (p *podmanRuntime) Name() Name {
+	return Podman
+}
+
+const podmanRootfulSocket = "/run/podman/podman.sock"
+
+// invokingUID is the uid of the user running kl, the user sudo was run by
+// when kl runs with sudo
+func invokingUID() int {
+	if os.Geteuid() == 0 {
+		if uid, err := strconv.Atoi(os.Getenv("SUDO_UID")); err == nil {
+			return uid
+		}
+	}
+
+	return os.Getuid()
+}
+
+// userSocket is the socket of rootless podman of the user running kl,
+// XDG_RUNTIME_DIR is only kept by sudo when it is of that user
+func (p *podmanRuntime) userSocket() string {
+	uid := invokingUID()
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" || (uid != os.Getuid() && dir == fmt.Sprintf("/run/user/%d", os.Getuid())) {
+		dir = fmt.Sprintf("/run/user/%d", uid)
+	}
+
+	return filepath.Join(dir, "podman", "podman.sock")
+}
+
+// Rootless reports whether kl talks to podman of an unprivileged user. with
+// sudo, the rootful socket is used when it runs, as root doesn't own the
+// rootless one
+func (p *podmanRuntime) Rootless() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+
+	if os.Geteuid() != 0 {
+		return true
+	}
+
+	return invokingUID() != 0 && !exists(podmanRootfulSocket) && exists(p.userSocket())
+}
+
+func (p *podmanRuntime) SocketPath() string {
+	if envclient.InsideBox() {
+		return boxSocketPath()
+	}
+
+	for _, env := range []string{"CONTAINER_HOST", dockerclient.EnvOverrideHost} {
+		if s, ok := unixSocket(os.Getenv(env)); ok {
+			return s
+		}
+	}
+
+	if p.Rootless() {
+		return p.userSocket()
+	}
+
+	if runtime.GOOS == "darwin" {
+		// socket of podman machine, forwarded to the api socket of the vm
+		if home, err := os.UserHomeDir(); err == nil {
+			matches, _ := filepath.Glob(filepath.Join(home, ".local", "share", "containers", "podman", "machine", "*", "podman.sock"))
+			if len(matches) > 0 {
+				return matches[0]
+			}
+		}
+	}
+
+	return podmanRootfulSocket
+}
+
+func (p *podmanRuntime) Client() (*dockerclient.Client, error) {
+	c, err := dockerclient.NewClientWithOpts(
+		dockerclient.WithHost("unix://"+p.SocketPath()),
+		dockerclient.WithAPIVersionNegotiation(),
+	)
+	if err != nil {
+		return nil, fn.NewE(err, "failed to create podman client")
+	}
+
+	return c, nil
+}
+
+func (p *podmanRuntime) ConfigureHost(hc *container.HostConfig) {
+	if p.Rootless() {
+		// boxes run with uid and gid of the host user, keep-id maps them to
+		// the same ids inside the user namespace so that files of the
+		// workspace stay owned by the user
+		hc.UsernsMode = "keep-id"
+	}
+}
+
+// boxSocketPath is the socket of the host runtime as seen by kl running
+// inside boxes, DOCKER_HOST takes precedence when it is a unix socket
+func boxSocketPath() string {
+	if s, ok := unixSocket(os.Getenv(dockerclient.EnvOverrideHost)); ok {
+		return s
+	}
+
+	return boxProxySocketPath
+}
+
+func unixSocket(host string) (string, bool) {
+	if !strings.HasPrefix(host, "unix://") {
+		return "", false
+	}
+
+	return strings.TrimPrefix(host, "unix://"), true
+}
+
+func exists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+func newRuntime(n Name) Runtime {
+	if n == Podman {
+		return &podmanRuntime{}
+	}
+
+	return &dockerRuntime{}
+}
+
+// detect prefers docker, podman is used only when its socket is found and
+// docker's is not
+func detect() Runtime {
+	if _, ok := os.LookupEnv(dockerclient.EnvOverrideHost); ok {
+		return &dockerRuntime{}
+	}
+
+	d := &dockerRuntime{}
+	if exists(d.SocketPath()) {
+		return d
+	}
+
+	p := &podmanRuntime{}
+	if exists(p.SocketPath()) {
+		return p
+	}
+
+	return d
+}
+
+// Get returns the configured runtime, KL_CONTAINER_RUNTIME wins over the
+// runtime set with `kl config set runtime`, it is detected when neither is set
+// or set to auto
+func Get() (Runtime, error) {
+	s, ok := os.LookupEnv(runtimeEnv)
+	if !ok && !envclient.InsideBox() {
+		var err error
+		if s, err = fileclient.GetContainerRuntime(); err != nil {
+			return nil, fn.NewE(err)
+		}
+	}
+
+	if s == "" {
+		return detect(), nil
+	}
+
+	n, err := ParseName(s)
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	if n == Auto {
+		return detect(), nil
+	}
+
+	return newRuntime(n), nil
+}
+
+// NewClient returns client of the configured runtime
+func NewClient() (*dockerclient.Client, error) {
+	r, err := Get()
+	if err != nil {
+		return nil, fn.NewE(err)
+	}
+
+	return r.Client()
+}
+
+// BoxEnv is env of boxes which makes kl inside them use the runtime of the
+// host
+func BoxEnv(r Runtime) string {
+	return fmt.Sprintf("%s=%s", runtimeEnv, r.Name())
+}
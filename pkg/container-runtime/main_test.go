@@ -0,0 +1,41 @@
+package containerruntime
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestPodmanUserSocket(t *testing.T) {
+	type testCase struct {
+		name    string
+		sudoUID string
+		xdg     string
+		want    string
+	}
+
+	tests := []testCase{
+		{name: "without sudo", xdg: "/run/user/1234", want: "/run/user/1234/podman/podman.sock"},
+		{name: "without XDG_RUNTIME_DIR", want: fmt.Sprintf("/run/user/%d/podman/podman.sock", os.Getuid())},
+	}
+
+	// SUDO_UID is only read when kl runs as root
+	if os.Geteuid() == 0 && os.Getuid() == 0 {
+		tests = append(tests,
+			testCase{name: "with sudo", sudoUID: "1000", want: "/run/user/1000/podman/podman.sock"},
+			testCase{name: "with sudo keeping XDG_RUNTIME_DIR of root", sudoUID: "1000", xdg: "/run/user/0", want: "/run/user/1000/podman/podman.sock"},
+			testCase{name: "with sudo -E", sudoUID: "1000", xdg: "/run/user/1000", want: "/run/user/1000/podman/podman.sock"},
+		)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SUDO_UID", tt.sudoUID)
+			t.Setenv("XDG_RUNTIME_DIR", tt.xdg)
+
+			if got := (&podmanRuntime{}).userSocket(); got != tt.want {
+				t.Errorf("userSocket() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -25,6 +25,10 @@ func WithKlFile(cmd *cobra.Command) {
 	cmd.Flags().StringP("klfile", "k", "", "kloudlite file")
 }
 
+func WithKlFileLayer(cmd *cobra.Command) {
+	cmd.Flags().Bool("local", false, "write changes to kl.local.yml instead of kl.yml")
+}
+
 func ParseKlFile(cmd *cobra.Command) string {
 	if cmd.Flags().Changed("klfile") {
 		v, _ := cmd.Flags().GetString("klfile")